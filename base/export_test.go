@@ -0,0 +1,6 @@
+package base
+
+// Lets the specs in base_test see what has been logged.
+func Logged() string {
+  return log_console.String()
+}
@@ -0,0 +1,134 @@
+package base
+
+import (
+  "fmt"
+  "os"
+  "path/filepath"
+  "reflect"
+  "strings"
+)
+
+// Files saved as gob have this after their usual suffix, so foo.house holds
+// json and foo.house.gob holds the same house as gob.  Anything loaded with
+// RegisterAllObjectsInDir can be in either format.
+const GobSuffix = ".gob"
+
+// Maps the directories that objects have been loaded from, and then the
+// suffix of the files they were loaded from, to the type of those objects so
+// that ConvertFormat knows what to decode each file into.  Many registries
+// use the same suffix, so the directory is needed to tell them apart.
+var registry_dirs = make(map[string]map[string]reflect.Type)
+
+func registerDir(dir, suffix string, typ reflect.Type) {
+  if abs, err := filepath.Abs(dir); err == nil {
+    dir = abs
+  }
+  dir = filepath.Clean(dir)
+  if registry_dirs[dir] == nil {
+    registry_dirs[dir] = make(map[string]reflect.Type)
+  }
+  registry_dirs[dir][suffix] = typ
+}
+
+// Returns the type of the objects that the file at path would be loaded as,
+// or nil if path isn't under a directory that any registry has been loaded
+// from.
+func typeOfFile(path string) reflect.Type {
+  if abs, err := filepath.Abs(path); err == nil {
+    path = abs
+  }
+  for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+    for suffix, typ := range registry_dirs[dir] {
+      if strings.HasSuffix(path, suffix) {
+        return typ
+      }
+    }
+    if dir == filepath.Dir(dir) {
+      return nil
+    }
+  }
+}
+
+// Returns the format, "json" or "gob", of the file at path based on its name.
+func FormatOfPath(path string) string {
+  if strings.HasSuffix(path, GobSuffix) {
+    return "gob"
+  }
+  return "json"
+}
+
+// Saves source to path in the specified format, either "json" or "gob".
+func SaveObject(path, format string, source interface{}) error {
+  switch format {
+  case "json":
+    return SaveJson(path, source)
+
+  case "gob":
+    return SaveGob(path, source)
+  }
+  return fmt.Errorf("Can only save with format 'json' and 'gob', not '%s'", format)
+}
+
+// Converts every file under path, which can be a single file or a directory,
+// from one format to the other.  Each converted file replaces the original,
+// with GobSuffix added or removed from its name.  Only files in directories
+// that a registry has already been loaded from, with that registry's suffix,
+// are converted, since that is how the type to decode them into is found.
+// The original is only removed once the converted file has been read back.
+func ConvertFormat(path, from, to string) error {
+  for _, format := range []string{from, to} {
+    if format != "json" && format != "gob" {
+      return fmt.Errorf("Can only convert between 'json' and 'gob', not '%s'", format)
+    }
+  }
+  if from == to {
+    return nil
+  }
+  return filepath.Walk(path, func(src string, info os.FileInfo, err error) error {
+    if err != nil {
+      return err
+    }
+    if info.IsDir() {
+      return nil
+    }
+    name := src
+    if from == "gob" {
+      if !strings.HasSuffix(name, GobSuffix) {
+        return nil
+      }
+      name = strings.TrimSuffix(name, GobSuffix)
+    }
+    typ := typeOfFile(name)
+    if typ == nil {
+      return nil
+    }
+    dst := name
+    if to == "gob" {
+      dst += GobSuffix
+    }
+
+    target := reflect.New(typ)
+    if from == "gob" {
+      err = LoadGob(src, target.Interface())
+    } else {
+      err = LoadJson(src, target.Interface())
+    }
+    if err != nil {
+      return fmt.Errorf("Unable to load '%s': %v", src, err)
+    }
+    if err := SaveObject(dst, to, target.Interface()); err != nil {
+      return fmt.Errorf("Unable to save '%s': %v", dst, err)
+    }
+    check := reflect.New(typ)
+    if to == "gob" {
+      err = LoadGob(dst, check.Interface())
+    } else {
+      err = LoadJson(dst, check.Interface())
+    }
+    if err != nil {
+      return fmt.Errorf("Unable to read back '%s', leaving '%s' alone: %v", dst, src, err)
+    }
+    Log().Printf("Converted '%s' to '%s'", src, dst)
+    return os.Remove(src)
+  })
+}
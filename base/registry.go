@@ -41,14 +41,20 @@ import (
 
 var (
   registry_registry map[string]reflect.Value
+
+  // For registries loaded with RegisterObjectsLayered, maps the name of each
+  // object to the directory it was loaded from.
+  registry_layers map[string]map[string]string
 )
 
 func init() {
   registry_registry = make(map[string]reflect.Value)
+  registry_layers = make(map[string]map[string]string)
 }
 
 func RemoveRegistry(name string) {
   delete(registry_registry, name)
+  delete(registry_layers, name)
 }
 
 // Registers a registry which must be a map from string to pointers to something
@@ -221,11 +227,70 @@ func ProcessObject(val reflect.Value, tag string) {
 // RegisterObject().  format should either be "json" or "gob"
 // Files begining with '.' are ignored in this process
 func RegisterAllObjectsInDir(registry_name, dir, suffix, format string) {
+  loadAllObjectsInDir(registry_name, dir, suffix, format, func(object interface{}) {
+    RegisterObject(registry_name, object)
+  })
+}
+
+// Like RegisterAllObjectsInDir, but loads each directory in dirs in order and
+// an object in one directory replaces any object with the same name that is
+// already in the registry, rather than being an error.  This lets a directory
+// of mods override the base data, and lets the same directories be loaded
+// again.  Two objects with the same name in one directory are still an
+// error.  Use ObjectLayer to find out which directory an object ended up
+// coming from.
+func RegisterObjectsLayered(registry_name string, dirs []string, suffix, format string) {
+  reg, ok := registry_registry[registry_name]
+  if !ok {
+    Error().Printf("Tried to load objects into an unknown registry '%s'", registry_name)
+    return
+  }
+  layers := registry_layers[registry_name]
+  if layers == nil {
+    layers = make(map[string]string)
+    registry_layers[registry_name] = layers
+  }
+  // The directory each name was loaded from during this call.
+  loaded := make(map[string]string)
+  for _, dir := range dirs {
+    if _, err := os.Stat(dir); err != nil {
+      Warn().Printf("Skipping layer '%s' of registry '%s': %v", dir, registry_name, err)
+      continue
+    }
+    loadAllObjectsInDir(registry_name, dir, suffix, format, func(object interface{}) {
+      name := reflect.ValueOf(object).Elem().FieldByName("Name").String()
+      if loaded[name] != dir && reg.MapIndex(reflect.ValueOf(name)).IsValid() {
+        if prev, ok := loaded[name]; ok {
+          Log().Printf("'%s' in registry '%s' from '%s' overrides the one from '%s'", name, registry_name, dir, prev)
+        }
+        reg.SetMapIndex(reflect.ValueOf(name), reflect.Value{})
+      }
+      RegisterObject(registry_name, object)
+      loaded[name] = dir
+      layers[name] = dir
+    })
+  }
+}
+
+// Returns the directory that the named object was loaded from by
+// RegisterObjectsLayered, or the empty string if it wasn't loaded that way.
+func ObjectLayer(registry_name, name string) string {
+  return registry_layers[registry_name][name]
+}
+
+// Objects that can be malformed in ways that the loader can't tell implement
+// this, objects that fail validation are not registered.
+type validator interface {
+  Validate() error
+}
+
+func loadAllObjectsInDir(registry_name, dir, suffix, format string, register func(object interface{})) {
   Log().Printf("Registering directory: '%s'", dir)
   reg, ok := registry_registry[registry_name]
   if !ok {
     Error().Printf("Tried to load objects into an unknown registry '%s'", registry_name)
   }
+  registerDir(dir, suffix, reg.Type().Elem().Elem())
   filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
     _, filename := filepath.Split(path)
     if err != nil {
@@ -240,11 +305,19 @@ func RegisterAllObjectsInDir(registry_name, dir, suffix, format string) {
       return nil
     }
     if !info.IsDir() {
-      if strings.HasSuffix(info.Name(), suffix) {
+      is_gob := strings.HasSuffix(info.Name(), suffix+GobSuffix)
+      file_format := format
+      if is_gob {
+        file_format = "gob"
+      }
+      if strings.HasSuffix(info.Name(), suffix) || is_gob {
         target := reflect.New(reg.Type().Elem().Elem())
-        err = LoadAndProcessObject(path, format, target.Interface())
+        err = LoadAndProcessObject(path, file_format, target.Interface())
+        if v, ok := target.Interface().(validator); ok && err == nil {
+          err = v.Validate()
+        }
         if err == nil {
-          RegisterObject(registry_name, target.Interface())
+          register(target.Interface())
         } else {
           Error().Printf("Error loading file '%s': %v", path, err)
         }
@@ -0,0 +1,56 @@
+package base_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/runningwild/haunts/base"
+  "path/filepath"
+  "strings"
+)
+
+type layerDef struct {
+  Name  string
+  Value int
+}
+
+type layer struct {
+  Defname string
+  *layerDef
+}
+
+func getLayer(name string) *layer {
+  l := layer{Defname: name}
+  base.GetObject("layers", &l)
+  return &l
+}
+
+func RegistrySpec(c gospec.Context) {
+  datadir, _ := filepath.Abs("../data_test")
+  base.SetDatadir(datadir)
+  lower := filepath.Join(datadir, "layers", "base")
+  upper := filepath.Join(datadir, "layers", "mod")
+  base.RemoveRegistry("layers")
+  base.RegisterRegistry("layers", make(map[string]*layerDef))
+
+  c.Specify("Later layers override earlier ones by name.", func() {
+    base.RegisterObjectsLayered("layers", []string{lower, upper}, ".json", "json")
+    c.Expect(getLayer("Plain Layer Test").Value, Equals, 1)
+    c.Expect(getLayer("Replaced Layer Test").Value, Equals, 2)
+    c.Expect(getLayer("Added Layer Test").Value, Equals, 2)
+    c.Expect(base.ObjectLayer("layers", "Plain Layer Test"), Equals, lower)
+    c.Expect(base.ObjectLayer("layers", "Replaced Layer Test"), Equals, upper)
+    c.Expect(base.ObjectLayer("layers", "Added Layer Test"), Equals, upper)
+    c.Expect(base.ObjectLayer("layers", "Not A Layer Test"), Equals, "")
+  })
+
+  c.Specify("Layers can override objects that weren't loaded in layers, and can be loaded again.", func() {
+    base.RegisterAllObjectsInDir("layers", lower, ".json", "json")
+    logged := len(base.Logged())
+    base.RegisterObjectsLayered("layers", []string{upper}, ".json", "json")
+    base.RegisterObjectsLayered("layers", []string{upper}, ".json", "json")
+    c.Expect(getLayer("Plain Layer Test").Value, Equals, 1)
+    c.Expect(getLayer("Replaced Layer Test").Value, Equals, 2)
+    c.Expect(base.ObjectLayer("layers", "Replaced Layer Test"), Equals, upper)
+    c.Expect(strings.Contains(base.Logged()[logged:], "ERROR"), Equals, false)
+  })
+}
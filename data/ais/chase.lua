@@ -0,0 +1,34 @@
+-- A reference entity ai that works for either side.  It walks towards the
+-- nearest enemy that it can see and attacks it with its first basic attack
+-- once it is adjacent.  Bind it to an entity with Script.BindAi(ent,
+-- "chase.lua"), the denizens.lua and intruders.lua side ais will run it.
+
+function enemyKind()
+  if Me.Side.Intruder then
+    return "denizen"
+  end
+  return "intruder"
+end
+
+function firstBasicAttack()
+  for name, action in pairs(Me.Actions) do
+    if action.Type == "Basic Attack" then
+      return name
+    end
+  end
+  return nil
+end
+
+function Think()
+  enemies = Utils.NearestNEntities(1, enemyKind())
+  target = enemies[1]
+  if target == nil then
+    return
+  end
+  ps = Utils.AllPathablePoints(Me.Pos, target.Pos, 1, 1)
+  Do.Move(ps, 1000)
+  attack = firstBasicAttack()
+  if attack and Utils.Exists(target) and Utils.RangedDistBetweenEntities(Me, target) <= 1 then
+    Do.BasicAttack(attack, target)
+  end
+end
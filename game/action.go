@@ -143,6 +143,13 @@ type Action interface {
   // been prepped.
   AP() int
 
+  // The amount of Ap that e would spend on this action right now.  Unlike
+  // AP() this can be called on actions that haven't been prepped, in which
+  // case it returns the least that the action could cost.  For actions
+  // whose cost depends on their target, such as moves, this is the cost for
+  // the current target while the action is prepped.
+  ApCost(e *Entity, g *Game) int
+
   // The name that will be displayed to the user to represent this Action.
   String() string
 
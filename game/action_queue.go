@@ -0,0 +1,109 @@
+package game
+
+import (
+  "github.com/runningwild/haunts/base"
+)
+
+// Adds exec to the end of its entity's queue.  Nothing in the queue is run
+// until CommitQueue is called for that entity.  The action stays on the floor
+// so that the player can see what has been planned.  Actions are prepped from
+// where the entity is standing now, so nothing can be queued after a move,
+// returns false if exec was not queued.
+func (g *Game) QueueAction(exec ActionExec) bool {
+  ent := g.EntityById(exec.EntityId())
+  if ent == nil {
+    base.Warn().Printf("Tried to queue an action for an entity that isn't in the game.")
+    return false
+  }
+  if !g.canQueue(ent) {
+    base.Warn().Printf("Tried to queue an action for %s after a move.", ent.Name)
+    return false
+  }
+  if g.queued == nil {
+    g.queued = make(map[*Entity][]ActionExec)
+  }
+  g.queued[ent] = append(g.queued[ent], exec)
+  g.viewer.AddFloorDrawable(ent.Actions[exec.ActionIndex()])
+  return true
+}
+
+// Returns true if nothing in ent's queue moves it.
+func (g *Game) canQueue(ent *Entity) bool {
+  for _, exec := range g.queued[ent] {
+    if len(exec.GetPath()) > 0 {
+      return false
+    }
+  }
+  return true
+}
+
+// Returns the number of actions waiting in ent's queue.
+func (g *Game) NumQueued(ent *Entity) int {
+  return len(g.queued[ent])
+}
+
+// Starts running ent's queue, one action at a time, in the order they were
+// queued.
+func (g *Game) CommitQueue(ent *Entity) {
+  if len(g.queued[ent]) == 0 {
+    return
+  }
+  g.running_queue = ent
+}
+
+// Throws away everything in ent's queue.  If the queue was running the action
+// in progress is still finished.
+func (g *Game) ClearQueue(ent *Entity) {
+  for _, exec := range g.queued[ent] {
+    action := ent.Actions[exec.ActionIndex()]
+    g.viewer.RemoveFloorDrawable(action)
+    if action != g.current_action {
+      action.Cancel()
+    }
+  }
+  delete(g.queued, ent)
+  if g.running_queue == ent {
+    g.running_queue = nil
+  }
+}
+
+// Stops prepping the current action and puts exec at the end of the queue
+// instead of running it.  If exec can't be queued the action stays prepped.
+func (g *Game) queueCurrentAction(exec ActionExec) {
+  if ent := g.EntityById(exec.EntityId()); ent != nil && !g.canQueue(ent) {
+    base.Warn().Printf("Tried to queue an action for %s after a move.", ent.Name)
+    return
+  }
+  g.viewer.RemoveFloorDrawable(g.current_action)
+  g.current_action = nil
+  g.Action_state = noAction
+  g.QueueAction(exec)
+}
+
+// Starts the next action in the running queue, if there is one.  This should
+// only be called when no action is in progress.  Returns true if an action
+// was started.
+func (g *Game) runQueue() bool {
+  ent := g.running_queue
+  if ent == nil {
+    return false
+  }
+  if len(g.queued[ent]) == 0 || ent.Stats == nil || ent.Stats.HpCur() <= 0 {
+    g.ClearQueue(ent)
+    return false
+  }
+  exec := g.queued[ent][0]
+  action := ent.Actions[exec.ActionIndex()]
+
+  // If an earlier action didn't go as planned this one might not make sense
+  // anymore, so the rest of the queue is dropped.
+  if !action.Preppable(ent, g) {
+    base.Log().Printf("Queued action %s for %s can't be run, clearing its queue.", action.String(), ent.Name)
+    g.ClearQueue(ent)
+    return false
+  }
+  g.queued[ent] = g.queued[ent][1:]
+  g.viewer.RemoveFloorDrawable(action)
+  g.current_exec = exec
+  return true
+}
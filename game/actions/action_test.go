@@ -9,6 +9,8 @@ import (
   "github.com/runningwild/haunts/base"
   "github.com/runningwild/haunts/game"
   "github.com/runningwild/haunts/game/actions"
+  "github.com/runningwild/haunts/game/status"
+  "github.com/runningwild/haunts/house"
 )
 
 var datadir string
@@ -26,6 +28,16 @@ func ActionSpec(c gospec.Context) {
     c.Expect(ok, Equals, true)
   })
 
+  c.Specify("Melee attacks can be readied as interrupts.", func() {
+    melee := game.MakeAction("Melee Test")
+    attack, ok := melee.(*actions.BasicAttack)
+    c.Assume(ok, Equals, true)
+    c.Expect(attack.Range, Equals, 1)
+    c.Expect(melee.Readyable(), Equals, true)
+    _, ok = melee.(game.InterruptAction)
+    c.Expect(ok, Equals, true)
+  })
+
   c.Specify("Actions can be gobbed without loss of type.", func() {
     buf := bytes.NewBuffer(nil)
     enc := gob.NewEncoder(buf)
@@ -50,3 +62,55 @@ func ActionSpec(c gospec.Context) {
 
   })
 }
+
+// Makes a headless game with a single room whose corner is at 1, 1.
+func makeTestGame() *game.Game {
+  house.LoadAllRoomsInDir(filepath.Join(datadir, "rooms"))
+  game.LoadAllEntities()
+  room := &house.Room{Defname: "Room Test", X: 1, Y: 1}
+  base.GetObject("rooms", room)
+  h := &house.HouseDef{Name: "Action Test"}
+  h.Floors = append(h.Floors, &house.Floor{Rooms: []*house.Room{room}})
+  return game.MakeHeadlessGame(h)
+}
+
+func RoundSpec(c gospec.Context) {
+  game.RegisterActions()
+  g := makeTestGame()
+
+  c.Specify("Entities with no hp left are removed at the end of the round.", func() {
+    ent, ok := g.SpawnEntity("Explorer Test", game.SideExplorers, 2, 2)
+    c.Assume(ok, Equals, true)
+    other, ok := g.SpawnEntity("Explorer Test", game.SideExplorers, 3, 2)
+    c.Assume(ok, Equals, true)
+    ent.Stats.ApplyDamage(0, -ent.Stats.HpCur(), status.Unspecified)
+    g.OnRound(false)
+    c.Expect(len(g.Ents), Equals, 1)
+    c.Expect(g.Ents[0] == other, Equals, true)
+    c.Expect(g.EntityById(ent.Id) == nil, Equals, true)
+  })
+}
+
+// A move that has already planned out a path.
+type plannedMove struct {
+  game.BasicActionExec
+}
+
+func (pm plannedMove) GetPath() []int {
+  return []int{1}
+}
+
+func QueueSpec(c gospec.Context) {
+  game.RegisterActions()
+  g := makeTestGame()
+
+  c.Specify("Nothing can be queued after a move.", func() {
+    ent, ok := g.SpawnEntity("Planner Test", game.SideExplorers, 2, 2)
+    c.Assume(ok, Equals, true)
+    c.Assume(len(ent.Actions), Equals, 2)
+    move := plannedMove{game.BasicActionExec{Ent: ent.Id, Index: 0}}
+    c.Expect(g.QueueAction(move), Equals, true)
+    c.Expect(g.QueueAction(game.BasicActionExec{Ent: ent.Id, Index: 1}), Equals, false)
+    c.Expect(g.NumQueued(ent), Equals, 1)
+  })
+}
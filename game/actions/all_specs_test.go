@@ -8,5 +8,7 @@ import (
 func TestAllSpecs(t *testing.T) {
   r := gospec.NewRunner()
   r.AddSpec(ActionSpec)
+  r.AddSpec(RoundSpec)
+  r.AddSpec(QueueSpec)
   gospec.MainGoTest(r, t)
 }
@@ -8,10 +8,9 @@ import (
   "github.com/runningwild/haunts/base"
   "github.com/runningwild/haunts/game"
   "github.com/runningwild/haunts/game/status"
-  "github.com/runningwild/haunts/house"
   "github.com/runningwild/haunts/texture"
-  "github.com/runningwild/opengl/gl"
   lua "github.com/xenith-studios/golua"
+  "image"
   "path/filepath"
 )
 
@@ -50,6 +49,10 @@ type AoeAttack struct {
   aoeAttackTempData
 
   Current_ammo int
+
+  // Selects the cells in the blast, only the cells that can be seen from the
+  // middle of the blast are hit.
+  area game.AreaTargeter
 }
 type AoeAttackDef struct {
   Name       string
@@ -62,6 +65,7 @@ type AoeAttackDef struct {
   Damage     int
   Animation  string
   Conditions []string
+  Cooldown   int // rounds, 0 = none
   Texture    texture.Object
   Sounds     map[string]string
 }
@@ -75,6 +79,9 @@ type aoeAttackTempData struct {
   // All entities in the blast radius - could include the acting entity
   targets []*game.Entity
 
+  // Cells within range that ent can see
+  reach map[[2]int]bool
+
   exec *aoeExec
 }
 type aoeExec struct {
@@ -131,11 +138,27 @@ func (a *AoeAttack) Push(L *lua.State) {
 func (a *AoeAttack) AP() int {
   return a.Ap
 }
+func (a *AoeAttack) ApCost(e *game.Entity, g *game.Game) int {
+  return a.Ap
+}
+// Covers both the blast and every cell the attack can reach.
+func (a *AoeAttack) bounds() image.Rectangle {
+  var blast image.Rectangle
+  for _, c := range a.area.Cells() {
+    blast = blast.Union(image.Rect(c[0], c[1], c[0]+1, c[1]+1))
+  }
+  if len(a.reach) == 0 {
+    return blast
+  }
+  return blast.Union(reachBounds(a.reach))
+}
 func (a *AoeAttack) Pos() (int, int) {
-  return a.tx, a.ty
+  r := a.bounds()
+  return r.Min.X, r.Min.Y
 }
 func (a *AoeAttack) Dims() (int, int) {
-  return a.Diameter, a.Diameter
+  r := a.bounds()
+  return r.Dx(), r.Dy()
 }
 func (a *AoeAttack) String() string {
   return a.Name
@@ -147,26 +170,35 @@ func (a *AoeAttack) Readyable() bool {
   return true
 }
 func (a *AoeAttack) Preppable(ent *game.Entity, g *game.Game) bool {
-  return a.Current_ammo != 0 && ent.Stats.ApCur() >= a.Ap
+  return a.Current_ammo != 0 && ent.Stats.ApCur() >= a.Ap && g.ActionCooldown(ent, a) == 0
+}
+func (a *AoeAttack) CooldownLength() int {
+  return a.Cooldown
 }
 func (a *AoeAttack) Prep(ent *game.Entity, g *game.Game) bool {
   if !a.Preppable(ent, g) {
     return false
   }
   a.ent = ent
+  ex, ey := ent.Pos()
+  a.reach = g.HighlightTargets([2]int{ex, ey}, a.Range, true)
   bx, by := g.GetViewer().WindowToBoard(gin.In().GetCursor("Mouse").Point())
   a.tx = int(bx)
   a.ty = int(by)
+  a.blast(g, a.tx, a.ty)
   return true
 }
 func (a *AoeAttack) HandleInput(group gui.EventGroup, g *game.Game) (bool, game.ActionExec) {
   cursor := group.Events[0].Key.Cursor()
   if cursor != nil && cursor.Name() == "Mouse" {
     bx, by := g.GetViewer().WindowToBoard(cursor.Point())
-    a.tx = int(bx)
-    a.ty = int(by)
+    if int(bx) != a.tx || int(by) != a.ty {
+      a.tx = int(bx)
+      a.ty = int(by)
+      a.blast(g, a.tx, a.ty)
+    }
   }
-  if found, event := group.FindEvent(gin.MouseLButton); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["place"].Id()); found && event.Type == gin.Press {
     ex, ey := a.ent.Pos()
     if dist(ex, ey, a.tx, a.ty) <= a.Range && a.ent.HasLos(a.tx, a.ty, 1, 1) {
       var exec aoeExec
@@ -184,23 +216,13 @@ func (a *AoeAttack) RenderOnFloor() {
   if a.ent == nil {
     return
   }
+  renderReach(a.reach)
   ex, ey := a.ent.Pos()
-  if dist(ex, ey, a.tx, a.ty) <= a.Range && a.ent.HasLos(a.tx, a.ty, 1, 1) {
-    gl.Color4ub(255, 255, 255, 200)
-  } else {
-    gl.Color4ub(255, 64, 64, 200)
-  }
-  base.EnableShader("box")
-  base.SetUniformF("box", "dx", float32(a.Diameter))
-  base.SetUniformF("box", "dy", float32(a.Diameter))
-  base.SetUniformI("box", "temp_invalid", 0)
-  x := a.tx - (a.Diameter+1)/2
-  y := a.ty - (a.Diameter+1)/2
-  (&texture.Object{}).Data().Render(float64(x), float64(y), float64(a.Diameter), float64(a.Diameter))
-  base.EnableShader("")
+  a.area.RenderOnFloor(dist(ex, ey, a.tx, a.ty) <= a.Range && a.ent.HasLos(a.tx, a.ty, 1, 1))
 }
 func (a *AoeAttack) Cancel() {
   a.aoeAttackTempData = aoeAttackTempData{}
+  a.area.Clear()
 }
 
 type AiAoeTarget int
@@ -277,53 +299,27 @@ func (a *AoeAttack) AiAttackPosition(ent *game.Entity, x, y int) game.ActionExec
   exec.X, exec.Y = x, y
   return &exec
 }
-
-// Used for doing los computation on aoe attacks, so we don't have to allocate
-// and deallocate lots of these.  Only one ai is ever running at a time so
-// this should be ok.
-var grid [4][][]bool
-
-func init() {
-  grid[0] = make([][]bool, house.LosTextureSize)
-  grid[1] = make([][]bool, house.LosTextureSize)
-  grid[2] = make([][]bool, house.LosTextureSize)
-  grid[3] = make([][]bool, house.LosTextureSize)
-  raw := make([]bool, 4*house.LosTextureSizeSquared)
-  stride := house.LosTextureSizeSquared
-  for i := 0; i < house.LosTextureSize; i++ {
-    grid[0][i] = raw[stride*0+i*house.LosTextureSize : stride*0+(i+1)*house.LosTextureSize]
-    grid[1][i] = raw[stride*1+i*house.LosTextureSize : stride*1+(i+1)*house.LosTextureSize]
-    grid[2][i] = raw[stride*2+i*house.LosTextureSize : stride*2+(i+1)*house.LosTextureSize]
-    grid[3][i] = raw[stride*3+i*house.LosTextureSize : stride*3+(i+1)*house.LosTextureSize]
+func (a *AoeAttack) InterruptExec(ent, target *game.Entity, g *game.Game) game.ActionExec {
+  if a.Current_ammo == 0 {
+    return nil
   }
+  x, y := target.Pos()
+  return a.AiAttackPosition(ent, x, y)
 }
 
-func (a *AoeAttack) getTargetsAt(g *game.Game, tx, ty int) []*game.Entity {
-  x := tx - (a.Diameter+1)/2
-  y := ty - (a.Diameter+1)/2
-  x2 := tx + a.Diameter/2
-  y2 := ty + a.Diameter/2
-
-  // If the diameter is even we need to run los from all four positions
-  // around the center of the aoe.
-  num_centers := 1
-  if a.Diameter%2 == 0 {
-    num_centers = 4
-  }
+// Selects the cells in a blast centered on tx, ty.  A square blast looks the
+// same wherever it comes from, so tx, ty is used as the origin as well.
+func (a *AoeAttack) blast(g *game.Game, tx, ty int) [][2]int {
+  a.area.Shape = game.AreaSquare
+  a.area.Length = a.Diameter
+  return a.area.Target(g, tx, ty, tx, ty)
+}
 
+func (a *AoeAttack) getTargetsAt(g *game.Game, tx, ty int) []*game.Entity {
+  a.blast(g, tx, ty)
   var targets []*game.Entity
-  for i := 0; i < num_centers; i++ {
-    // If num_centers is 4 then this will calculate the los for all four
-    // positions around the center
-    g.DetermineLos(tx+i%2, ty+i/2, a.Diameter, grid[i])
-  }
   for _, ent := range g.Ents {
-    entx, enty := ent.Pos()
-    has_los := false
-    for i := 0; i < num_centers; i++ {
-      has_los = has_los || grid[i][entx][enty]
-    }
-    if has_los && entx >= x && entx < x2 && enty >= y && enty < y2 {
+    if a.area.Hits(ent.Pos()) {
       targets = append(targets, ent)
     }
   }
@@ -379,7 +375,7 @@ func (a *AoeAttack) Maintain(dt int64, g *game.Game, ae game.ActionExec) game.Ma
       for _, name := range a.Conditions {
         target.Stats.ApplyCondition(status.MakeCondition(name))
       }
-      target.Stats.ApplyDamage(0, -a.Damage, a.Kind)
+      g.DealDamage(a.ent, target, a.Damage, a.Kind)
       if target.Stats.HpCur() <= 0 {
         target.Sprite().CommandN([]string{"defend", "killed"})
       } else {
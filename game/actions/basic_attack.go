@@ -65,6 +65,7 @@ type BasicAttackDef struct {
   Target_enemies bool
   Animation      string
   Conditions     []string
+  Cooldown       int // rounds, 0 = none
   Texture        texture.Object
   Sounds         map[string]string
 }
@@ -74,6 +75,9 @@ type basicAttackTempData struct {
   // Potential targets
   targets []*game.Entity
 
+  // Cells within range that ent can see
+  reach map[[2]int]bool
+
   // The selected target for the attack
   target *game.Entity
 
@@ -171,11 +175,16 @@ func dist(x, y, x2, y2 int) int {
 func (a *BasicAttack) AP() int {
   return a.Ap
 }
+func (a *BasicAttack) ApCost(e *game.Entity, g *game.Game) int {
+  return a.Ap
+}
 func (a *BasicAttack) Pos() (int, int) {
-  return 0, 0
+  r := reachBounds(a.reach)
+  return r.Min.X, r.Min.Y
 }
 func (a *BasicAttack) Dims() (int, int) {
-  return 0, 0
+  r := reachBounds(a.reach)
+  return r.Dx(), r.Dy()
 }
 func (a *BasicAttack) String() string {
   return a.Name
@@ -186,6 +195,20 @@ func (a *BasicAttack) Icon() *texture.Object {
 func (a *BasicAttack) Readyable() bool {
   return true
 }
+
+// Returns true if source can shoot at any of the cells in the given area.
+func hasLineOfFire(source *game.Entity, x, y, dx, dy int) bool {
+  sx, sy := source.Pos()
+  for i := x; i < x+dx; i++ {
+    for j := y; j < y+dy; j++ {
+      if source.Game().HasLineOfFire([2]int{sx, sy}, [2]int{i, j}) {
+        return true
+      }
+    }
+  }
+  return false
+}
+
 func (a *BasicAttack) validTarget(source, target *game.Entity) bool {
   if source.Stats == nil || target.Stats == nil {
     return false
@@ -193,9 +216,11 @@ func (a *BasicAttack) validTarget(source, target *game.Entity) bool {
   if distBetweenEnts(source, target) > a.Range {
     return false
   }
+  // Only what stops shots matters here, not what blocks los, so that a
+  // target behind something like a curtain can still be shot.
   x2, y2 := target.Pos()
   dx, dy := target.Dims()
-  if !source.HasLos(x2, y2, dx, dy) {
+  if !hasLineOfFire(source, x2, y2, dx, dy) {
     return false
   }
   if target.Stats.HpCur() <= 0 {
@@ -219,7 +244,10 @@ func (a *BasicAttack) findTargets(ent *game.Entity, g *game.Game) []*game.Entity
   return targets
 }
 func (a *BasicAttack) Preppable(ent *game.Entity, g *game.Game) bool {
-  return a.Current_ammo != 0 && ent.Stats.ApCur() >= a.Ap && len(a.findTargets(ent, g)) > 0
+  return a.Current_ammo != 0 && ent.Stats.ApCur() >= a.Ap && len(a.findTargets(ent, g)) > 0 && g.ActionCooldown(ent, a) == 0
+}
+func (a *BasicAttack) CooldownLength() int {
+  return a.Cooldown
 }
 func (a *BasicAttack) Prep(ent *game.Entity, g *game.Game) bool {
   if !a.Preppable(ent, g) {
@@ -227,6 +255,8 @@ func (a *BasicAttack) Prep(ent *game.Entity, g *game.Game) bool {
   }
   a.ent = ent
   a.targets = a.findTargets(ent, g)
+  x, y := ent.Pos()
+  a.reach = g.HighlightTargets([2]int{x, y}, a.Range, true)
   return true
 }
 func (a *BasicAttack) AiAttackTarget(ent *game.Entity, target *game.Entity) game.ActionExec {
@@ -235,6 +265,12 @@ func (a *BasicAttack) AiAttackTarget(ent *game.Entity, target *game.Entity) game
   }
   return a.makeExec(ent, target)
 }
+func (a *BasicAttack) InterruptExec(ent, target *game.Entity, g *game.Game) game.ActionExec {
+  if a.Current_ammo == 0 || ent.Stats.ApCur() < a.Ap {
+    return nil
+  }
+  return a.AiAttackTarget(ent, target)
+}
 func (a *BasicAttack) makeExec(ent, target *game.Entity) *basicAttackExec {
   var exec basicAttackExec
   exec.id = exec_id
@@ -245,7 +281,7 @@ func (a *BasicAttack) makeExec(ent, target *game.Entity) *basicAttackExec {
 }
 func (a *BasicAttack) HandleInput(group gui.EventGroup, g *game.Game) (bool, game.ActionExec) {
   target := g.HoveredEnt()
-  if found, event := group.FindEvent(gin.MouseLButton); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["place"].Id()); found && event.Type == gin.Press {
     if target == nil || !a.validTarget(a.ent, target) {
       return true, nil
     }
@@ -254,7 +290,7 @@ func (a *BasicAttack) HandleInput(group gui.EventGroup, g *game.Game) (bool, gam
   return false, nil
 }
 func (a *BasicAttack) RenderOnFloor() {
-  gl.Disable(gl.TEXTURE_2D)
+  renderReach(a.reach)
   gl.Begin(gl.QUADS)
   gl.Color4d(1.0, 0.2, 0.2, 0.8)
   for _, ent := range a.targets {
@@ -302,11 +338,14 @@ func (a *BasicAttack) Maintain(dt int64, g *game.Game, ae game.ActionExec) game.
     }
     a.ent.Stats.ApplyDamage(-a.Ap, 0, status.Unspecified)
     var defender_cmds []string
-    if g.DoAttack(a.ent, a.target, a.Strength, a.Kind) {
+    sx, sy := a.ent.Pos()
+    tx, ty := a.target.Pos()
+    strength := a.Strength - g.CoverBonus([2]int{sx, sy}, [2]int{tx, ty})
+    if g.DoAttack(a.ent, a.target, strength, a.Kind) {
       for _, name := range a.Conditions {
         a.target.Stats.ApplyCondition(status.MakeCondition(name))
       }
-      a.target.Stats.ApplyDamage(0, -a.Damage, a.Kind)
+      g.DealDamage(a.ent, a.target, a.Damage, a.Kind)
       if a.target.Stats.HpCur() <= 0 {
         defender_cmds = []string{"defend", "killed"}
       } else {
@@ -136,6 +136,9 @@ func (a *Interact) Push(L *lua.State) {
 func (a *Interact) AP() int {
   return a.Ap
 }
+func (a *Interact) ApCost(e *game.Entity, g *game.Game) int {
+  return a.Ap
+}
 func (a *Interact) Pos() (int, int) {
   return 0, 0
 }
@@ -264,6 +267,9 @@ func (a *Interact) AiToggleDoor(ent *game.Entity, door *house.Door) game.ActionE
   if door.AlwaysOpen() {
     return nil
   }
+  if door.Locked && !door.CanUnlock(ent.KeyNames()) {
+    return nil
+  }
   for fi, f := range ent.Game().House.Floors {
     for ri, r := range f.Rooms {
       for di, d := range r.Doors {
@@ -278,7 +284,7 @@ func (a *Interact) AiToggleDoor(ent *game.Entity, door *house.Door) game.ActionE
 
 func (a *Interact) findDoors(ent *game.Entity, g *game.Game) []*house.Door {
   room_num := ent.CurrentRoom()
-  room := g.House.Floors[0].Rooms[room_num]
+  room := g.CurrentFloor().Rooms[room_num]
   x, y := ent.Pos()
   dx, dy := ent.Dims()
   ent_rect := makeIntFrect(x, y, x+dx, y+dy)
@@ -287,6 +293,9 @@ func (a *Interact) findDoors(ent *game.Entity, g *game.Game) []*house.Door {
     if door.AlwaysOpen() {
       continue
     }
+    if door.Locked && !door.CanUnlock(ent.KeyNames()) {
+      continue
+    }
     if ent_rect.Overlaps(makeRectForDoor(room, door)) {
       valid = append(valid, door)
     }
@@ -336,9 +345,9 @@ func (a *Interact) Preppable(ent *game.Entity, g *game.Game) bool {
 func (a *Interact) Prep(ent *game.Entity, g *game.Game) bool {
   if a.Preppable(ent, g) {
     a.ent = ent
-    room := g.House.Floors[0].Rooms[ent.CurrentRoom()]
+    room := g.CurrentFloor().Rooms[ent.CurrentRoom()]
     for _, door := range a.doors {
-      _, other_door := g.House.Floors[0].FindMatchingDoor(room, door)
+      _, other_door := g.CurrentFloor().FindMatchingDoor(room, door)
       if other_door != nil {
         door.HighlightThreshold(true)
         other_door.HighlightThreshold(true)
@@ -349,11 +358,14 @@ func (a *Interact) Prep(ent *game.Entity, g *game.Game) bool {
   return false
 }
 func (a *Interact) HandleInput(group gui.EventGroup, g *game.Game) (bool, game.ActionExec) {
-  if found, event := group.FindEvent(gin.MouseLButton); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["place"].Id()); found && event.Type == gin.Press {
     bx, by := g.GetViewer().WindowToBoard(gin.In().GetCursor("Mouse").Point())
     room_num := a.ent.CurrentRoom()
-    room := g.House.Floors[0].Rooms[room_num]
+    room := g.CurrentFloor().Rooms[room_num]
     for door_num, door := range room.Doors {
+      if door.Locked && !door.CanUnlock(a.ent.KeyNames()) {
+        continue
+      }
       rect := makeRectForDoor(room, door)
       if rect.Contains(float64(bx), float64(by)) {
         var exec interactExec
@@ -369,7 +381,7 @@ func (a *Interact) HandleInput(group gui.EventGroup, g *game.Game) (bool, game.A
   if target == nil {
     return false, nil
   }
-  if found, event := group.FindEvent(gin.MouseLButton); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["place"].Id()); found && event.Type == gin.Press {
     for i := range a.targets {
       if a.targets[i] == target && distBetweenEnts(a.ent, target) <= a.Range {
         var exec interactExec
@@ -385,9 +397,9 @@ func (a *Interact) HandleInput(group gui.EventGroup, g *game.Game) (bool, game.A
 func (a *Interact) RenderOnFloor() {
 }
 func (a *Interact) Cancel() {
-  room := a.ent.Game().House.Floors[0].Rooms[a.ent.CurrentRoom()]
+  room := a.ent.Game().CurrentFloor().Rooms[a.ent.CurrentRoom()]
   for _, door := range a.doors {
-    _, other_door := a.ent.Game().House.Floors[0].FindMatchingDoor(room, door)
+    _, other_door := a.ent.Game().CurrentFloor().FindMatchingDoor(room, door)
     if other_door != nil {
       door.HighlightThreshold(false)
       other_door.HighlightThreshold(false)
@@ -459,16 +471,30 @@ func (a *Interact) Maintain(dt int64, g *game.Game, ae game.ActionExec) game.Mai
         return game.Complete
       }
 
+      if door.Locked && !door.CanUnlock(a.ent.KeyNames()) {
+        base.Error().Printf("Tried to open a locked door without its key: %v", exec)
+        return game.Complete
+      }
+
       _, other_door := floor.FindMatchingDoor(room, door)
       if other_door != nil {
-        door.SetOpened(!door.IsOpened())
-        other_door.SetOpened(door.IsOpened())
+        // Unlocking a door opens it as part of the same interaction
+        door.Locked = false
+        other_door.Locked = false
+        if door.Opened {
+          door.Close()
+          other_door.Close()
+        } else {
+          door.Open()
+          other_door.Open()
+        }
+        g.Notify(game.Event{Kind: game.EventDoorChanged, Room: room, Door: door})
         // if door.IsOpened() {
         //   sound.PlaySound(door.Open_sound)
         // } else {
         //   sound.PlaySound(door.Shut_sound)
         // }
-        g.RecalcLos()
+        g.InvalidateLosNearDoor(room, door)
         a.ent.Stats.ApplyDamage(-a.Ap, 0, status.Unspecified)
       } else {
         base.Error().Printf("Couldn't find matching door: %v", exec)
@@ -0,0 +1,232 @@
+package actions
+
+import (
+  "encoding/gob"
+  "github.com/runningwild/glop/gin"
+  "github.com/runningwild/glop/gui"
+  "github.com/runningwild/haunts/base"
+  "github.com/runningwild/haunts/game"
+  "github.com/runningwild/haunts/game/status"
+  "github.com/runningwild/haunts/texture"
+  "github.com/runningwild/opengl/gl"
+  lua "github.com/xenith-studios/golua"
+  "path/filepath"
+)
+
+func registerItemActions() map[string]func() game.Action {
+  item_actions := make(map[string]*ItemActionDef)
+  base.RemoveRegistry("actions-item_actions")
+  base.RegisterRegistry("actions-item_actions", item_actions)
+  base.RegisterAllObjectsInDir("actions-item_actions", filepath.Join(base.GetDataDir(), "actions", "items"), ".json", "json")
+  makers := make(map[string]func() game.Action)
+  for name := range item_actions {
+    cname := name
+    makers[cname] = func() game.Action {
+      a := ItemAction{Defname: cname}
+      base.GetObject("actions-item_actions", &a)
+      return &a
+    }
+  }
+  return makers
+}
+
+func init() {
+  game.RegisterActionMakers(registerItemActions)
+  gob.Register(&ItemAction{})
+  gob.Register(&itemExec{})
+}
+
+// Item actions either pick up an item in the entity's cell, or drop the last
+// item the entity picked up.  The entity's own cell is the only target.
+type ItemAction struct {
+  Defname string
+  *ItemActionDef
+  itemActionTempData
+}
+type ItemActionDef struct {
+  Name string
+
+  // If true this action drops an item, otherwise it picks one up.
+  Drop bool
+
+  Ap      int
+  Texture texture.Object
+}
+type itemActionTempData struct {
+  ent *game.Entity
+}
+type itemExec struct {
+  game.BasicActionExec
+
+  // Index into Game.Items of the item to pick up, or into the entity's
+  // Inventory of the item to drop.
+  Item int
+}
+
+func (exec itemExec) Push(L *lua.State, g *game.Game) {
+  exec.BasicActionExec.Push(L, g)
+  if L.IsNil(-1) {
+    return
+  }
+  ent := g.EntityById(exec.Ent)
+  action := ent.Actions[exec.Index].(*ItemAction)
+  L.PushString("Item")
+  if item := action.getItem(ent, g, exec.Item); item != nil {
+    L.PushString(item.Name)
+  } else {
+    L.PushNil()
+  }
+  L.SetTable(-3)
+}
+
+// Returns the item that an exec refers to, or nil if there isn't one.
+func (a *ItemAction) getItem(ent *game.Entity, g *game.Game, index int) *game.Item {
+  items := g.Items
+  if a.Drop {
+    items = ent.Inventory
+  }
+  if index < 0 || index >= len(items) {
+    return nil
+  }
+  return items[index]
+}
+
+// Returns the index of the item that ent would pick up or drop right now, or
+// -1 if there isn't one.
+func (a *ItemAction) targetIndex(ent *game.Entity, g *game.Game) int {
+  if a.Drop {
+    return len(ent.Inventory) - 1
+  }
+  x, y := ent.Pos()
+  for i := len(g.Items) - 1; i >= 0; i-- {
+    if ix, iy := g.Items[i].Pos(); ix == x && iy == y {
+      return i
+    }
+  }
+  return -1
+}
+
+func (a *ItemAction) SoundMap() map[string]string {
+  return nil
+}
+
+func (a *ItemAction) Push(L *lua.State) {
+  L.NewTable()
+  L.PushString("Type")
+  L.PushString("Item")
+  L.SetTable(-3)
+  L.PushString("Name")
+  L.PushString(a.Name)
+  L.SetTable(-3)
+  L.PushString("Drop")
+  L.PushBoolean(a.Drop)
+  L.SetTable(-3)
+  L.PushString("Ap")
+  L.PushInteger(a.Ap)
+  L.SetTable(-3)
+}
+
+func (a *ItemAction) AP() int {
+  return a.Ap
+}
+func (a *ItemAction) ApCost(e *game.Entity, g *game.Game) int {
+  return a.Ap
+}
+func (a *ItemAction) Pos() (int, int) {
+  if a.ent == nil {
+    return 0, 0
+  }
+  return a.ent.Pos()
+}
+func (a *ItemAction) Dims() (int, int) {
+  return 1, 1
+}
+func (a *ItemAction) String() string {
+  return a.Name
+}
+func (a *ItemAction) Icon() *texture.Object {
+  return &a.Texture
+}
+func (a *ItemAction) Readyable() bool {
+  return false
+}
+func (a *ItemAction) Preppable(ent *game.Entity, g *game.Game) bool {
+  return ent.Stats.ApCur() >= a.Ap && a.targetIndex(ent, g) != -1
+}
+func (a *ItemAction) Prep(ent *game.Entity, g *game.Game) bool {
+  if !a.Preppable(ent, g) {
+    return false
+  }
+  a.ent = ent
+  return true
+}
+func (a *ItemAction) HandleInput(group gui.EventGroup, g *game.Game) (bool, game.ActionExec) {
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["place"].Id()); found && event.Type == gin.Press {
+    bx, by := g.GetViewer().WindowToBoard(gin.In().GetCursor("Mouse").Point())
+    x, y := a.ent.Pos()
+    if int(bx) != x || int(by) != y || bx < 0 || by < 0 {
+      return true, nil
+    }
+    index := a.targetIndex(a.ent, g)
+    if index == -1 {
+      return true, nil
+    }
+    var exec itemExec
+    exec.SetBasicData(a.ent, a)
+    exec.Item = index
+    return true, &exec
+  }
+  return false, nil
+}
+func (a *ItemAction) RenderOnFloor() {
+  if a.ent == nil {
+    return
+  }
+  x, y := a.ent.Pos()
+  gl.Color4ub(255, 255, 255, 200)
+  base.EnableShader("box")
+  base.SetUniformF("box", "dx", 1)
+  base.SetUniformF("box", "dy", 1)
+  base.SetUniformI("box", "temp_invalid", 0)
+  (&texture.Object{}).Data().Render(float64(x), float64(y), 1, 1)
+  base.EnableShader("")
+}
+func (a *ItemAction) Cancel() {
+  a.itemActionTempData = itemActionTempData{}
+}
+func (a *ItemAction) Maintain(dt int64, g *game.Game, ae game.ActionExec) game.MaintenanceStatus {
+  if ae == nil {
+    return game.Complete
+  }
+  exec := ae.(*itemExec)
+  ent := g.EntityById(exec.Ent)
+  if ent == nil {
+    base.Error().Printf("Got an item action without a valid entity.")
+    return game.Complete
+  }
+  a.ent = ent
+  item := a.getItem(ent, g, exec.Item)
+  if item == nil {
+    base.Error().Printf("Got an item action for an item that doesn't exist: %v", exec)
+    return game.Complete
+  }
+  if ent.Stats.ApCur() < a.Ap {
+    base.Error().Printf("Got an item action that required more ap than available: %v", exec)
+    return game.Complete
+  }
+  if a.Drop {
+    g.DropItem(ent, item)
+  } else {
+    x, y := ent.Pos()
+    if ix, iy := item.Pos(); ix != x || iy != y {
+      base.Error().Printf("Tried to pick up an item that wasn't in the same cell: %v", exec)
+      return game.Complete
+    }
+    g.PickUpItem(ent, item)
+  }
+  ent.Stats.ApplyDamage(-a.Ap, 0, status.Unspecified)
+  return game.Complete
+}
+func (a *ItemAction) Interrupt() bool {
+  return true
+}
@@ -2,6 +2,7 @@ package actions
 
 import (
   "encoding/gob"
+  "fmt"
   gl "github.com/chsc/gogl/gl21"
   "github.com/runningwild/glop/gin"
   "github.com/runningwild/glop/gui"
@@ -59,8 +60,16 @@ type Move struct {
   path [][2]int
   cost int
 
+  // Total cost to reach each cell in path
+  costs []int
+
   // Ap remaining before the ability was used
   threshold int
+
+  // Where the entity was and how much ap was spent when the current walk
+  // started, so that it can be undone if the move is cancelled.
+  walking bool
+  start   [2]int
 }
 type MoveDef struct {
   Name    string
@@ -141,6 +150,13 @@ func (a *Move) Push(L *lua.State) {
 func (a *Move) AP() int {
   return a.cost
 }
+func (a *Move) ApCost(e *game.Entity, g *game.Game) int {
+  if a.ent == e && a.path != nil {
+    return a.cost
+  }
+  // A single step is the least that a move can cost
+  return 1
+}
 func (a *Move) Pos() (int, int) {
   return 0, 0
 }
@@ -210,15 +226,10 @@ func (a *Move) AiMoveToPos(ent *game.Entity, dst []int, max_ap int) game.ActionE
 }
 
 func (a *Move) drawPath(ent *game.Entity, g *game.Game, graph algorithm.Graph, src int) {
-  if path_tex != nil {
-    pix := path_tex.Pix()
-    for i := range pix {
-      for j := range pix[i] {
-        pix[i][j] = 0
-      }
-    }
-    current := 0.0
-    for i := 1; i < len(a.path); i++ {
+  a.costs = a.costs[0:0]
+  current := 0.0
+  for i := range a.path {
+    if i > 0 {
       src := g.ToVertex(a.path[i-1][0], a.path[i-1][1])
       dst := g.ToVertex(a.path[i][0], a.path[i][1])
       v, cost := graph.Adjacent(src)
@@ -228,7 +239,18 @@ func (a *Move) drawPath(ent *game.Entity, g *game.Game, graph algorithm.Graph, s
           break
         }
       }
-      pix[a.path[i][1]][a.path[i][0]] += byte(current)
+    }
+    a.costs = append(a.costs, int(current))
+  }
+  if path_tex != nil {
+    pix := path_tex.Pix()
+    for i := range pix {
+      for j := range pix[i] {
+        pix[i][j] = 0
+      }
+    }
+    for i := 1; i < len(a.path); i++ {
+      pix[a.path[i][1]][a.path[i][0]] += byte(a.costs[i])
     }
     path_tex.Remap()
   }
@@ -240,17 +262,14 @@ func (a *Move) findPath(ent *game.Entity, x, y int) {
   if dst != a.dst || !a.calculated {
     a.dst = dst
     a.calculated = true
-    src := g.ToVertex(a.ent.Pos())
-    graph := g.Graph(ent.Side(), true, nil)
-    cost, path := algorithm.Dijkstra(graph, []int{src}, []int{dst})
-    if len(path) <= 1 {
+    cost, path := g.FindPath(ent, x, y, nil)
+    if path == nil {
       return
     }
-    a.path = algorithm.Map(path, [][2]int{}, func(a interface{}) interface{} {
-      _, x, y := g.FromVertex(a.(int))
-      return [2]int{int(x), int(y)}
-    }).([][2]int)
-    a.cost = int(cost)
+    a.path = path
+    a.cost = cost
+    src := g.ToVertex(a.ent.Pos())
+    graph := g.Graph(ent.Side(), true, nil)
     a.drawPath(ent, g, graph, src)
   }
 }
@@ -271,7 +290,7 @@ func (a *Move) HandleInput(group gui.EventGroup, g *game.Game) (bool, game.Actio
     fx, fy := g.GetViewer().WindowToBoard(cursor.Point())
     a.findPath(a.ent, int(fx), int(fy))
   }
-  if found, _ := group.FindEvent(gin.MouseLButton); found {
+  if found, _ := group.FindEvent(base.GetDefaultKeyMap()["place"].Id()); found {
     if len(a.path) > 0 {
       if a.cost <= a.ent.Stats.ApCur() {
         var exec moveExec
@@ -303,10 +322,60 @@ func (a *Move) RenderOnFloor() {
   base.SetUniformF("path", "size", house.LosTextureSize)
   texture.RenderAdvanced(0, 0, house.LosTextureSize, house.LosTextureSize, 3.1415926535, false)
   base.EnableShader("")
+
+  // Once the entity starts walking the path is consumed as it goes, so only
+  // the preview is drawn.
+  if a.walking || len(a.path) < 2 || len(a.costs) != len(a.path) {
+    return
+  }
+  gl.Disable(gl.TEXTURE_2D)
+  gl.LineWidth(3)
+  gl.Begin(gl.LINES)
+  for i := 1; i < len(a.path); i++ {
+    if a.costs[i] > a.threshold {
+      gl.Color4ub(255, 0, 0, 200)
+    } else {
+      gl.Color4ub(0, 255, 0, 200)
+    }
+    gl.Vertex2f(float32(a.path[i-1][0])+0.5, float32(a.path[i-1][1])+0.5)
+    gl.Vertex2f(float32(a.path[i][0])+0.5, float32(a.path[i][1])+0.5)
+  }
+  gl.End()
+  gl.LineWidth(1)
+  gl.Enable(gl.TEXTURE_2D)
 }
+
+// Labels the end of the path with how much ap it will cost, in red if the
+// entity can't afford it.
+func (a *Move) RenderOverlay(viewer *house.HouseViewer) {
+  if a.ent == nil || a.walking || len(a.path) < 2 {
+    return
+  }
+  last := a.path[len(a.path)-1]
+  x, y := viewer.BoardToWindow(float32(last[0])+0.5, float32(last[1])+0.5)
+  if a.cost > a.threshold {
+    gl.Color4ub(255, 0, 0, 255)
+  } else {
+    gl.Color4ub(255, 255, 255, 255)
+  }
+  d := base.GetDictionary(15)
+  d.RenderString(fmt.Sprintf("%d", a.cost), float64(x), float64(y), 0, d.MaxHeight(), gui.Center)
+}
+
+// If the move has already started the entity is returned to where it
+// started and refunded the ap it spent.
 func (a *Move) Cancel() {
+  if a.walking && a.ent != nil && a.ent.Stats.HpCur() > 0 {
+    a.ent.SetPos(a.start[0], a.start[1])
+    a.ent.Stats.ApplyDamage(a.cost, 0, status.Unspecified)
+    if a.ent.Sprite() != nil {
+      a.ent.Sprite().Command("stop")
+    }
+  }
+  a.walking = false
   a.ent = nil
   a.path = nil
+  a.costs = nil
   a.calculated = false
 }
 func (a *Move) Maintain(dt int64, g *game.Game, ae game.ActionExec) game.MaintenanceStatus {
@@ -341,24 +410,35 @@ func (a *Move) Maintain(dt int64, g *game.Game, ae game.ActionExec) game.Mainten
     })
     base.Log().Printf("Path Validated: %v", exec)
     a.ent.Stats.ApplyDamage(-a.cost, 0, status.Unspecified)
+    a.walking = true
+    a.start[0], a.start[1] = a.ent.Pos()
     src := g.ToVertex(a.ent.Pos())
     graph := g.Graph(a.ent.Side(), true, nil)
     a.drawPath(a.ent, g, graph, src)
   }
-  // Do stuff
-  factor := float32(math.Pow(2, a.ent.Walking_speed))
-  dist := a.ent.DoAdvance(factor*float32(dt)/200, a.path[0][0], a.path[0][1])
-  for dist > 0 {
-    if len(a.path) == 1 {
-      a.ent.DoAdvance(0, 0, 0)
-      a.ent.Info.RoomsExplored[a.ent.CurrentRoom()] = true
-      a.ent = nil
-      return game.Complete
-    }
+  if a.ent.IsAnimating() {
+    return game.InProgress
+  }
+  x, y := a.ent.Pos()
+  if len(a.path) > 0 && a.path[0][0] == x && a.path[0][1] == y {
     a.path = a.path[1:]
     a.ent.Info.RoomsExplored[a.ent.CurrentRoom()] = true
-    dist = a.ent.DoAdvance(dist, a.path[0][0], a.path[0][1])
+    if len(a.path) > 0 {
+      // Every cell that we step into gives the enemy a chance to interrupt
+      return game.CheckForInterrupts
+    }
+  }
+  if len(a.path) == 0 {
+    if a.ent.Sprite() != nil {
+      a.ent.Sprite().Command("stop")
+    }
+    a.walking = false
+    a.ent = nil
+    return game.Complete
   }
+  // Each cell takes 200ms to cross at a Walking_speed of 0
+  duration := int64(200 / math.Pow(2, a.ent.Walking_speed))
+  a.ent.AnimateMove(a.path[0][0], a.path[0][1], duration)
   return game.InProgress
 }
 func (a *Move) Interrupt() bool {
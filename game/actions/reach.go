@@ -0,0 +1,32 @@
+package actions
+
+import (
+  "github.com/runningwild/haunts/house"
+  "github.com/runningwild/opengl/gl"
+  "image"
+)
+
+// Returns the smallest rectangle that contains every cell in reach.
+func reachBounds(reach map[[2]int]bool) image.Rectangle {
+  var r image.Rectangle
+  for cell := range reach {
+    r = r.Union(image.Rect(cell[0], cell[1], cell[0]+1, cell[1]+1))
+  }
+  return r
+}
+
+// Tints every cell in reach, so players can see what an action can target
+// before they pick something.
+func renderReach(reach map[[2]int]bool) {
+  gl.Disable(gl.TEXTURE_2D)
+  gl.Color4ub(house.CurrentPalette().Reach.RGBA())
+  gl.Begin(gl.QUADS)
+  for cell := range reach {
+    x, y := cell[0], cell[1]
+    gl.Vertex2i(x, y)
+    gl.Vertex2i(x, y+1)
+    gl.Vertex2i(x+1, y+1)
+    gl.Vertex2i(x+1, y)
+  }
+  gl.End()
+}
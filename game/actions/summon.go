@@ -59,13 +59,13 @@ type SummonActionDef struct {
   Ent_name     string
   Animation    string
   Conditions   []string
+  Cooldown     int // rounds, 0 = none
   Texture      texture.Object
   Sounds       map[string]string
 }
 type summonActionTempData struct {
   ent    *game.Entity
   cx, cy int
-  spawn  *game.Entity
 }
 type summonExec struct {
   game.BasicActionExec
@@ -120,6 +120,9 @@ func (a *SummonAction) Push(L *lua.State) {
 func (a *SummonAction) AP() int {
   return a.Ap
 }
+func (a *SummonAction) ApCost(e *game.Entity, g *game.Game) int {
+  return a.Ap
+}
 func (a *SummonAction) Pos() (int, int) {
   return a.cx, a.cy
 }
@@ -136,7 +139,10 @@ func (a *SummonAction) Readyable() bool {
   return false
 }
 func (a *SummonAction) Preppable(ent *game.Entity, g *game.Game) bool {
-  return a.Current_ammo != 0 && ent.Stats.ApCur() >= a.Ap
+  return a.Current_ammo != 0 && ent.Stats.ApCur() >= a.Ap && g.ActionCooldown(ent, a) == 0
+}
+func (a *SummonAction) CooldownLength() int {
+  return a.Cooldown
 }
 func (a *SummonAction) Prep(ent *game.Entity, g *game.Game) bool {
   if !a.Preppable(ent, g) {
@@ -161,7 +167,7 @@ func (a *SummonAction) HandleInput(group gui.EventGroup, g *game.Game) (bool, ga
     a.cy = int(by)
   }
 
-  if found, event := group.FindEvent(gin.MouseLButton); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["place"].Id()); found && event.Type == gin.Press {
     if g.IsCellOccupied(a.cx, a.cy) {
       return true, nil
     }
@@ -209,7 +215,6 @@ func (a *SummonAction) Maintain(dt int64, g *game.Game, ae game.ActionExec) game
     a.ent = ent
     _, a.cx, a.cy = a.ent.Game().FromVertex(exec.Pos)
     a.ent.Stats.ApplyDamage(-a.Ap, 0, status.Unspecified)
-    a.spawn = game.MakeEntity(a.Ent_name, a.ent.Game())
     if a.Current_ammo > 0 {
       a.Current_ammo--
     }
@@ -217,8 +222,10 @@ func (a *SummonAction) Maintain(dt int64, g *game.Game, ae game.ActionExec) game
   if a.ent.Sprite().State() == "ready" {
     a.ent.TurnToFace(a.cx, a.cy)
     a.ent.Sprite().Command(a.Animation)
-    a.spawn.Stats.OnBegin()
-    a.ent.Game().SpawnEntity(a.spawn, a.cx, a.cy)
+    spawn, ok := a.ent.Game().SpawnEntity(a.Ent_name, game.SideNone, a.cx, a.cy)
+    if ok && spawn.Stats != nil {
+      spawn.Stats.OnBegin()
+    }
     return game.Complete
   }
   return game.InProgress
@@ -644,7 +644,7 @@ func NearbyUnexploredRoomsFunc(a *Ai) lua.GoFunction {
     g := me.Game()
     graph := g.RoomGraph()
     var unexplored []int
-    for room_num, _ := range g.House.Floors[0].Rooms {
+    for room_num, _ := range g.CurrentFloor().Rooms {
       if !me.Info.RoomsExplored[room_num] {
         adj, _ := graph.Adjacent(room_num)
         for i := range adj {
@@ -658,7 +658,7 @@ func NearbyUnexploredRoomsFunc(a *Ai) lua.GoFunction {
     L.NewTable()
     for i := range unexplored {
       L.PushInteger(i + 1)
-      game.LuaPushRoom(L, a.game, a.game.House.Floors[0].Rooms[unexplored[i]])
+      game.LuaPushRoom(L, a.game, a.game.CurrentFloor().Rooms[unexplored[i]])
       L.SetTable(-3)
     }
     return 1
@@ -728,7 +728,7 @@ func RoomPathFunc(a *Ai) lua.GoFunction {
         continue
       } // Skip this one because we're in it already
       L.PushInteger(i)
-      game.LuaPushRoom(L, g, g.House.Floors[0].Rooms[v])
+      game.LuaPushRoom(L, g, g.CurrentFloor().Rooms[v])
       L.SetTable(-3)
     }
     return 1
@@ -759,7 +759,7 @@ func RoomContainingFunc(a *Ai) lua.GoFunction {
     if ent == nil || (ent.Side() != side && !a.ent.Game().TeamLos(side, x, y, dx, dy)) {
       L.PushNil()
     } else {
-      game.LuaPushRoom(L, ent.Game(), ent.Game().House.Floors[0].Rooms[ent.CurrentRoom()])
+      game.LuaPushRoom(L, ent.Game(), ent.Game().CurrentFloor().Rooms[ent.CurrentRoom()])
     }
     return 1
   }
@@ -811,7 +811,7 @@ func AllDoorsBetween(a *Ai) lua.GoFunction {
     count := 1
     for _, door1 := range room1.Doors {
       for _, door2 := range room2.Doors {
-        _, d := a.ent.Game().House.Floors[0].FindMatchingDoor(room1, door1)
+        _, d := a.ent.Game().CurrentFloor().FindMatchingDoor(room1, door1)
         if d == door2 {
           L.PushInteger(count)
           count++
@@ -0,0 +1,19 @@
+package game_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  "testing"
+)
+
+func TestAllSpecs(t *testing.T) {
+  r := gospec.NewRunner()
+  r.AddSpec(FloorSpec)
+  r.AddSpec(LosSpec)
+  r.AddSpec(RandSpec)
+  r.AddSpec(EventsSpec)
+  r.AddSpec(TriggerSpec)
+  r.AddSpec(VictorySpec)
+  r.AddSpec(SaveSpec)
+  r.AddSpec(AreaSpec)
+  gospec.MainGoTest(r, t)
+}
@@ -0,0 +1,206 @@
+package game
+
+import (
+  gl "github.com/chsc/gogl/gl21"
+  "github.com/runningwild/haunts/house"
+  "math"
+)
+
+type AreaShape int
+
+const (
+  // All cells within Length of the target.
+  AreaCircle AreaShape = iota
+
+  // All cells within Length of the origin that are within Angle/2 degrees
+  // of the line from the origin to the target.
+  AreaCone
+
+  // All cells along the line from the origin towards the target, up to
+  // Length cells away.
+  AreaLine
+
+  // A square Length cells on a side around the target.  If Length is even
+  // the target is the lower-left of the four cells in the middle.
+  AreaSquare
+)
+
+// Selects a group of cells around a target so that actions can affect more
+// than one cell at a time.  Cells are only selected if they can be seen from
+// the center of the effect, so an area never extends through walls.  For
+// circles and squares the center is the target, for cones and lines it is
+// the origin.  A square with an even Length has four cells in the middle, a
+// cell only needs to be seen from one of them.
+type AreaTargeter struct {
+  Shape  AreaShape
+  Length int
+
+  // Width of a cone, in degrees
+  Angle float64
+
+  cells [][2]int
+  grid  [][]bool
+
+  // Cells that are in cells, so that Hits doesn't have to search it.
+  hit [][]bool
+}
+
+func makeGrid() [][]bool {
+  raw := make([]bool, house.LosTextureSizeSquared)
+  grid := make([][]bool, house.LosTextureSize)
+  for i := range grid {
+    grid[i] = raw[i*house.LosTextureSize : (i+1)*house.LosTextureSize]
+  }
+  return grid
+}
+
+func (at *AreaTargeter) alloc() {
+  if at.grid != nil {
+    return
+  }
+  at.grid = makeGrid()
+  at.hit = makeGrid()
+}
+
+func (at *AreaTargeter) add(x, y int) {
+  at.hit[x][y] = true
+  at.cells = append(at.cells, [2]int{x, y})
+}
+
+func (at *AreaTargeter) contains(ox, oy, tx, ty, x, y int) bool {
+  switch at.Shape {
+  case AreaCircle:
+    dx := float64(x - tx)
+    dy := float64(y - ty)
+    return dx*dx+dy*dy <= float64(at.Length*at.Length)
+
+  case AreaCone:
+    if x == ox && y == oy {
+      return false
+    }
+    dx := float64(x - ox)
+    dy := float64(y - oy)
+    if dx*dx+dy*dy > float64(at.Length*at.Length) {
+      return false
+    }
+    diff := math.Atan2(dy, dx) - math.Atan2(float64(ty-oy), float64(tx-ox))
+    for diff > math.Pi {
+      diff -= 2 * math.Pi
+    }
+    for diff < -math.Pi {
+      diff += 2 * math.Pi
+    }
+    return math.Abs(diff)*180/math.Pi <= at.Angle/2
+
+  case AreaSquare:
+    x0 := tx - (at.Length-1)/2
+    y0 := ty - (at.Length-1)/2
+    return x >= x0 && x < x0+at.Length && y >= y0 && y < y0+at.Length
+  }
+  return false
+}
+
+// Selects the cells affected by an effect originating at ox, oy and aimed at
+// tx, ty.  The result is also retained so that it can be drawn with
+// RenderOnFloor.
+func (at *AreaTargeter) Target(g *Game, ox, oy, tx, ty int) [][2]int {
+  at.alloc()
+  at.Clear()
+  if at.Shape == AreaLine {
+    if ox == tx && oy == ty {
+      return at.cells
+    }
+    // Extend the line out to its full length before tracing it, then let
+    // doLos stop it at the first wall.
+    dx := float64(tx - ox)
+    dy := float64(ty - oy)
+    scale := float64(at.Length) / math.Max(math.Abs(dx), math.Abs(dy))
+    ex := ox + int(math.Floor(dx*scale+0.5))
+    ey := oy + int(math.Floor(dy*scale+0.5))
+    for i := range at.grid {
+      for j := range at.grid[i] {
+        at.grid[i][j] = false
+      }
+    }
+    var line [][2]int
+    bresenham(ox, oy, ex, ey, &line)
+    g.doLos(at.Length, line, at.grid, g.Los_supercover)
+    for _, p := range line[1:] {
+      if p[0] < 0 || p[1] < 0 || p[0] >= house.LosTextureSize || p[1] >= house.LosTextureSize {
+        break
+      }
+      if at.grid[p[0]][p[1]] {
+        at.add(p[0], p[1])
+      }
+    }
+    return at.cells
+  }
+
+  centers := [][2]int{{tx, ty}}
+  switch {
+  case at.Shape == AreaCone:
+    centers[0] = [2]int{ox, oy}
+  case at.Shape == AreaSquare && at.Length%2 == 0:
+    centers = append(centers, [2]int{tx + 1, ty}, [2]int{tx, ty + 1}, [2]int{tx + 1, ty + 1})
+  }
+  for _, c := range centers {
+    g.DetermineLos(c[0], c[1], at.Length, at.grid)
+    for x := c[0] - at.Length; x <= c[0]+at.Length; x++ {
+      for y := c[1] - at.Length; y <= c[1]+at.Length; y++ {
+        if x < 0 || y < 0 || x >= house.LosTextureSize || y >= house.LosTextureSize {
+          continue
+        }
+        if at.hit[x][y] || !at.grid[x][y] || !at.contains(ox, oy, tx, ty, x, y) {
+          continue
+        }
+        at.add(x, y)
+      }
+    }
+  }
+  return at.cells
+}
+
+// Returns the cells selected by the last call to Target.
+func (at *AreaTargeter) Cells() [][2]int {
+  return at.cells
+}
+
+// Returns true if x, y was selected by the last call to Target.
+func (at *AreaTargeter) Hits(x, y int) bool {
+  if at.hit == nil || x < 0 || y < 0 || x >= house.LosTextureSize || y >= house.LosTextureSize {
+    return false
+  }
+  return at.hit[x][y]
+}
+
+func (at *AreaTargeter) Clear() {
+  for _, c := range at.cells {
+    at.hit[c[0]][c[1]] = false
+  }
+  at.cells = at.cells[0:0]
+}
+
+// Draws a preview of the selected cells.  If the effect can't be used where
+// it is aimed the cells are drawn in a different color.
+func (at *AreaTargeter) RenderOnFloor(valid bool) {
+  if len(at.cells) == 0 {
+    return
+  }
+  gl.Disable(gl.TEXTURE_2D)
+  if valid {
+    house.CurrentPalette().Area.Set()
+  } else {
+    house.CurrentPalette().Area_invalid.Set()
+  }
+  gl.Begin(gl.QUADS)
+  for _, c := range at.cells {
+    x := int32(c[0])
+    y := int32(c[1])
+    gl.Vertex2i(x, y)
+    gl.Vertex2i(x, y+1)
+    gl.Vertex2i(x+1, y+1)
+    gl.Vertex2i(x+1, y)
+  }
+  gl.End()
+  gl.Enable(gl.TEXTURE_2D)
+}
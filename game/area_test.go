@@ -0,0 +1,115 @@
+package game_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/runningwild/haunts/game"
+  "github.com/runningwild/haunts/house"
+  "path/filepath"
+)
+
+func AreaSpec(c gospec.Context) {
+  house.LoadAllRoomsInDir(filepath.Join(datadir, "rooms"))
+  house.LoadAllDoorsInDir(filepath.Join(datadir, "doors"))
+
+  // Two rooms side-by-side, (1, 1) - (4, 4) and (5, 1) - (8, 4), with a wall
+  // between them and no door.
+  sealed := &house.HouseDef{Name: "Sealed Area Test"}
+  sealed.Floors = append(sealed.Floors, &house.Floor{Rooms: []*house.Room{makeRoom(1, 1), makeRoom(5, 1)}})
+  g := game.MakeHeadlessGame(sealed)
+
+  // The same rooms connected by a doorway at (4, 2) - (5, 2).
+  left := makeRoom(1, 1)
+  right := makeRoom(5, 1)
+  left.Doors = append(left.Doors, makeDoor(house.FarRight, 1))
+  right.Doors = append(right.Doors, makeDoor(house.NearLeft, 1))
+  open := &house.HouseDef{Name: "Open Area Test"}
+  open.Floors = append(open.Floors, &house.Floor{Rooms: []*house.Room{left, right}})
+  g2 := game.MakeHeadlessGame(open)
+
+  c.Specify("Circles hit cells within their radius of the target.", func() {
+    at := game.AreaTargeter{Shape: game.AreaCircle, Length: 2}
+    at.Target(g, 1, 2, 3, 2)
+    c.Expect(at.Hits(1, 2), Equals, true)
+    c.Expect(at.Hits(3, 4), Equals, true)
+    c.Expect(at.Hits(2, 4), Equals, false)
+    c.Expect(len(at.Cells()), Equals, 11)
+  })
+
+  c.Specify("Cones only hit cells within half their angle of the target.", func() {
+    at := game.AreaTargeter{Shape: game.AreaCone, Length: 3, Angle: 90}
+    at.Target(g, 1, 2, 4, 2)
+    c.Expect(at.Hits(1, 2), Equals, false)
+    c.Expect(at.Hits(4, 2), Equals, true)
+    c.Expect(at.Hits(2, 3), Equals, true)
+    c.Expect(at.Hits(3, 4), Equals, true)
+    c.Expect(at.Hits(1, 4), Equals, false)
+    c.Expect(at.Hits(4, 4), Equals, false)
+  })
+
+  c.Specify("Lines run from the origin towards the target and stop at walls.", func() {
+    at := game.AreaTargeter{Shape: game.AreaLine, Length: 6}
+    at.Target(g2, 1, 2, 2, 2)
+    c.Expect(at.Hits(1, 2), Equals, false)
+    c.Expect(at.Hits(2, 2), Equals, true)
+    c.Expect(at.Hits(6, 2), Equals, true)
+    c.Expect(at.Hits(2, 3), Equals, false)
+
+    at.Target(g, 1, 2, 2, 2)
+    c.Expect(len(at.Cells()), Equals, 3)
+    c.Expect(at.Hits(4, 2), Equals, true)
+    c.Expect(at.Hits(5, 2), Equals, false)
+  })
+
+  c.Specify("Squares with an even side are centered up and to the right of the target.", func() {
+    at := game.AreaTargeter{Shape: game.AreaSquare, Length: 3}
+    at.Target(g, 2, 2, 2, 2)
+    c.Expect(len(at.Cells()), Equals, 9)
+    c.Expect(at.Hits(1, 1), Equals, true)
+    c.Expect(at.Hits(3, 3), Equals, true)
+
+    at.Length = 2
+    at.Target(g, 2, 2, 2, 2)
+    c.Expect(len(at.Cells()), Equals, 4)
+    c.Expect(at.Hits(1, 1), Equals, false)
+    c.Expect(at.Hits(3, 3), Equals, true)
+  })
+
+  c.Specify("Areas don't go through walls.", func() {
+    at := game.AreaTargeter{Shape: game.AreaCircle, Length: 2}
+    at.Target(g2, 4, 2, 4, 2)
+    c.Expect(at.Hits(5, 2), Equals, true)
+    c.Expect(at.Hits(6, 2), Equals, true)
+
+    at.Target(g, 4, 2, 4, 2)
+    c.Expect(at.Hits(3, 2), Equals, true)
+    c.Expect(at.Hits(5, 2), Equals, false)
+    c.Expect(at.Hits(6, 2), Equals, false)
+    for _, cell := range at.Cells() {
+      c.Expect(cell[0] < 5, Equals, true)
+    }
+
+    square := game.AreaTargeter{Shape: game.AreaSquare, Length: 3}
+    square.Target(g, 4, 2, 4, 2)
+    c.Expect(len(square.Cells()), Equals, 6)
+    c.Expect(square.Hits(5, 2), Equals, false)
+  })
+
+  c.Specify("Areas are clipped to the edge of the board.", func() {
+    corner := &house.HouseDef{Name: "Corner Area Test"}
+    corner.Floors = append(corner.Floors, &house.Floor{Rooms: []*house.Room{makeRoom(0, 0)}})
+    g3 := game.MakeHeadlessGame(corner)
+    at := game.AreaTargeter{Shape: game.AreaCircle, Length: 2}
+    at.Target(g3, 0, 0, 0, 0)
+    c.Expect(len(at.Cells()), Equals, 6)
+    for _, cell := range at.Cells() {
+      c.Expect(cell[0] >= 0 && cell[1] >= 0, Equals, true)
+    }
+    c.Expect(at.Hits(-1, 0), Equals, false)
+
+    line := game.AreaTargeter{Shape: game.AreaLine, Length: 5}
+    line.Target(g3, 1, 1, 0, 0)
+    c.Expect(len(line.Cells()), Equals, 1)
+    c.Expect(line.Hits(0, 0), Equals, true)
+  })
+}
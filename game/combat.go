@@ -4,6 +4,8 @@ import (
   "github.com/runningwild/haunts/game/status"
 )
 
+// Returns true if the attack hits.  Misses are logged here, hits are logged
+// by DealDamage.
 func (g *Game) DoAttack(attacker, defender *Entity, strength int, kind status.Kind) bool {
   // get attacker's bonus for using the specified kind of attack
   // get defender's bonus for defending against the specified kind of attack
@@ -12,5 +14,17 @@ func (g *Game) DoAttack(attacker, defender *Entity, strength int, kind status.Ki
   attack := attacker.Stats.AttackBonusWith(kind)
   defense := defender.Stats.DefenseVs(kind)
   roll := int(g.Rand.Int63()%10) + 1
-  return strength+attack+roll >= defense
+  hit := strength+attack+roll >= defense
+  if !hit {
+    g.Notify(Event{Kind: EventAttack, Ent: attacker, Target: defender})
+  }
+  return hit
+}
+
+// Damages defender after a successful DoAttack.  Attacks should always go
+// through here so that they get logged.
+func (g *Game) DealDamage(attacker, defender *Entity, damage int, kind status.Kind) {
+  hp := defender.Stats.HpCur()
+  defender.Stats.ApplyDamage(0, -damage, kind)
+  g.Notify(Event{Kind: EventAttack, Ent: attacker, Target: defender, Hit: true, Damage: hp - defender.Stats.HpCur()})
 }
@@ -0,0 +1,50 @@
+package game
+
+// Actions that can only be used every few rounds implement this.
+type CooldownAction interface {
+  Action
+
+  // Number of the acting entity's rounds that must pass after this action
+  // is used before it can be used again.
+  CooldownLength() int
+}
+
+// Returns the number of rounds until ent can use a again, 0 if it can be
+// used now.
+func (g *Game) ActionCooldown(ent *Entity, a Action) int {
+  return g.Cooldowns[ent.Id][a.String()]
+}
+
+// Puts the current action on cooldown for the entity that used it, if it
+// has one.
+func (g *Game) startCooldown() {
+  ca, ok := g.current_action.(CooldownAction)
+  if !ok || ca.CooldownLength() <= 0 {
+    return
+  }
+  ent := g.actingEntity()
+  if ent == nil {
+    return
+  }
+  if g.Cooldowns == nil {
+    g.Cooldowns = make(map[EntityId]map[string]int)
+  }
+  if g.Cooldowns[ent.Id] == nil {
+    g.Cooldowns[ent.Id] = make(map[string]int)
+  }
+  g.Cooldowns[ent.Id][ca.String()] = ca.CooldownLength()
+}
+
+// Counts down all of ent's cooldowns by one round.
+func (g *Game) tickCooldowns(ent *Entity) {
+  cds := g.Cooldowns[ent.Id]
+  for name := range cds {
+    cds[name]--
+    if cds[name] <= 0 {
+      delete(cds, name)
+    }
+  }
+  if cds != nil && len(cds) == 0 {
+    delete(g.Cooldowns, ent.Id)
+  }
+}
@@ -11,7 +11,7 @@ import (
   "github.com/runningwild/haunts/sound"
   "github.com/runningwild/haunts/texture"
   "github.com/runningwild/mathgl"
-  "image"
+  "math"
   "path/filepath"
   "regexp"
 )
@@ -80,23 +80,16 @@ func (g *Game) placeEntity(pattern string) bool {
   g.new_ent.Info.RoomsExplored[g.new_ent.CurrentRoom()] = true
   ix, iy := int(g.new_ent.X), int(g.new_ent.Y)
   idx, idy := g.new_ent.Dims()
-  r, f, _ := g.House.Floors[0].RoomFurnSpawnAtPos(ix, iy)
-
-  if r == nil || f != nil {
-    return false
-  }
-  for _, e := range g.Ents {
-    x, y := e.Pos()
-    dx, dy := e.Dims()
-    r1 := image.Rect(x, y, x+dx, y+dy)
-    r2 := image.Rect(ix, iy, ix+idx, iy+idy)
-    if r1.Overlaps(r2) {
-      return false
+  for x := ix; x < ix+idx; x++ {
+    for y := iy; y < iy+idy; y++ {
+      if !g.CanPlaceEntity(x, y) {
+        return false
+      }
     }
   }
 
   // Check for spawn points
-  for _, spawn := range g.House.Floors[0].Spawns {
+  for _, spawn := range g.CurrentFloor().Spawns {
     if !re.MatchString(spawn.Name) {
       continue
     }
@@ -108,7 +101,7 @@ func (g *Game) placeEntity(pattern string) bool {
     if iy < y || iy+idy > y+dy {
       continue
     }
-    g.Ents = append(g.Ents, g.new_ent)
+    g.addEnt(g.new_ent)
     g.new_ent = nil
     return true
   }
@@ -137,26 +130,31 @@ func (e *Entity) LoadAi() {
 // Does some basic setup that is common to both creating a new entity and to
 // loading one from a saved game.
 func (e *Entity) Load(g *Game) {
-  e.sprite.Load(e.Sprite_path.String())
-  e.Sprite().SetTriggerFunc(func(s *sprite.Sprite, name string) {
-    x, y := e.Pos()
-    dx, dy := e.Dims()
-    volume := 1.0
-    if e.Side() == SideExplorers || e.Side() == SideHaunt {
-      volume = e.Game().ViewFrac(x, y, dx, dy)
-    }
-    if e.current_action != nil {
-      if sound_name, ok := e.current_action.SoundMap()[name]; ok {
-        sound.PlaySound(sound_name, volume)
-        return
+  // Headless games never draw anything, so their entities don't get sprites.
+  if !g.headless {
+    e.sprite.Load(e.Sprite_path.String())
+  }
+  if e.Sprite() != nil {
+    e.Sprite().SetTriggerFunc(func(s *sprite.Sprite, name string) {
+      x, y := e.Pos()
+      dx, dy := e.Dims()
+      volume := 1.0
+      if e.Side() == SideExplorers || e.Side() == SideHaunt {
+        volume = e.Game().ViewFrac(x, y, dx, dy)
       }
-    }
-    if e.Sounds != nil {
-      if sound_name, ok := e.Sounds[name]; ok {
-        sound.PlaySound(sound_name, volume)
+      if e.current_action != nil {
+        if sound_name, ok := e.current_action.SoundMap()[name]; ok {
+          sound.PlaySound(sound_name, volume)
+          return
+        }
       }
-    }
-  })
+      if e.Sounds != nil {
+        if sound_name, ok := e.Sounds[name]; ok {
+          sound.PlaySound(sound_name, volume)
+        }
+      }
+    })
+  }
 
   if e.Side() == SideHaunt || e.Side() == SideExplorers {
     e.los = &losData{}
@@ -375,7 +373,9 @@ type losData struct {
 
 type EntityId int
 type EntityInst struct {
-  // Used to keep track of entities across a save/load
+  // Used to keep track of entities across a save/load, and to refer to them
+  // in execs and the event log.  Ids are never reused within a game, even
+  // after the entity they belonged to is removed.
   Id EntityId
 
   X, Y float64
@@ -405,6 +405,10 @@ type EntityInst struct {
   // until the Action is complete.
   current_action Action
 
+  // Action that this entity has readied, it may be used to interrupt an
+  // enemy before this entity's next turn.
+  readied Action
+
   Stats *status.Inst
 
   // Ai stuff - the channels cannot be gobbed, so they need to be remade when
@@ -420,6 +424,26 @@ type EntityInst struct {
   // For inanimate objects - some of them need to be activated so we know when
   // the players can interact with them.
   Active bool
+
+  // Names of the keys this entity is carrying, used to unlock locked doors.
+  Keys []string
+
+  // Items this entity is carrying.
+  Inventory []*Item
+
+  // If the entity is walking between two cells this tracks where it is
+  // drawn.  X and Y are not updated until the walk is finished.
+  anim moveAnimation
+}
+
+type moveAnimation struct {
+  active bool
+
+  // Source and destination of the current walk, in board coordinates
+  sx, sy float64
+  tx, ty float64
+
+  elapsed, duration int64
 }
 type aiStatus int
 
@@ -493,14 +517,21 @@ func DiscretizePoint64(x, y float64) (int, int) {
 func (ei *EntityInst) Pos() (int, int) {
   return DiscretizePoint64(ei.X, ei.Y)
 }
+
+// Returns the position that the entity should be drawn at, which may be
+// between cells if the entity is in the middle of walking somewhere.
 func (ei *EntityInst) FPos() (float64, float64) {
-  return ei.X, ei.Y
+  if !ei.anim.active {
+    return ei.X, ei.Y
+  }
+  t := float64(ei.anim.elapsed) / float64(ei.anim.duration)
+  return ei.anim.sx + (ei.anim.tx-ei.anim.sx)*t, ei.anim.sy + (ei.anim.ty-ei.anim.sy)*t
 }
 func (ei *EntityInst) CurrentRoom() int {
   x, y := ei.Pos()
-  room := roomAt(ei.game.House.Floors[0], x, y)
-  for i := range ei.game.House.Floors[0].Rooms {
-    if ei.game.House.Floors[0].Rooms[i] == room {
+  room := roomAt(ei.game.CurrentFloor(), x, y)
+  for i := range ei.game.CurrentFloor().Rooms {
+    if ei.game.CurrentFloor().Rooms[i] == room {
       return i
     }
   }
@@ -537,6 +568,69 @@ func (e *Entity) drawReticle(pos mathgl.Vec2, rgba [4]float64) {
   gl.PopAttrib()
 }
 
+// Draws a health bar above the entity, and a row of icons above that for
+// each condition it has.  height is the height the entity was drawn with.
+func (e *Entity) drawStatus(pos mathgl.Vec2, width, height float32) {
+  if e.Stats == nil || (e.game != nil && e.game.hide_status) {
+    return
+  }
+  gl.PushAttrib(gl.CURRENT_BIT | gl.ENABLE_BIT)
+  defer gl.PopAttrib()
+  gl.Disable(gl.TEXTURE_2D)
+
+  frac := float32(0)
+  if e.Stats.HpMax() > 0 {
+    frac = float32(e.Stats.HpCur()) / float32(e.Stats.HpMax())
+  }
+  if frac < 0 {
+    frac = 0
+  }
+  if frac > 1 {
+    frac = 1
+  }
+  bar := width / 10
+  if bar < 3 {
+    bar = 3
+  }
+  x, y := pos.X+width/10, pos.Y+height+bar
+  dx := width * 8 / 10
+  quad := func(x, y, dx, dy float32) {
+    gl.Vertex2f(x, y)
+    gl.Vertex2f(x, y+dy)
+    gl.Vertex2f(x+dx, y+dy)
+    gl.Vertex2f(x+dx, y)
+  }
+  palette := house.CurrentPalette()
+  gl.Begin(gl.QUADS)
+  palette.Status_background.Set()
+  quad(x-1, y-1, dx+2, bar+2)
+  palette.Health_empty.Mix(palette.Health_full, float64(frac)).Set()
+  quad(x, y, dx*frac, bar)
+
+  y += bar + 2
+  for i, kind := range e.Stats.ConditionKinds() {
+    c, ok := palette.Conditions[string(kind)]
+    if !ok {
+      c = palette.Condition
+    }
+    ix := x + float32(i)*(bar+3)
+    palette.Status_background.Set()
+    quad(ix-1, y-1, bar+2, bar+2)
+    c.Set()
+    quad(ix, y, bar, bar)
+  }
+  gl.End()
+}
+
+// Sets whether health bars and condition icons are drawn over entities.
+func (g *Game) SetStatusVisible(visible bool) {
+  g.hide_status = !visible
+}
+
+func (g *Game) StatusVisible() bool {
+  return !g.hide_status
+}
+
 func (e *Entity) Color() (r, g, b, a byte) {
   return 255, 255, 255, 255
 }
@@ -546,10 +640,12 @@ func (e *Entity) Render(pos mathgl.Vec2, width float32) {
   e.last_render_width = width
   gl.Enable(gl.TEXTURE_2D)
   e.drawReticle(pos, rgba)
+  height := width * 150 / 100
   if e.sprite.sp != nil {
     dxi, dyi := e.sprite.sp.Dims()
     dx := float32(dxi)
     dy := float32(dyi)
+    height = dy * width / dx
     tx, ty, tx2, ty2 := e.sprite.sp.Bind()
     gl.Begin(gl.QUADS)
     gl.TexCoord2d(tx, -ty)
@@ -562,6 +658,7 @@ func (e *Entity) Render(pos mathgl.Vec2, width float32) {
     gl.Vertex2f(pos.X+width, pos.Y)
     gl.End()
   }
+  e.drawStatus(pos, width, height)
 }
 
 func facing(v mathgl.Vec2) int {
@@ -588,6 +685,9 @@ func facing(v mathgl.Vec2) int {
 }
 
 func (e *Entity) TurnToFace(x, y int) {
+  if e.sprite.sp == nil {
+    return
+  }
   target := mathgl.Vec2{float32(x), float32(y)}
   source := mathgl.Vec2{float32(e.X), float32(e.Y)}
   var seg mathgl.Vec2
@@ -611,39 +711,76 @@ func (e *Entity) TurnToFace(x, y int) {
   }
 }
 
-// Advances ent up to dist towards the target cell.  Returns the distance
-// traveled.
-func (e *Entity) DoAdvance(dist float32, x, y int) float32 {
-  if dist <= 0 {
-    e.sprite.sp.Command("stop")
-    return 0
+// Starts the entity walking to x, y.  The walk takes duration ms per cell
+// travelled, Pos() does not change until the walk is complete.
+func (e *Entity) AnimateMove(x, y int, duration int64) {
+  e.finishMove()
+  if e.game != nil {
+    e.game.recordTrail(e)
+  }
+  dx := float64(x) - e.X
+  dy := float64(y) - e.Y
+  dist := math.Sqrt(dx*dx + dy*dy)
+  if dist == 0 || duration <= 0 {
+    e.X = float64(x)
+    e.Y = float64(y)
+    e.notifyMoved()
+    return
   }
-  e.sprite.sp.Command("move")
-
-  source := mathgl.Vec2{float32(e.X), float32(e.Y)}
-  target := mathgl.Vec2{float32(x), float32(y)}
-  var seg mathgl.Vec2
-  seg.Assign(&target)
-  seg.Subtract(&source)
   e.TurnToFace(x, y)
-  var traveled float32
-  if seg.Length() > dist {
-    seg.Scale(dist / seg.Length())
-    traveled = dist
-  } else {
-    traveled = seg.Length()
+  if e.sprite.sp != nil {
+    e.sprite.sp.Command("move")
+  }
+  e.anim = moveAnimation{
+    active:   true,
+    sx:       e.X,
+    sy:       e.Y,
+    tx:       float64(x),
+    ty:       float64(y),
+    duration: int64(float64(duration) * dist),
+  }
+}
+
+// Puts the entity at x, y immediately, abandoning any walk in progress.
+func (e *Entity) SetPos(x, y int) {
+  e.anim = moveAnimation{}
+  e.X = float64(x)
+  e.Y = float64(y)
+  e.notifyMoved()
+}
+
+// Returns true if the entity is in the middle of walking between cells.
+func (e *Entity) IsAnimating() bool {
+  return e.anim.active
+}
+
+func (e *Entity) finishMove() {
+  if !e.anim.active {
+    return
   }
-  seg.Add(&source)
-  e.X = float64(seg.X)
-  e.Y = float64(seg.Y)
+  e.X = e.anim.tx
+  e.Y = e.anim.ty
+  e.anim = moveAnimation{}
+  e.notifyMoved()
+}
 
-  return dist - traveled
+func (e *Entity) notifyMoved() {
+  if e.game != nil {
+    e.game.recordTrail(e)
+    e.game.Notify(Event{Kind: EventEntityMoved, Ent: e})
+  }
 }
 
 func (e *Entity) Think(dt int64) {
   if e.sprite.sp != nil {
     e.sprite.sp.Think(dt)
   }
+  if e.anim.active {
+    e.anim.elapsed += dt
+    if e.anim.elapsed >= e.anim.duration {
+      e.finishMove()
+    }
+  }
 }
 
 func (e *Entity) SetGear(gear_name string) bool {
@@ -686,10 +823,40 @@ func (e *Entity) SetGear(gear_name string) bool {
   return true
 }
 
+// Readies an action so that it can be used to interrupt enemies that come
+// into view.  Returns false if the action is not one of this entity's
+// actions or cannot be readied.
+func (e *Entity) ReadyAction(a Action) bool {
+  if a == nil {
+    e.readied = nil
+    return true
+  }
+  if !a.Readyable() {
+    return false
+  }
+  if _, ok := a.(InterruptAction); !ok {
+    base.Error().Printf("Action '%s' is readyable but can't make an interrupt exec.", a.String())
+    return false
+  }
+  for _, action := range e.Actions {
+    if action == a {
+      e.readied = a
+      return true
+    }
+  }
+  return false
+}
+
+func (e *Entity) ReadiedAction() Action {
+  return e.readied
+}
+
 func (e *Entity) OnRound() {
+  // Readied actions only last until this entity's next turn
+  e.readied = nil
   if e.Stats != nil {
     e.Stats.OnRound()
-    if e.Stats.HpCur() <= 0 {
+    if e.Stats.HpCur() <= 0 && e.Sprite() != nil {
       e.sprite.Sprite().Command("defend")
       e.sprite.Sprite().Command("killed")
     }
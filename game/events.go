@@ -0,0 +1,108 @@
+package game
+
+import (
+  "github.com/runningwild/haunts/base"
+  "github.com/runningwild/haunts/house"
+)
+
+type EventKind int
+
+const (
+  // Ent has finished moving into a new cell
+  EventEntityMoved EventKind = iota
+
+  // Ent died and is about to be removed from the game
+  EventEntityDied
+
+  // Turn and Side have changed
+  EventTurnChanged
+
+  // Door in Room has started to open or close
+  EventDoorChanged
+
+  // Exec has been verified and is about to be run by Ent
+  EventActionCommitted
+
+  // Ent attacked Target, if it Hit then it did Damage to it
+  EventAttack
+
+  // Ent picked up Item
+  EventItemPickedUp
+
+  // The game is over and Side won
+  EventGameOver
+)
+
+// Something that happened in the game.  Only the fields that are relevant to
+// Kind are set.
+type Event struct {
+  Kind EventKind
+
+  Ent  *Entity
+  Exec ActionExec
+
+  Target *Entity
+  Hit    bool
+  Damage int
+
+  Turn int
+  Side Side
+
+  Room *house.Room
+  Door *house.Door
+
+  Item *Item
+}
+
+// Calls f with every event that happens from now on.  Observers are run on
+// the game's thread, so they should return quickly and must not block.
+func (g *Game) Subscribe(f func(Event)) {
+  g.observers = append(g.observers, f)
+}
+
+// Calls f at the start of every turn after the first, once Turn and Side have
+// been updated.  Like observers, f runs on the game's thread and must not
+// block.
+func (g *Game) OnRoundStart(f func(turn int, side Side)) {
+  g.round_start = append(g.round_start, f)
+}
+
+// Calls f once, when the script has finished setting up the game and the
+// first turn is about to start.
+func (g *Game) OnGameStart(f func()) {
+  g.game_start = append(g.game_start, f)
+}
+
+// Starts the first turn.  Does nothing if the game has already started.
+func (g *Game) begin() {
+  if g.Turn_state != turnStateInit {
+    return
+  }
+  base.Log().Printf("ScriptComm: change to turnStateStart")
+  g.Turn_state = turnStateStart
+  for _, f := range g.game_start {
+    f()
+  }
+  if g.script != nil {
+    g.script.OnRound(g)
+  }
+}
+
+// Headless games have no script to tell them when setup is done, so they
+// have to be started with this instead.
+func (g *Game) StartHeadless() {
+  if !g.headless {
+    base.Warn().Printf("StartHeadless can only be used on headless games.")
+    return
+  }
+  g.begin()
+}
+
+// Records e in the log and passes it along to every observer.
+func (g *Game) Notify(e Event) {
+  g.record(e)
+  g.checkTriggers(e)
+  for _, f := range g.observers {
+    f(e)
+  }
+}
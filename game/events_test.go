@@ -0,0 +1,52 @@
+package game_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/runningwild/haunts/game"
+  "github.com/runningwild/haunts/house"
+)
+
+func EventsSpec(c gospec.Context) {
+  g := game.MakeHeadlessGame(&house.HouseDef{Floors: []*house.Floor{&house.Floor{}}})
+
+  c.Specify("Observers see every event.", func() {
+    var kinds []game.EventKind
+    g.Subscribe(func(e game.Event) {
+      kinds = append(kinds, e.Kind)
+    })
+    g.Notify(game.Event{Kind: game.EventTurnChanged, Turn: 2})
+    g.Notify(game.Event{Kind: game.EventActionCommitted})
+    c.Expect(len(kinds), Equals, 2)
+    c.Expect(kinds[0], Equals, game.EventTurnChanged)
+    c.Expect(kinds[1], Equals, game.EventActionCommitted)
+  })
+
+  c.Specify("Only significant events are logged.", func() {
+    g.Notify(game.Event{Kind: game.EventActionCommitted})
+    g.Notify(game.Event{Kind: game.EventTurnChanged})
+    c.Expect(len(g.Log()), Equals, 1)
+    c.Expect(g.Log()[0].Kind, Equals, game.EventTurnChanged)
+    c.Expect(g.Log()[0].String(), Equals, "Turn 1")
+  })
+
+  c.Specify("OnGameStart fires exactly once.", func() {
+    starts := 0
+    g.OnGameStart(func() {
+      starts++
+    })
+    g.StartHeadless()
+    g.StartHeadless()
+    c.Expect(starts, Equals, 1)
+  })
+
+  c.Specify("OnRoundStart fires with the new turn and side.", func() {
+    turn, side := -1, game.SideNone
+    g.OnRoundStart(func(t int, s game.Side) {
+      turn, side = t, s
+    })
+    g.OnRound(true)
+    c.Expect(turn, Equals, g.Turn)
+    c.Expect(side, Equals, game.SideHaunt)
+  })
+}
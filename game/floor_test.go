@@ -0,0 +1,282 @@
+package game_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/runningwild/glop/util/algorithm"
+  "github.com/runningwild/haunts/base"
+  "github.com/runningwild/haunts/game"
+  "github.com/runningwild/haunts/house"
+  "path/filepath"
+)
+
+var datadir string
+
+func init() {
+  datadir, _ = filepath.Abs("../data_test")
+  base.SetDatadir(datadir)
+}
+
+func makeRoom(x, y int) *house.Room {
+  return makeNamedRoom("Room Test", x, y)
+}
+
+func makeNamedRoom(name string, x, y int) *house.Room {
+  r := &house.Room{Defname: name, X: x, Y: y}
+  base.GetObject("rooms", r)
+  return r
+}
+
+func makeDoor(facing house.WallFacing, pos int) *house.Door {
+  d := &house.Door{Defname: "Door Test", Facing: facing, Pos: pos}
+  d.Load()
+  return d
+}
+
+func FloorSpec(c gospec.Context) {
+  house.LoadAllRoomsInDir(filepath.Join(datadir, "rooms"))
+  house.LoadAllDoorsInDir(filepath.Join(datadir, "doors"))
+
+  // Floor 0 has a single room, floor 1 has two rooms side-by-side connected
+  // by a door.  Nothing on floor 1 beyond the first room exists on floor 0.
+  h := &house.HouseDef{Name: "Floor Test"}
+  h.Floors = append(h.Floors, &house.Floor{Rooms: []*house.Room{makeRoom(1, 1)}})
+  left := makeRoom(1, 1)
+  right := makeRoom(5, 1)
+  left.Doors = append(left.Doors, makeDoor(house.FarRight, 1))
+  right.Doors = append(right.Doors, makeDoor(house.NearLeft, 1))
+  h.Floors = append(h.Floors, &house.Floor{Rooms: []*house.Room{left, right}})
+
+  var g game.Game
+  g.House = h
+
+  c.Specify("Vertices are computed on the current floor.", func() {
+    g.Current_floor = 0
+    room, _, _ := g.FromVertex(g.ToVertex(6, 2))
+    c.Expect(room == nil, Equals, true)
+
+    g.Current_floor = 1
+    room, x, y := g.FromVertex(g.ToVertex(6, 2))
+    c.Expect(room == right, Equals, true)
+    c.Expect(x, Equals, 6)
+    c.Expect(y, Equals, 2)
+  })
+
+  c.Specify("Rooms convert between floor and room coordinates.", func() {
+    lx, ly := right.ToLocal(6, 2)
+    c.Expect(lx, Equals, 1)
+    c.Expect(ly, Equals, 1)
+    fx, fy := right.ToFloor(lx, ly)
+    c.Expect(fx, Equals, 6)
+    c.Expect(fy, Equals, 2)
+    c.Expect(right.Contains(5, 1), Equals, true)
+    c.Expect(right.Contains(8, 4), Equals, true)
+    c.Expect(right.Contains(4, 1), Equals, false)
+    c.Expect(right.Contains(9, 1), Equals, false)
+    c.Expect(right.Contains(5, 5), Equals, false)
+  })
+
+  c.Specify("Rooms on floors other than the first are reachable.", func() {
+    g.Current_floor = 1
+    graph := g.Graph(game.SideExplorers, false, nil)
+    src := g.ToVertex(2, 2)
+    dst := g.ToVertex(7, 3)
+    _, path := algorithm.Dijkstra(graph, []int{src}, []int{dst})
+    c.Expect(len(path) > 0, Equals, true)
+    c.Expect(path[len(path)-1], Equals, dst)
+
+    adj, _ := g.RoomGraph().Adjacent(0)
+    c.Expect(len(adj), Equals, 1)
+    c.Expect(adj[0], Equals, 1)
+  })
+
+  c.Specify("Terrain costs are applied to the movement graph.", func() {
+    var tg game.Game
+    tg.House = &house.HouseDef{Name: "Terrain Test"}
+    tg.House.Floors = append(tg.House.Floors, &house.Floor{Rooms: []*house.Room{makeNamedRoom("Rubble Test", 0, 0)}})
+    graph := tg.Graph(game.SideExplorers, false, nil)
+    adj, cost := graph.Adjacent(tg.ToVertex(1, 1))
+    weights := make(map[int]float64)
+    for i := range adj {
+      weights[adj[i]] = cost[i]
+    }
+    c.Expect(weights[tg.ToVertex(2, 1)], Equals, 3.0)
+    c.Expect(weights[tg.ToVertex(1, 2)], Equals, 1.0)
+    c.Expect(weights[tg.ToVertex(2, 2)], Equals, 2.0)
+  })
+
+  c.Specify("Validate reports rooms and floors that can't be reached.", func() {
+    h.Starting_floor = 1
+    c.Expect(len(h.Validate()), Equals, 1)
+
+    lonely := makeRoom(1, 10)
+    h.Floors[1].Rooms = append(h.Floors[1].Rooms, lonely)
+    c.Expect(len(h.Validate()), Equals, 2)
+    h.Floors[1].Rooms = h.Floors[1].Rooms[0:2]
+
+    h.Floors[0].Rooms = nil
+    c.Expect(len(h.Validate()), Equals, 0)
+    h.Floors[0].Rooms = []*house.Room{makeRoom(1, 1)}
+  })
+
+  c.Specify("Entities can only be placed in empty cells inside rooms.", func() {
+    house.LoadAllFurnitureInDir(filepath.Join(datadir, "furniture"))
+    g.Current_floor = 1
+    c.Expect(g.CanPlaceEntity(2, 2), Equals, true)
+    c.Expect(g.CanPlaceEntity(0, 0), Equals, false)
+    c.Expect(g.CanPlaceEntity(20, 2), Equals, false)
+
+    crate := house.MakeFurniture("Crate Test")
+    crate.X, crate.Y = 1, 1
+    left.Furniture = append(left.Furniture, crate)
+    c.Expect(g.CanPlaceEntity(2, 2), Equals, false)
+    c.Expect(g.IsCellOccupied(2, 2), Equals, true)
+  })
+
+  c.Specify("Missing cells are outside of their room.", func() {
+    var ng game.Game
+    ng.House = &house.HouseDef{Name: "Notched Test"}
+    ng.House.Floors = append(ng.House.Floors, &house.Floor{Rooms: []*house.Room{makeNamedRoom("Notched Test", 1, 1)}})
+    c.Expect(ng.CanPlaceEntity(3, 4), Equals, true)
+    c.Expect(ng.CanPlaceEntity(4, 4), Equals, false)
+    room, _, _ := ng.FromVertex(ng.ToVertex(4, 4))
+    c.Expect(room == nil, Equals, true)
+  })
+
+  c.Specify("A MoveGraph goes stale once furniture or doors change.", func() {
+    house.LoadAllFurnitureInDir(filepath.Join(datadir, "furniture"))
+    g.Current_floor = 1
+    mg := g.BuildGraph()
+    c.Expect(mg.Stale(), Equals, false)
+    crate := house.MakeFurniture("Crate Test")
+    left.Furniture = append(left.Furniture, crate)
+    c.Expect(mg.Stale(), Equals, true)
+
+    mg = g.BuildGraph()
+    left.Doors[0].Locked = true
+    c.Expect(mg.Stale(), Equals, true)
+    left.Doors[0].Locked = false
+    c.Expect(mg.Stale(), Equals, false)
+  })
+
+  c.Specify("Validate reports doors that are too wide for their wall.", func() {
+    h.Starting_floor = 1
+    wide := makeDoor(house.FarRight, 20)
+    left.Doors = append(left.Doors, wide)
+    c.Expect(len(h.Validate()), Equals, 2)
+    left.Doors = left.Doors[0:1]
+    c.Expect(len(h.Validate()), Equals, 1)
+  })
+
+  c.Specify("Doors can sit flush against either end of a wall.", func() {
+    room := makeRoom(1, 1)
+    fits := &house.HouseDef{Floors: []*house.Floor{&house.Floor{Rooms: []*house.Room{room}}}}
+    for _, facing := range []house.WallFacing{house.FarLeft, house.FarRight, house.NearLeft, house.NearRight} {
+      for _, pos := range []int{0, 2} {
+        d := &house.Door{Defname: "Wide Door Test", Facing: facing, Pos: pos}
+        d.Load()
+        room.Doors = append(room.Doors, d)
+      }
+    }
+    c.Expect(len(fits.Validate()), Equals, 0)
+    over := &house.Door{Defname: "Wide Door Test", Facing: house.FarLeft, Pos: 3}
+    over.Load()
+    room.Doors = append(room.Doors, over)
+    c.Expect(len(fits.Validate()), Equals, 1)
+
+    // The only place these rooms share wall is the last two cells of a's
+    // wall and the first two cells of b's.
+    a := makeRoom(1, 1)
+    b := makeRoom(5, 3)
+    f := &house.Floor{Rooms: []*house.Room{a, b}}
+    c.Expect(f.AutoConnect("Wide Door Test"), Equals, 1)
+    c.Expect(a.Doors[0].Pos, Equals, 2)
+    c.Expect(b.Doors[0].Pos, Equals, 0)
+  })
+
+  c.Specify("Doors on a near wall get a matching door on a far wall.", func() {
+    upper := makeRoom(1, 1)
+    lower := makeRoom(1, 5)
+    f := &house.Floor{Rooms: []*house.Room{upper, lower}}
+    door := makeDoor(house.NearRight, 1)
+    c.Expect(f.AddDoor(lower, door), Equals, true)
+    c.Expect(len(upper.Doors), Equals, 1)
+    c.Expect(upper.Doors[0].Facing, Equals, house.FarLeft)
+    c.Expect(upper.Doors[0].Pos, Equals, 1)
+    room, other := f.FindMatchingDoor(lower, door)
+    c.Expect(room == upper, Equals, true)
+    c.Expect(other == upper.Doors[0], Equals, true)
+
+    // There is nothing on the other side of this one.
+    c.Expect(f.AddDoor(lower, makeDoor(house.NearLeft, 1)), Equals, false)
+    c.Expect(len(lower.Doors), Equals, 1)
+  })
+
+  c.Specify("DoorsOnWall sorts doors by position and notices changed doors.", func() {
+    room := makeRoom(1, 1)
+    room.Doors = append(room.Doors, makeDoor(house.FarLeft, 2), makeDoor(house.FarRight, 1), makeDoor(house.FarLeft, 0))
+    far := room.DoorsOnWall(house.FarLeft)
+    c.Expect(len(far), Equals, 2)
+    c.Expect(far[0].Pos, Equals, 0)
+    c.Expect(far[1].Pos, Equals, 2)
+    c.Expect(len(room.DoorsOnWall(house.NearLeft)), Equals, 0)
+    room.Doors = append(room.Doors, makeDoor(house.NearLeft, 3))
+    room.DoorsChanged()
+    c.Expect(len(room.DoorsOnWall(house.NearLeft)), Equals, 1)
+
+    room.Doors[0].Pos = 0
+    room.Doors[2].Pos = 3
+    room.DoorsChanged()
+    moved := room.DoorsOnWall(house.FarLeft)
+    c.Expect(moved[0] == room.Doors[0], Equals, true)
+    c.Expect(moved[1] == room.Doors[2], Equals, true)
+    // Slices that were handed out before aren't changed
+    c.Expect(far[0] == room.Doors[2], Equals, true)
+  })
+
+  c.Specify("Rooms with no cells are not loaded.", func() {
+    names := make(map[string]bool)
+    for _, name := range house.GetAllRoomNames() {
+      names[name] = true
+    }
+    c.Expect(names["Room Test"], Equals, true)
+    c.Expect(names["Degenerate Test"], Equals, false)
+  })
+
+  c.Specify("FacingBetween finds the shared wall of offset rooms.", func() {
+    // a's corner cell at 2, 5 is next to b's cell at 2, 4, which isn't on
+    // b's near left wall even though a's cell is on a's.
+    a := makeRoom(2, 5)
+    b := makeRoom(1, 1)
+    facing, ok := house.FacingBetween(a, b, 2, 5, 2, 4)
+    c.Expect(ok, Equals, true)
+    c.Expect(facing, Equals, house.NearRight)
+    facing, ok = house.FacingBetween(b, a, 2, 4, 2, 5)
+    c.Expect(ok, Equals, true)
+    c.Expect(facing, Equals, house.FarLeft)
+
+    facing, ok = house.FacingBetween(a, b, 5, 5, 5, 4)
+    c.Expect(ok, Equals, false)
+    facing, ok = house.FacingBetween(a, b, 2, 5, 1, 4)
+    c.Expect(ok, Equals, false)
+    facing, ok = house.FacingBetween(a, a, 2, 5, 2, 6)
+    c.Expect(ok, Equals, false)
+
+    d := makeRoom(6, 6)
+    facing, ok = house.FacingBetween(a, d, 5, 6, 6, 6)
+    c.Expect(ok, Equals, true)
+    c.Expect(facing, Equals, house.FarRight)
+  })
+
+  c.Specify("AutoConnect places one pair of doors between adjacent rooms.", func() {
+    a := makeRoom(1, 1)
+    b := makeRoom(5, 1)
+    f := &house.Floor{Rooms: []*house.Room{a, b}}
+    c.Expect(f.AutoConnect("Door Test"), Equals, 1)
+    c.Expect(len(a.Doors), Equals, 1)
+    c.Expect(len(b.Doors), Equals, 1)
+    room, _ := f.FindMatchingDoor(a, a.Doors[0])
+    c.Expect(room == b, Equals, true)
+    c.Expect(f.AutoConnect("Door Test"), Equals, 0)
+  })
+}
@@ -6,7 +6,6 @@ import (
   "github.com/runningwild/haunts/base"
   "github.com/runningwild/haunts/house"
   "github.com/runningwild/haunts/mrgnet"
-  "math/rand"
   "sort"
 )
 
@@ -77,19 +76,162 @@ func (gp *GamePanel) Draw(region gui.Region) {
   defer region.PopClipPlanes()
 }
 
-func (g *Game) SpawnEntity(spawn *Entity, x, y int) bool {
+// Returns the side that the entity named defname is on, or false if there is
+// no such entity.
+func entitySide(defname string) (Side, bool) {
+  for _, name := range base.GetAllNamesInRegistry("entities") {
+    if name == defname {
+      ent := Entity{Defname: defname}
+      base.GetObject("entities", &ent)
+      return ent.Side(), true
+    }
+  }
+  return SideNone, false
+}
+
+// Makes a new entity from the registry and places it at x, y on the current
+// floor.  Fails if any of the cells it would cover aren't empty, or if side
+// is not SideNone and the entity isn't on that side.
+func (g *Game) SpawnEntity(defname string, side Side, x, y int) (*Entity, bool) {
+  ent_side, ok := entitySide(defname)
+  if !ok {
+    base.Error().Printf("Can't spawn '%s', no such entity.", defname)
+    return nil, false
+  }
+  if side != SideNone && ent_side != side {
+    base.Warn().Printf("Can't spawn '%s' on side %d, it is on side %d.", defname, side, ent_side)
+    return nil, false
+  }
+  def := Entity{Defname: defname}
+  base.GetObject("entities", &def)
+  dx, dy := def.Dims()
+  for cx := x; cx < x+dx; cx++ {
+    for cy := y; cy < y+dy; cy++ {
+      if !g.CanPlaceEntity(cx, cy) {
+        base.Warn().Printf("Can't spawn '%s' at (%d, %d) - an entity can't be placed there.", defname, x, y)
+        return nil, false
+      }
+    }
+  }
+  ent := MakeEntity(defname, g)
+  ent.X = float64(x)
+  ent.Y = float64(y)
+  ent.Info.RoomsExplored[ent.CurrentRoom()] = true
+  g.addEnt(ent)
+  g.UpdateEntLos(ent, true)
+  return ent, true
+}
+
+// Everything that changes Ents should go through addEnt, removeEnt, or
+// clearEnts so that EntsForSide stays up to date.
+func (g *Game) addEnt(ent *Entity) {
+  g.Ents = append(g.Ents, ent)
+  g.ents_dirty = true
+}
+
+// Returns false if ent wasn't in Ents.
+func (g *Game) removeEnt(ent *Entity) bool {
   for i := range g.Ents {
-    cx, cy := g.Ents[i].Pos()
-    if cx == x && cy == y {
-      base.Warn().Printf("Can't spawn entity at (%d, %d) - already occupied by '%s'.", x, y, g.Ents[i].Name)
-      return false
+    if g.Ents[i] == ent {
+      g.Ents = append(g.Ents[:i], g.Ents[i+1:]...)
+      g.ents_dirty = true
+      return true
     }
   }
-  spawn.X = float64(x)
-  spawn.Y = float64(y)
-  spawn.Info.RoomsExplored[spawn.CurrentRoom()] = true
-  g.Ents = append(g.Ents, spawn)
-  return true
+  return false
+}
+
+func (g *Game) clearEnts() {
+  g.Ents = nil
+  g.ents_dirty = true
+}
+
+// Returns every entity on side, living or dead, in the same order as they
+// are in Ents.  The returned slice is shared and must not be modified.
+func (g *Game) EntsForSide(side Side) []*Entity {
+  if g.ents_dirty || g.ents_by_side == nil {
+    g.ents_by_side = make(map[Side][]*Entity)
+    for _, ent := range g.Ents {
+      g.ents_by_side[ent.Side()] = append(g.ents_by_side[ent.Side()], ent)
+    }
+    g.ents_dirty = false
+  }
+  return g.ents_by_side[side]
+}
+
+// Removes ent from the game, anything it was carrying is left on the floor
+// where it was.
+func (g *Game) DespawnEntity(ent *Entity) {
+  if !g.removeEnt(ent) {
+    base.Warn().Printf("Tried to despawn '%s', but it wasn't in the game.", ent.Name)
+    return
+  }
+  g.viewer.RemoveDrawable(ent)
+  g.ClearQueue(ent)
+  for len(ent.Inventory) > 0 {
+    g.DropItem(ent, ent.Inventory[0])
+  }
+  if g.selected_ent == ent {
+    g.selected_ent = nil
+  }
+  if g.hovered_ent == ent {
+    g.hovered_ent = nil
+  }
+
+  // Think() releases anything that is no longer in the game.
+  delete(g.all_ents_in_game, ent)
+  g.buildActivationQueue()
+}
+
+// The longest, in ms, that a dead entity waits for its death animation before
+// it is despawned anyway, in case its sprite doesn't have one.
+const maxDeathAnimTime = 3000
+
+type dyingEnt struct {
+  ent       *Entity
+  remaining int64
+}
+
+// Despawns ent once its sprite has finished playing its death animation, so
+// that units don't vanish before they are seen to die.  Headless games have
+// nothing to watch, so they despawn ent right away.
+func (g *Game) despawnAfterDeath(ent *Entity) {
+  if g.headless || ent.Sprite() == nil || deathAnimDone(ent) {
+    g.DespawnEntity(ent)
+    return
+  }
+  g.dying = append(g.dying, dyingEnt{ent, maxDeathAnimTime})
+}
+
+func deathAnimDone(ent *Entity) bool {
+  return ent.Sprite().AnimState() == "killed" && ent.Sprite().Idle()
+}
+
+func (g *Game) isDying(ent *Entity) bool {
+  for _, d := range g.dying {
+    if d.ent == ent {
+      return true
+    }
+  }
+  return false
+}
+
+// Despawns any dying entities whose death animations have finished.
+func (g *Game) thinkDying(dt int64) {
+  dying := g.dying[0:0]
+  for _, d := range g.dying {
+    if g.EntityById(d.ent.Id) != d.ent {
+      // Something else already removed it
+      continue
+    }
+    d.remaining -= dt
+    if d.remaining <= 0 || deathAnimDone(d.ent) {
+      g.DespawnEntity(d.ent)
+    } else {
+      dying = append(dying, d)
+    }
+  }
+  g.dying = dying
 }
 
 // Returns true iff the action was set
@@ -153,31 +295,44 @@ func (gp *GamePanel) Respond(ui *gui.Gui, group gui.EventGroup) bool {
       gp.game.hovered_ent.hovered = false
     }
     gp.game.hovered_ent = nil
-    mx, my := cursor.Point()
-    for i := range gp.game.Ents {
-      fx, fy := gp.game.Ents[i].FPos()
-      wx, wy := gp.game.viewer.BoardToWindow(float32(fx), float32(fy))
-      if gp.game.Ents[i].Stats != nil && gp.game.Ents[i].Stats.HpCur() <= 0 {
-        continue // Don't bother showing dead units
-      }
-      x := wx - int(gp.game.Ents[i].last_render_width/2)
-      y := wy
-      x2 := wx + int(gp.game.Ents[i].last_render_width/2)
-      y2 := wy + int(150*gp.game.Ents[i].last_render_width/100)
-      if mx >= x && mx <= x2 && my >= y && my <= y2 {
-        if gp.game.hovered_ent != nil {
-          gp.game.hovered_ent.hovered = false
-        }
-        gp.game.hovered_ent = gp.game.Ents[i]
-        gp.game.hovered_ent.hovered = true
-      }
+    if ents := gp.game.entsAt(cursor.Point()); len(ents) > 0 {
+      gp.game.hovered_ent = ents[0]
+      gp.game.hovered_ent.hovered = true
     }
   }
 
-  if found, event := group.FindEvent(gin.Escape); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["toggle status"].Id()); found && event.Type == gin.Press {
+    gp.game.hide_status = !gp.game.hide_status
+    return true
+  }
+
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["toggle trail"].Id()); found && event.Type == gin.Press {
+    gp.game.SetTrailVisible(!gp.game.TrailVisible())
+    return true
+  }
+
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["frame floor"].Id()); found && event.Type == gin.Press {
+    gp.game.viewer.FrameFloor(gp.game.Current_floor)
+    return true
+  }
+
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["debug los"].Id()); found && event.Type == gin.Press {
+    if gp.game.debug_los != nil && gp.game.debug_los.ent == gp.game.selected_ent {
+      gp.game.DebugDrawEntityLos(nil)
+    } else {
+      gp.game.DebugDrawEntityLos(gp.game.selected_ent)
+    }
+    return true
+  }
+
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["cancel"].Id()); found && event.Type == gin.Press {
     if gp.game.selected_ent != nil {
       switch gp.game.Action_state {
       case noAction:
+        if gp.game.NumQueued(gp.game.selected_ent) > 0 {
+          gp.game.ClearQueue(gp.game.selected_ent)
+          return true
+        }
         gp.game.selected_ent.selected = false
         gp.game.selected_ent.hovered = false
         gp.game.selected_ent = nil
@@ -194,13 +349,9 @@ func (gp *GamePanel) Respond(ui *gui.Gui, group gui.EventGroup) bool {
   }
 
   if gp.game.Action_state == noAction {
-    if found, _ := group.FindEvent(gin.MouseLButton); found {
-      if gp.game.hovered_ent != nil && gp.game.hovered_ent.Side() == gp.game.Side {
-        if gp.game.selected_ent != nil {
-          gp.game.selected_ent.selected = false
-        }
-        gp.game.selected_ent = gp.game.hovered_ent
-        gp.game.selected_ent.selected = true
+    if found, event := group.FindEvent(base.GetDefaultKeyMap()["place"].Id()); found {
+      if event.Type == gin.Press {
+        gp.game.SelectAt(gin.In().GetCursor("Mouse").Point())
       }
       return true
     }
@@ -210,8 +361,13 @@ func (gp *GamePanel) Respond(ui *gui.Gui, group gui.EventGroup) bool {
     consumed, exec := gp.game.current_action.HandleInput(group, gp.game)
     if consumed {
       if exec != nil {
-        gp.game.current_exec = exec
-        // TODO: Should send the exec across the wire here
+        if gin.In().GetKey(gin.EitherShift).IsDown() {
+          // Shift-click plans the action instead of doing it right away
+          gp.game.queueCurrentAction(exec)
+        } else {
+          gp.game.current_exec = exec
+          // TODO: Should send the exec across the wire here
+        }
       }
       return true
     }
@@ -222,6 +378,12 @@ func (gp *GamePanel) Respond(ui *gui.Gui, group gui.EventGroup) bool {
   if gp.game.selected_ent == nil {
     return false
   }
+  if gp.game.Action_state == noAction {
+    if found, event := group.FindEvent(gin.Return); found && event.Type == gin.Press {
+      gp.game.CommitQueue(gp.game.selected_ent)
+      return true
+    }
+  }
   if gp.game.Action_state == noAction || gp.game.Action_state == preppingAction {
     if len(group.Events) == 1 && group.Events[0].Key.Id() >= '1' && group.Events[0].Key.Id() <= '9' {
       index := int(group.Events[0].Key.Id() - '1')
@@ -280,7 +442,7 @@ func spawnEnts(g *Game, ents []*Entity, spawns []*house.SpawnPoint) {
     sort.Sort(orderEntsBigToSmall(ents))
     //slightly shuffle the ents
     for i := range ents {
-      j := i + rand.Intn(5) - 2
+      j := i + int(g.Rand.Int63()%5) - 2
       if j >= 0 && j < len(ents) {
         ents[i], ents[j] = ents[j], ents[i]
       }
@@ -310,10 +472,10 @@ func spawnEnts(g *Game, ents []*Entity, spawns []*house.SpawnPoint) {
     base.Warn().Printf("Only able to place %d out of %d objects", len(places), len(spawns))
   }
   for _, place := range places {
-    place.ent.X = float64(place.spawn.X + rand.Intn(place.spawn.Dx-place.ent.Dx+1))
-    place.ent.Y = float64(place.spawn.Y + rand.Intn(place.spawn.Dy-place.ent.Dy+1))
+    place.ent.X = float64(place.spawn.X + int(g.Rand.Int63()%int64(place.spawn.Dx-place.ent.Dx+1)))
+    place.ent.Y = float64(place.spawn.Y + int(g.Rand.Int63()%int64(place.spawn.Dy-place.ent.Dy+1)))
     g.viewer.AddDrawable(place.ent)
-    g.Ents = append(g.Ents, place.ent)
+    g.addEnt(place.ent)
     base.Log().Printf("Using object '%s' at (%.0f, %.0f)", place.ent.Name, place.ent.X, place.ent.Y)
   }
 }
@@ -0,0 +1,62 @@
+package game
+
+import (
+  "sort"
+)
+
+type byInitiative []*Entity
+
+func (b byInitiative) Len() int      { return len(b) }
+func (b byInitiative) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byInitiative) Less(i, j int) bool {
+  ii := initiative(b[i])
+  ij := initiative(b[j])
+  if ii != ij {
+    return ii > ij
+  }
+  return b[i].Id < b[j].Id
+}
+
+func initiative(ent *Entity) int {
+  if ent.Stats == nil {
+    return 0
+  }
+  return ent.Stats.Initiative()
+}
+
+// Orders every living entity on the current side by initiative.  Ties are
+// broken by EntityId so that the order is the same on every client.
+func (g *Game) buildActivationQueue() {
+  g.activation = g.activation[0:0]
+  g.clearTrail()
+  for _, ent := range g.EntsForSide(g.Side) {
+    if ent.Stats == nil || ent.Stats.HpCur() <= 0 {
+      continue
+    }
+    g.activation = append(g.activation, ent)
+  }
+  sort.Sort(byInitiative(g.activation))
+}
+
+// Returns the entity whose activation it currently is, or nil if every
+// entity on the current side has finished.
+func (g *Game) CurrentEntity() *Entity {
+  for len(g.activation) > 0 {
+    ent := g.activation[0]
+    if g.EntityById(ent.Id) == ent && ent.Stats.HpCur() > 0 {
+      return ent
+    }
+    // Skip anything that has died or been removed since the queue was built
+    g.activation = g.activation[1:]
+  }
+  return nil
+}
+
+// Ends the current entity's activation so that the next entity in initiative
+// order can act.
+func (g *Game) EndActivation() {
+  if g.CurrentEntity() != nil {
+    g.activation = g.activation[1:]
+  }
+  g.clearTrail()
+}
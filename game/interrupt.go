@@ -0,0 +1,166 @@
+package game
+
+import (
+  "github.com/runningwild/haunts/base"
+  "sort"
+)
+
+// Readyable actions must also implement this so that the game can make an
+// exec for them when an interrupt is triggered.
+type InterruptAction interface {
+  Action
+
+  // Returns an exec for ent to use this action against target, or nil if
+  // target is not valid for this action.
+  InterruptExec(ent, target *Entity, g *Game) ActionExec
+}
+
+type suspendedAction struct {
+  action Action
+  ent    *Entity
+}
+
+type interruptData struct {
+  // Actions that have been paused while an interrupt is resolved.
+  suspended []suspendedAction
+
+  // Interrupts that have triggered but haven't run yet, in the order they
+  // will be run.
+  pending []ActionExec
+
+  // Exec to pass to the next call to Maintain on an interrupting action.
+  exec ActionExec
+
+  // The entity that was acting the last time interrupts were checked, and
+  // every enemy that could see it at that point.  Interrupts only trigger
+  // when an entity moves into view.
+  mover *Entity
+  seen  map[*Entity]bool
+}
+
+func (id *interruptData) active() bool {
+  return len(id.suspended) > 0
+}
+
+// Returns the entity that is executing the current action.
+func (g *Game) actingEntity() *Entity {
+  if g.current_action == nil {
+    return nil
+  }
+  for _, ent := range g.Ents {
+    if ent.current_action == g.current_action {
+      return ent
+    }
+  }
+  return nil
+}
+
+// Returns every living enemy of mover that can see it.
+func (g *Game) enemiesWatching(mover *Entity) map[*Entity]bool {
+  x, y := mover.Pos()
+  dx, dy := mover.Dims()
+  seen := make(map[*Entity]bool)
+  for _, ent := range g.Ents {
+    if ent == mover || ent.Side() == mover.Side() {
+      continue
+    }
+    if ent.Stats == nil || ent.Stats.HpCur() <= 0 {
+      continue
+    }
+    if ent.HasLos(x, y, dx, dy) {
+      seen[ent] = true
+    }
+  }
+  return seen
+}
+
+// Remembers which enemies can see mover before it starts acting, so that an
+// enemy that spots it on its first step can interrupt.
+func (g *Game) beginWatching(mover *Entity) {
+  g.interrupts.mover = mover
+  g.interrupts.seen = g.enemiesWatching(mover)
+}
+
+// Finds every enemy of mover that has just gained sight of it and has a
+// readied action that wants to interrupt.  Returns the execs for those
+// interrupts in initiative order.
+func (g *Game) resolveInterrupts(mover *Entity) []ActionExec {
+  seen := g.enemiesWatching(mover)
+  var interrupters []*Entity
+  for _, ent := range g.Ents {
+    if seen[ent] && g.interrupts.mover == mover && !g.interrupts.seen[ent] && ent.readied != nil {
+      interrupters = append(interrupters, ent)
+    }
+  }
+  g.interrupts.mover = mover
+  g.interrupts.seen = seen
+
+  sort.Sort(byInitiative(interrupters))
+  var execs []ActionExec
+  for _, ent := range interrupters {
+    if !ent.readied.Interrupt() {
+      continue
+    }
+    exec := ent.readied.(InterruptAction).InterruptExec(ent, mover, g)
+    if exec == nil {
+      continue
+    }
+    base.Log().Printf("Interrupt: %s interrupts %s", ent.Name, mover.Name)
+    ent.readied = nil
+    execs = append(execs, exec)
+  }
+  return execs
+}
+
+// Called when the current action returns CheckForInterrupts.
+func (g *Game) checkInterrupts() {
+  mover := g.actingEntity()
+  if mover == nil {
+    return
+  }
+  g.interrupts.pending = append(g.interrupts.pending, g.resolveInterrupts(mover)...)
+  if len(g.interrupts.pending) > 0 {
+    g.startInterrupt(mover)
+  }
+}
+
+// Suspends the current action and starts the next pending interrupt.
+func (g *Game) startInterrupt(mover *Entity) {
+  // Whatever the mover had planned next was planned without knowing about
+  // this.
+  g.ClearQueue(mover)
+  exec := g.interrupts.pending[0]
+  g.interrupts.pending = g.interrupts.pending[1:]
+  ent := g.EntityById(exec.EntityId())
+  g.interrupts.suspended = append(g.interrupts.suspended, suspendedAction{g.current_action, mover})
+  g.viewer.RemoveFloorDrawable(g.current_action)
+  g.current_action = ent.Actions[exec.ActionIndex()]
+  g.viewer.AddFloorDrawable(g.current_action)
+  ent.current_action = g.current_action
+  g.interrupts.exec = exec
+}
+
+// Called when an interrupting action completes.  Runs the next pending
+// interrupt if there is one, otherwise resumes the action that was
+// interrupted.
+func (g *Game) finishInterrupt() {
+  g.startCooldown()
+  g.current_action.Cancel()
+  g.viewer.RemoveFloorDrawable(g.current_action)
+  last := len(g.interrupts.suspended) - 1
+  sa := g.interrupts.suspended[last]
+  g.interrupts.suspended = g.interrupts.suspended[0:last]
+  g.current_action = sa.action
+  g.viewer.AddFloorDrawable(g.current_action)
+
+  if sa.ent.Stats != nil && sa.ent.Stats.HpCur() <= 0 {
+    // No point in continuing to move a dead entity
+    g.interrupts.pending = nil
+    g.interrupts.mover = nil
+    g.completeAction()
+    return
+  }
+  if len(g.interrupts.pending) > 0 {
+    g.startInterrupt(sa.ent)
+  }
+}
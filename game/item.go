@@ -0,0 +1,148 @@
+package game
+
+import (
+  gl "github.com/chsc/gogl/gl21"
+  "github.com/runningwild/haunts/base"
+  "github.com/runningwild/haunts/game/status"
+  "github.com/runningwild/haunts/texture"
+  "strings"
+)
+
+type itemDef struct {
+  Name string
+
+  // If this is set then the item is a key, and whoever is carrying it can
+  // open any locked door with this key.
+  Key string
+
+  // Applied to whoever is carrying the item.  The Source of each is ignored,
+  // they are all attached with the item as their source.
+  Modifiers []status.Modifier
+
+  // Drawn on the floor when nobody is carrying the item
+  Texture texture.Object
+}
+
+// Something that an entity can pick up and carry around with it.  While an
+// item is lying on the floor X and Y are the cell it is in, they aren't
+// meaningful while it is being carried.
+type Item struct {
+  Defname string
+  *itemDef
+
+  X, Y int
+}
+
+func LoadAllItemsInDir(dir string) {
+  base.RemoveRegistry("items")
+  base.RegisterRegistry("items", make(map[string]*itemDef))
+  base.RegisterAllObjectsInDir("items", dir, ".json", "json")
+}
+
+func MakeItem(name string) *Item {
+  i := Item{Defname: name}
+  base.GetObject("items", &i)
+  return &i
+}
+
+func GetAllItemNames() []string {
+  return base.GetAllNamesInRegistry("items")
+}
+
+func (i *Item) Pos() (int, int) {
+  return i.X, i.Y
+}
+func (i *Item) Dims() (int, int) {
+  return 1, 1
+}
+func (i *Item) RenderOnFloor() {
+  gl.Color4ub(255, 255, 255, 255)
+  i.Texture.Data().Render(float64(i.X), float64(i.Y), 1, 1)
+}
+
+// Returns the items lying on the floor in the cell at x, y.
+func (g *Game) ItemsAt(x, y int) []*Item {
+  var items []*Item
+  for _, item := range g.Items {
+    if item.X == x && item.Y == y {
+      items = append(items, item)
+    }
+  }
+  return items
+}
+
+// Puts item on the floor at x, y.
+func (g *Game) PlaceItem(item *Item, x, y int) {
+  item.X = x
+  item.Y = y
+  g.Items = append(g.Items, item)
+  g.viewer.AddFloorDrawable(item)
+}
+
+// Moves item from the floor into ent's inventory.  Returns false if item
+// isn't on the floor.
+func (g *Game) PickUpItem(ent *Entity, item *Item) bool {
+  for i := range g.Items {
+    if g.Items[i] != item {
+      continue
+    }
+    g.Items = append(g.Items[:i], g.Items[i+1:]...)
+    g.viewer.RemoveFloorDrawable(item)
+    ent.Inventory = append(ent.Inventory, item)
+    ent.refreshItemModifiers()
+    g.Notify(Event{Kind: EventItemPickedUp, Ent: ent, Item: item})
+    return true
+  }
+  return false
+}
+
+// Moves item from ent's inventory onto the floor in the cell ent is in.
+// Returns false if ent isn't carrying item.
+func (g *Game) DropItem(ent *Entity, item *Item) bool {
+  for i := range ent.Inventory {
+    if ent.Inventory[i] != item {
+      continue
+    }
+    ent.Inventory = append(ent.Inventory[:i], ent.Inventory[i+1:]...)
+    ent.refreshItemModifiers()
+    x, y := ent.Pos()
+    g.PlaceItem(item, x, y)
+    return true
+  }
+  return false
+}
+
+// Returns the names of all of the keys ent has, including those from any
+// items it is carrying.
+func (e *Entity) KeyNames() []string {
+  keys := append([]string{}, e.Keys...)
+  for _, item := range e.Inventory {
+    if item.Key != "" {
+      keys = append(keys, item.Key)
+    }
+  }
+  return keys
+}
+
+// Prefix of the Source of every modifier that comes from an item.
+const itemModifierSource = "item:"
+
+// Makes sure that ent's stats have the modifiers from exactly the items it is
+// carrying.  Item modifiers aren't saved with the stats, so this also needs
+// to be called when an entity's inventory is loaded.
+func (e *Entity) refreshItemModifiers() {
+  if e.Stats == nil {
+    return
+  }
+  for _, m := range e.Stats.Modifiers() {
+    if strings.HasPrefix(m.Source, itemModifierSource) {
+      e.Stats.RemoveModifiers(m.Source)
+    }
+  }
+  for _, item := range e.Inventory {
+    for _, m := range item.Modifiers {
+      m.Source = itemModifierSource + item.Defname
+      e.Stats.AddModifier(m)
+    }
+  }
+}
@@ -0,0 +1,128 @@
+package game
+
+import (
+  "github.com/runningwild/haunts/house"
+)
+
+// Entities can see this many cells into a dark room, anything farther away
+// has to be lit for them to see it.
+const darkSight = 2
+
+// Recomputes which cells on the current floor are lit and which are dark.
+func (g *Game) updateLights() {
+  g.los.lights_dirty = false
+  g.los.lights_floor = g.Current_floor
+  for i := range g.los.full_lit {
+    g.los.full_lit[i] = false
+    g.los.full_dark[i] = false
+    g.los.full_ambient[i] = 0
+  }
+  floor := g.CurrentFloor()
+  for _, room := range floor.Rooms {
+    if !room.Dark && room.Ambient_light == 0 {
+      continue
+    }
+    for x := room.X; x < room.X+room.Size.Dx; x++ {
+      for y := room.Y; y < room.Y+room.Size.Dy; y++ {
+        if x >= 0 && y >= 0 && x < len(g.los.dark) && y < len(g.los.dark[x]) && room.Contains(x, y) {
+          g.los.dark[x][y] = room.Dark
+          g.los.ambient[x][y] = room.Ambient_light
+        }
+      }
+    }
+  }
+
+  // A light is just like an entity that can't move, so its light uses the
+  // same los as everything else.  The merger is free to use here, it is
+  // cleared before it is used to merge anything.
+  for _, room := range floor.Rooms {
+    for _, furn := range room.Furniture {
+      if furn.Light_radius <= 0 {
+        continue
+      }
+      fx, fy := furn.Pos()
+      g.DetermineLos(room.X+fx, room.Y+fy, furn.Light_radius, g.los.merger)
+      for i := range g.los.full_merger {
+        if g.los.full_merger[i] {
+          g.los.full_lit[i] = true
+        }
+      }
+    }
+  }
+  for i := range g.los.full_merger {
+    g.los.full_merger[i] = false
+  }
+}
+
+// Returns true if the cell at x, y is in a dark room, isn't lit, and is too
+// far away to be seen by something at ex, ey.
+func (g *Game) tooDarkToSee(ex, ey, x, y int) bool {
+  if x < 0 || y < 0 || x >= len(g.los.dark) || y >= len(g.los.dark[x]) {
+    return false
+  }
+  if !g.los.dark[x][y] || g.los.lit[x][y] {
+    return false
+  }
+  dx := x - ex
+  if dx < 0 {
+    dx = -dx
+  }
+  dy := y - ey
+  if dy < 0 {
+    dy = -dy
+  }
+  return dx > darkSight || dy > darkSight
+}
+
+// Returns the ambient light of the room that the cell at x, y is in, or 0 if
+// it isn't in a room with any.
+func (g *Game) AmbientLight(x, y int) byte {
+  if x < 0 || y < 0 || x >= len(g.los.ambient) || y >= len(g.los.ambient[x]) {
+    return 0
+  }
+  if g.los.lights_dirty || g.los.lights_floor != g.Current_floor {
+    g.updateLights()
+  }
+  return g.los.ambient[x][y]
+}
+
+// Raises every cell in pix to at least the ambient light of its room.
+// Returns true if anything in pix changed.
+func (g *Game) applyAmbientLight(pix [][]byte) bool {
+  if g.los.lights_dirty || g.los.lights_floor != g.Current_floor {
+    g.updateLights()
+  }
+  mod := false
+  for i := range pix {
+    for j := range pix[i] {
+      if pix[i][j] < g.los.ambient[i][j] {
+        pix[i][j] = g.los.ambient[i][j]
+        mod = true
+      }
+    }
+  }
+  return mod
+}
+
+// Lights fill the room they are in, so every lit cell in the room that ent is
+// standing in is visible to it, even if it is beyond ent's sight.
+func (g *Game) mergeLitRoom(ent *Entity) {
+  ex, ey := ent.Pos()
+  room := roomAt(g.CurrentFloor(), ex, ey)
+  if room == nil {
+    return
+  }
+  for x := room.X; x < room.X+room.Size.Dx; x++ {
+    for y := room.Y; y < room.Y+room.Size.Dy; y++ {
+      if x >= 0 && y >= 0 && x < len(g.los.lit) && y < len(g.los.lit[x]) && g.los.lit[x][y] && room.Contains(x, y) {
+        g.los.merger[x][y] = true
+      }
+    }
+  }
+}
+
+// Sets whether or not room is dark.
+func (g *Game) SetRoomDark(room *house.Room, dark bool) {
+  room.Dark = dark
+  g.RecalcLos()
+}
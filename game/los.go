@@ -13,6 +13,7 @@ import (
   "github.com/runningwild/haunts/mrgnet"
   "reflect"
   "regexp"
+  "sync"
   "time"
 )
 
@@ -83,7 +84,7 @@ func (wp *waypoint) RenderOnFloor() {
     return
   }
   wp.drawn = true
-  gl.Color4ub(200, 0, 0, 128)
+  house.CurrentPalette().Waypoint.Set()
   base.EnableShader("waypoint")
   base.SetUniformF("waypoint", "radius", float32(wp.Radius))
 
@@ -105,7 +106,69 @@ func (wp *waypoint) RenderOnFloor() {
   // base.EnableShader("")
 }
 
+// Tints every cell in a single entity's los, before it is merged with the
+// rest of its side's.  Only used for debugging, see DebugDrawEntityLos.
+type entityLosDrawer struct {
+  ent *Entity
+}
+
+func (ld *entityLosDrawer) Dims() (int, int) {
+  if ld.ent.los == nil {
+    return 0, 0
+  }
+  return ld.ent.los.maxx - ld.ent.los.minx + 1, ld.ent.los.maxy - ld.ent.los.miny + 1
+}
+func (ld *entityLosDrawer) Pos() (int, int) {
+  if ld.ent.los == nil {
+    return 0, 0
+  }
+  return ld.ent.los.minx, ld.ent.los.miny
+}
+func (ld *entityLosDrawer) RenderOnFloor() {
+  los := ld.ent.los
+  if los == nil {
+    return
+  }
+  gl.Disable(gl.TEXTURE_2D)
+  house.CurrentPalette().Debug_los.Set()
+  gl.Begin(gl.QUADS)
+  for x := los.minx; x <= los.maxx; x++ {
+    for y := los.miny; y <= los.maxy; y++ {
+      if x < 0 || y < 0 || x >= len(los.grid) || y >= len(los.grid[x]) || !los.grid[x][y] {
+        continue
+      }
+      gl.Vertex2i(int32(x), int32(y))
+      gl.Vertex2i(int32(x), int32(y+1))
+      gl.Vertex2i(int32(x+1), int32(y+1))
+      gl.Vertex2i(int32(x+1), int32(y))
+    }
+  }
+  gl.End()
+  gl.Enable(gl.TEXTURE_2D)
+}
+
+// Shows exactly which cells ent can see, as determined by DetermineLos, on
+// top of whatever los is already being shown.  Only one entity's los is
+// shown at a time, passing nil turns it off.
+func (g *Game) DebugDrawEntityLos(ent *Entity) {
+  if g.debug_los != nil {
+    g.viewer.RemoveFloorDrawable(g.debug_los)
+    g.debug_los = nil
+  }
+  if ent != nil {
+    g.debug_los = &entityLosDrawer{ent}
+    g.viewer.AddFloorDrawable(g.debug_los)
+  }
+}
+
 type gameDataTransient struct {
+  // The entity whose los is being shown by DebugDrawEntityLos, if any.
+  debug_los *entityLosDrawer
+
+  // Where the current entity has moved this activation, see recordTrail.
+  trail      movementTrail
+  show_trail bool
+
   los struct {
     denizens, intruders sideLosData
 
@@ -113,6 +176,25 @@ type gameDataTransient struct {
     // keep it around to avoid reallocating it every time we need it.
     full_merger []bool
     merger      [][]bool
+
+    // Cells on the current floor that are lit by a light source, and cells
+    // that are in a dark room.  These only change when doors or rooms do, so
+    // they are only recomputed after RecalcLos().
+    full_lit, full_dark []bool
+    lit, dark           [][]bool
+
+    // The Ambient_light of the room each cell is in, also only recomputed
+    // after RecalcLos().
+    full_ambient []byte
+    ambient      [][]byte
+
+    lights_dirty bool
+    lights_floor int
+
+    // Everything is visible in this texture, it is shown when pov is PovAll.
+    all *house.LosTexture
+
+    pov PovMode
   }
 
   // Used to sync up with the script, the value passed is usually nil, but
@@ -133,19 +215,65 @@ type gameDataTransient struct {
     game *mrgnet.Game
     side Side
   }
+
+  interrupts interruptData
+
+  // Milliseconds that the current action has been InProgress for.
+  action_time int64
+
+  // Ents grouped by side, this is rebuilt by EntsForSide whenever Ents has
+  // changed.
+  ents_by_side map[Side][]*Entity
+  ents_dirty   bool
+
+  // Kept by Graph until it goes stale.  The ais call Graph from their own
+  // goroutines, so move_graph is only touched with move_graph_mutex held.
+  move_graph       *MoveGraph
+  move_graph_mutex sync.Mutex
+
+  // Kept by placedTriggers until the floor or the triggers on it change.
+  trigger_cache triggerCache
+
+  // Headless games never touch OpenGl, so they can run without a window.
+  headless bool
+
+  // Dead entities that are left on the board until their death animation
+  // finishes, see despawnAfterDeath.
+  dying []dyingEnt
 }
 
 func (gdt *gameDataTransient) alloc() {
   if gdt.los.denizens.tex != nil {
     return
   }
-  gdt.los.denizens.tex = house.MakeLosTexture()
-  gdt.los.intruders.tex = house.MakeLosTexture()
+  makeTex := house.MakeLosTexture
+  if gdt.headless {
+    makeTex = house.MakeHeadlessLosTexture
+  }
+  gdt.los.denizens.tex = makeTex()
+  gdt.los.intruders.tex = makeTex()
+  gdt.los.all = makeTex()
+  gdt.los.all.Clear(255)
+  gdt.los.all.Remap()
   gdt.los.full_merger = make([]bool, house.LosTextureSizeSquared)
   gdt.los.merger = make([][]bool, house.LosTextureSize)
   for i := range gdt.los.merger {
     gdt.los.merger[i] = gdt.los.full_merger[i*house.LosTextureSize : (i+1)*house.LosTextureSize]
   }
+  gdt.los.full_lit = make([]bool, house.LosTextureSizeSquared)
+  gdt.los.full_dark = make([]bool, house.LosTextureSizeSquared)
+  gdt.los.lit = make([][]bool, house.LosTextureSize)
+  gdt.los.dark = make([][]bool, house.LosTextureSize)
+  for i := range gdt.los.lit {
+    gdt.los.lit[i] = gdt.los.full_lit[i*house.LosTextureSize : (i+1)*house.LosTextureSize]
+    gdt.los.dark[i] = gdt.los.full_dark[i*house.LosTextureSize : (i+1)*house.LosTextureSize]
+  }
+  gdt.los.full_ambient = make([]byte, house.LosTextureSizeSquared)
+  gdt.los.ambient = make([][]byte, house.LosTextureSize)
+  for i := range gdt.los.ambient {
+    gdt.los.ambient[i] = gdt.los.full_ambient[i*house.LosTextureSize : (i+1)*house.LosTextureSize]
+  }
+  gdt.los.lights_dirty = true
 
   gdt.comm.script_to_game = make(chan interface{}, 1)
   gdt.comm.game_to_script = make(chan interface{}, 1)
@@ -194,13 +322,47 @@ type gameDataGobbable struct {
   // indicates that a complete round has happened.
   Turn int
 
+  // Index into House.Floors of the floor that is being played on.
+  Current_floor int
+
   // PRNG, need it here so that we serialize it along with everything
-  // else so that replays work properly.
+  // else so that replays work properly.  Anything random that affects the
+  // game must come from here rather than from math/rand.
   Rand *cmwc.Cmwc
 
   // Waypoints, used for signaling things to the player on the map
   Waypoints []waypoint
 
+  // Items lying on the floor, items that are being carried are kept in their
+  // entity's Inventory instead.
+  Items []*Item
+
+  // Rounds remaining before an entity can use an action again, indexed by
+  // entity and then by action name.
+  Cooldowns map[EntityId]map[string]int
+
+  // Keys of the triggers that have fired, see placedTriggers.
+  Fired_triggers map[string]bool
+
+  // How this scenario is won, and whether it has been yet.
+  Victory  *Victory
+  Finished bool
+  Winner   Side
+
+  // How the fog of war fades in and out, nil uses defaultLosConfig.
+  Los_config *LosConfig
+
+  // If set then los and shots can't pass diagonally between two cells if
+  // either of the cells at that corner would block them.  Without it they
+  // are only stopped at a corner by walls, so they can slip between two
+  // rooms that only touch at a corner, or between two pieces of furniture.
+  Los_supercover bool
+
+  // Milliseconds that an action can keep returning InProgress before it is
+  // cancelled, 0 uses defaultMaxActionTime.  Scenarios with very long
+  // animations may need to raise this.
+  Max_action_time int64
+
   // Transient data - none of the following are exported
 
   player_inactive bool
@@ -213,6 +375,16 @@ type gameDataGobbable struct {
   selected_ent *Entity
   hovered_ent  *Entity
 
+  // If set entities are drawn without their health bars and condition icons
+  hide_status bool
+
+  // The message from the last trigger that had one, and how many more
+  // milliseconds to show it for.
+  message struct {
+    text      string
+    remaining int64
+  }
+
   // Stores the current acting entity - if it is an Ai controlled entity
   ai_ent *Entity
 
@@ -226,8 +398,33 @@ type gameDataGobbable struct {
   // If an Ai is executing currently it is referenced here
   active_ai Ai
 
+  // Entities on the current side that have yet to finish acting this turn,
+  // in the order that they will act.
+  activation []*Entity
+
   current_exec   ActionExec
   current_action Action
+
+  // Actions that have been planned but not yet run, and the entity whose
+  // queue is being run, if any.
+  queued        map[*Entity][]ActionExec
+  running_queue *Entity
+
+  // Everything that has called Subscribe
+  observers []func(Event)
+
+  // Everything that has called OnRoundStart or OnGameStart
+  round_start []func(turn int, side Side)
+  game_start  []func()
+
+  // Everything that has been recorded by Notify, and the state of the game
+  // when recording for replays started.  Entries before first happened
+  // before then.
+  log struct {
+    entries []LogEntry
+    start   []byte
+    first   int
+  }
 }
 
 type Game struct {
@@ -257,13 +454,22 @@ func (g *Game) GobDecode(data []byte) error {
   if err := dec.Decode(&g.gameDataGobbable); err != nil {
     return err
   }
+  g.ents_dirty = true
 
   base.ProcessObject(reflect.ValueOf(g.House), "")
   g.House.Normalize()
   g.viewer = house.MakeHouseViewer(g.House, 62)
   g.viewer.Edit_mode = true
+  g.viewer.Measure_cost = g.measureCost
   for _, ent := range g.Ents {
     base.GetObject("entities", ent)
+    for _, item := range ent.Inventory {
+      base.GetObject("items", item)
+    }
+    ent.refreshItemModifiers()
+  }
+  for _, item := range g.Items {
+    base.GetObject("items", item)
   }
 
   g.setup()
@@ -361,7 +567,9 @@ func (g *Game) SelectEnt(ent *Entity) bool {
   if g.selected_ent != nil {
     g.selected_ent.selected = true
   }
-  g.viewer.Focus(ent.FPos())
+  if x, y := ent.Pos(); !g.viewer.OnScreen(x, y) {
+    g.viewer.CenterOn(x, y)
+  }
   return true
 }
 
@@ -377,28 +585,45 @@ func (g *Game) OnBegin() {
 func (g *Game) PlaceInitialExplorers(ents []*Entity) {
 }
 
-func (g *Game) checkWinConditions() {
-  return
-  // Check for explorer win conditions
-  explorer_win := false
+// How the viewer decides whose fog of war to show.
+type PovMode int
 
-  if explorer_win {
-    base.Log().Printf("Explorers won - kaboom")
-  }
+const (
+  // Shows whichever side was last passed to SetVisibility.
+  PovFixed PovMode = iota
 
-  // Check for haunt win condition - all intruders dead
-  haunts_win := true
-  for i := range g.Ents {
-    if g.Ents[i].Side() == SideExplorers {
-      haunts_win = false
-    }
-  }
-  if haunts_win {
-    base.Log().Printf("Haunts won - kaboom")
+  // Shows the side whose turn it is, switching at the start of every turn.
+  PovTurn
+
+  // Shows everything, for spectators.
+  PovAll
+)
+
+func (g *Game) SetPovMode(mode PovMode) {
+  g.los.pov = mode
+  g.updatePov()
+}
+
+func (g *Game) PovMode() PovMode {
+  return g.los.pov
+}
+
+func (g *Game) updatePov() {
+  switch g.los.pov {
+  case PovTurn:
+    g.showSide(g.Side)
+  case PovAll:
+    g.viewer.Los_tex = g.los.all
   }
 }
 
+// Shows side's fog of war and stops following the turn, if it was.
 func (g *Game) SetVisibility(side Side) {
+  g.los.pov = PovFixed
+  g.showSide(side)
+}
+
+func (g *Game) showSide(side Side) {
   switch side {
   case SideHaunt:
     g.viewer.Los_tex = g.los.denizens.tex
@@ -437,13 +662,18 @@ func (g *Game) OnRound(do_scripts bool) {
       base.Log().Printf("OnRound from %d Denizens to %d Intruders", g.Turn-1, g.Turn)
       g.Side = SideExplorers
     }
+    g.updatePov()
     g.viewer.Los_tex.Remap()
+    g.startReplay()
+    g.Notify(Event{Kind: EventTurnChanged, Turn: g.Turn, Side: g.Side})
+    for _, f := range g.round_start {
+      f(g.Turn, g.Side)
+    }
   }
 
-  for i := range g.Ents {
-    if g.Ents[i].Side() == g.Side {
-      g.Ents[i].OnRound()
-    }
+  for _, ent := range g.EntsForSide(g.Side) {
+    ent.OnRound()
+    g.tickCooldowns(ent)
   }
 
   // The entity ais must be activated before the master ais, otherwise the
@@ -465,16 +695,20 @@ func (g *Game) OnRound(do_scripts bool) {
     }
   }
 
+  var dead []*Entity
   for i := range g.Ents {
-    if g.Ents[i].Stats != nil && g.Ents[i].Stats.HpCur() <= 0 {
-      g.viewer.RemoveDrawable(g.Ents[i])
+    if g.Ents[i].Stats != nil && g.Ents[i].Stats.HpCur() <= 0 && !g.isDying(g.Ents[i]) {
+      dead = append(dead, g.Ents[i])
     }
   }
-  algorithm.Choose2(&g.Ents, func(ent *Entity) bool {
-    return ent.Stats == nil || ent.Stats.HpCur() > 0
-  })
+  for _, ent := range dead {
+    g.Notify(Event{Kind: EventEntityDied, Ent: ent})
+    g.despawnAfterDeath(ent)
+  }
+  g.buildActivationQueue()
+  g.checkWinConditions()
 
-  if do_scripts {
+  if do_scripts && g.script != nil {
     g.script.OnRound(g)
   }
 
@@ -512,140 +746,164 @@ func (g *Game) GetViewer() *house.HouseViewer {
   return g.viewer
 }
 
+// Returns the floor that all of the graph and los functions operate on.
+func (g *Game) CurrentFloor() *house.Floor {
+  return g.House.Floors[g.Current_floor]
+}
+
 func (g *Game) numVertex() int {
   total := 0
-  for _, room := range g.House.Floors[0].Rooms {
+  for _, room := range g.CurrentFloor().Rooms {
+    if room.Degenerate() {
+      continue
+    }
     total += room.Size.Dx * room.Size.Dy
   }
   return total
 }
 func (g *Game) FromVertex(v int) (room *house.Room, x, y int) {
-  for _, room := range g.House.Floors[0].Rooms {
+  for _, room := range g.CurrentFloor().Rooms {
+    if room.Degenerate() {
+      continue
+    }
     size := room.Size.Dx * room.Size.Dy
     if v >= size {
       v -= size
       continue
     }
-    return room, room.X + (v % room.Size.Dx), room.Y + (v / room.Size.Dx)
+    x, y := room.ToFloor(v%room.Size.Dx, v/room.Size.Dx)
+    return room, x, y
   }
   return nil, 0, 0
 }
 func (g *Game) ToVertex(x, y int) int {
   v := 0
-  for _, room := range g.House.Floors[0].Rooms {
-    if x >= room.X && y >= room.Y && x < room.X+room.Size.Dx && y < room.Y+room.Size.Dy {
-      x -= room.X
-      y -= room.Y
-      v += x + y*room.Size.Dx
+  for _, room := range g.CurrentFloor().Rooms {
+    if room.Contains(x, y) {
+      lx, ly := room.ToLocal(x, y)
+      v += lx + ly*room.Size.Dx
       break
     }
-    v += room.Size.Dx * room.Size.Dy
+    if !room.Degenerate() {
+      v += room.Size.Dx * room.Size.Dy
+    }
   }
   return v
 }
 
-// x and y are given in room coordinates
-func furnitureAt(room *house.Room, x, y int) *house.Furniture {
+// Returns true if any furniture in the cell at x, y, given in room
+// coordinates, blocks shots if shot is true, or blocks los for a line that
+// has gone i cells otherwise.  Walkable furniture, like a rug, might share a
+// cell with something else, so every piece in the cell is checked.
+func furnitureBlocksLine(room *house.Room, x, y, i int, shot bool) bool {
   for _, f := range room.Furniture {
     fx, fy := f.Pos()
     fdx, fdy := f.Dims()
-    if x >= fx && x < fx+fdx && y >= fy && y < fy+fdy {
-      return f
+    if x < fx || x >= fx+fdx || y < fy || y >= fy+fdy {
+      continue
+    }
+    if (shot && f.Blocks_shot) || (!shot && f.BlocksLosAt(i)) {
+      return true
     }
   }
-  return nil
+  return false
+}
+
+// Returns true if any furniture that blocks movement is in the cell at x, y,
+// given in room coordinates.
+func furnitureBlocksMove(room *house.Room, x, y int) bool {
+  for _, f := range room.Furniture {
+    fx, fy := f.Pos()
+    fdx, fdy := f.Dims()
+    if x >= fx && x < fx+fdx && y >= fy && y < fy+fdy && f.BlocksMove() {
+      return true
+    }
+  }
+  return false
 }
 
 // x and y are given in floor coordinates
 func roomAt(floor *house.Floor, x, y int) *house.Room {
   for _, room := range floor.Rooms {
-    rx, ry := room.Pos()
-    rdx, rdy := room.Dims()
-    if x >= rx && x < rx+rdx && y >= ry && y < ry+rdy {
+    if room.Contains(x, y) {
       return room
     }
   }
   return nil
 }
 
+// Returns true if an entity can move between the adjacent cells x, y in r
+// and x2, y2 in r2.  Doors only allow movement once they are completely open,
+// and locked doors never do.
 func connected(r, r2 *house.Room, x, y, x2, y2 int) bool {
   if r == r2 {
     return true
   }
-  x -= r.X
-  y -= r.Y
-  x2 -= r2.X
-  y2 -= r2.Y
-  var facing house.WallFacing
-  if x == 0 && x2 != 0 {
-    facing = house.NearLeft
-  } else if y == 0 && y2 != 0 {
-    facing = house.NearRight
-  } else if x != 0 && x2 == 0 {
-    facing = house.FarRight
-  } else if y != 0 && y2 == 0 {
-    facing = house.FarLeft
-  } else {
-    // This shouldn't happen, but in case it does we certainly shouldn't treat
-    // it as an open door
-    return false
+  door := doorBetween(r, r2, x, y, x2, y2)
+  return door != nil && !door.Locked && door.IsOpened()
+}
+
+// Like connected, but for los, which can pass through a door before it has
+// finished opening.
+func losConnected(r, r2 *house.Room, x, y, x2, y2 int) bool {
+  if r == r2 {
+    return true
   }
-  for _, door := range r.Doors {
-    if door.Facing != facing {
-      continue
-    }
-    var pos int
-    switch facing {
-    case house.NearLeft:
-      fallthrough
-    case house.FarRight:
-      pos = y
+  door := doorBetween(r, r2, x, y, x2, y2)
+  return door != nil && door.IsLosOpened()
+}
 
-    case house.NearRight:
-      fallthrough
-    case house.FarLeft:
-      pos = x
+// Returns the door in r that sits between the adjacent cells x, y in r and
+// x2, y2 in r2, or nil if there isn't one.
+func doorBetween(r, r2 *house.Room, x, y, x2, y2 int) *house.Door {
+  facing, ok := house.FacingBetween(r, r2, x, y, x2, y2)
+  if !ok {
+    return nil
+  }
+  x, y = r.ToLocal(x, y)
+  pos := x
+  if facing == house.NearLeft || facing == house.FarRight {
+    pos = y
+  }
+  for _, door := range r.DoorsOnWall(facing) {
+    if pos < door.Pos {
+      // Doors are sorted by Pos, so none of the rest can contain pos
+      break
     }
-    if pos >= door.Pos && pos < door.Pos+door.Width {
-      return door.IsOpened()
+    if pos < door.Pos+door.Width {
+      return door
     }
   }
-  return false
+  return nil
 }
 
 func (g *Game) IsCellOccupied(x, y int) bool {
-  r := roomAt(g.House.Floors[0], x, y)
+  return !g.CanPlaceEntity(x, y)
+}
+
+// Returns true if an entity could stand in the cell at x, y.  The cell must
+// be part of a room on the current floor, and can't have furniture that
+// blocks movement or any part of another entity in it.
+func (g *Game) CanPlaceEntity(x, y int) bool {
+  r := roomAt(g.CurrentFloor(), x, y)
   if r == nil {
-    return true
+    return false
   }
-  f := furnitureAt(r, x-r.X, y-r.Y)
-  if f != nil {
-    return true
+  if lx, ly := r.ToLocal(x, y); furnitureBlocksMove(r, lx, ly) {
+    return false
   }
   for _, ent := range g.Ents {
     ex, ey := ent.Pos()
-    if x == ex && y == ey {
-      return true
+    edx, edy := ent.Dims()
+    if x >= ex && y >= ey && x < ex+edx && y < ey+edy {
+      return false
     }
   }
-  return false
-}
-
-type exclusionGraph struct {
-  side Side
-  los  bool
-  ex   map[*Entity]bool
-  g    *Game
-}
-
-func (eg *exclusionGraph) Adjacent(v int) ([]int, []float64) {
-  return eg.g.adjacent(v, eg.los, eg.side, eg.ex)
-}
-func (eg *exclusionGraph) NumVertex() int {
-  return eg.g.numVertex()
+  return true
 }
 
 func (g *Game) RecalcLos() {
+  g.los.lights_dirty = true
   for i := range g.Ents {
     if g.Ents[i].los != nil {
       g.Ents[i].los.x = -1
@@ -653,6 +911,41 @@ func (g *Game) RecalcLos() {
   }
 }
 
+// Like RecalcLos, but only entities that might be able to see something
+// within radius cells of x, y will have their los recomputed.
+func (g *Game) InvalidateLosNear(x, y, radius int) {
+  g.los.lights_dirty = true
+  for _, ent := range g.Ents {
+    if ent.los == nil || ent.Stats == nil {
+      continue
+    }
+    ex, ey := ent.Pos()
+    reach := ent.Stats.Sight() + radius
+    if ex-x > reach || x-ex > reach || ey-y > reach || y-ey > reach {
+      continue
+    }
+    ent.los.x = -1
+  }
+}
+
+// Invalidates the los of every entity that might see through door, which is
+// in room, now that it has opened or closed.
+func (g *Game) InvalidateLosNearDoor(room *house.Room, door *house.Door) {
+  mid := door.Pos + door.Width/2
+  var x, y int
+  switch door.Facing {
+  case house.FarLeft:
+    x, y = room.X+mid, room.Y+room.Size.Dy-1
+  case house.FarRight:
+    x, y = room.X+room.Size.Dx-1, room.Y+mid
+  case house.NearLeft:
+    x, y = room.X, room.Y+mid
+  default:
+    x, y = room.X+mid, room.Y
+  }
+  g.InvalidateLosNear(x, y, door.Width/2+1)
+}
+
 type roomGraph struct {
   g *Game
 }
@@ -662,18 +955,18 @@ func (g *Game) RoomGraph() algorithm.Graph {
 }
 
 func (rg *roomGraph) NumVertex() int {
-  return len(rg.g.House.Floors[0].Rooms)
+  return len(rg.g.CurrentFloor().Rooms)
 }
 
 func (rg *roomGraph) Adjacent(n int) ([]int, []float64) {
-  room := rg.g.House.Floors[0].Rooms[n]
+  room := rg.g.CurrentFloor().Rooms[n]
   var adj []int
   var cost []float64
   for _, door := range room.Doors {
-    other_room, _ := rg.g.House.Floors[0].FindMatchingDoor(room, door)
+    other_room, _ := rg.g.CurrentFloor().FindMatchingDoor(room, door)
     if other_room != nil {
-      for i := range rg.g.House.Floors[0].Rooms {
-        if other_room == rg.g.House.Floors[0].Rooms[i] {
+      for i := range rg.g.CurrentFloor().Rooms {
+        if other_room == rg.g.CurrentFloor().Rooms[i] {
           adj = append(adj, i)
           cost = append(cost, 1)
           break
@@ -684,112 +977,56 @@ func (rg *roomGraph) Adjacent(n int) ([]int, []float64) {
   return adj, cost
 }
 
+// Returns the movement graph for side, ignoring the entities in exclude.  The
+// graph is built from a MoveGraph that is kept until a door or a piece of
+// furniture changes.
 func (g *Game) Graph(side Side, los bool, exclude []*Entity) algorithm.Graph {
-  ex := make(map[*Entity]bool, len(exclude))
-  for i := range exclude {
-    ex[exclude[i]] = true
+  g.move_graph_mutex.Lock()
+  if g.move_graph == nil || g.move_graph.Stale() {
+    g.move_graph = g.BuildGraph()
   }
-  return &exclusionGraph{side, los, ex, g}
+  mg := g.move_graph
+  g.move_graph_mutex.Unlock()
+  return mg.Graph(side, los, exclude)
 }
 
-func (g *Game) adjacent(v int, los bool, side Side, ex map[*Entity]bool) ([]int, []float64) {
-  room, x, y := g.FromVertex(v)
-  var adj []int
-  var weight []float64
-  var moves [3][3]float64
-  ent_occupied := make(map[[2]int]bool)
-  for _, ent := range g.Ents {
-    if ex[ent] {
-      continue
-    }
-    x, y := ent.Pos()
-    dx, dy := ent.Dims()
-    for i := x; i < x+dx; i++ {
-      for j := y; j < y+dy; j++ {
-        ent_occupied[[2]int{i, j}] = true
-      }
-    }
+// Finds the cheapest path for ent to walk to x, y through cells that ent's
+// side can see.  The path includes ent's current position.  Returns a nil
+// path if x, y cannot be reached.  If mg is nil the game's own MoveGraph is
+// used, otherwise paths can be found through mg without touching it.
+func (g *Game) FindPath(ent *Entity, x, y int, mg *MoveGraph) (cost int, path [][2]int) {
+  sx, sy := ent.Pos()
+  return g.findPath(ent.Side(), sx, sy, x, y, mg)
+}
+
+func (g *Game) findPath(side Side, sx, sy, x, y int, mg *MoveGraph) (cost int, path [][2]int) {
+  src := g.ToVertex(sx, sy)
+  dst := g.ToVertex(x, y)
+  var graph algorithm.Graph
+  if mg == nil {
+    graph = g.Graph(side, true, nil)
+  } else {
+    graph = mg.Graph(side, true, nil)
   }
-  var data *sideLosData
-  if los {
-    switch side {
-    case SideHaunt:
-      data = &g.los.denizens
-    case SideExplorers:
-      data = &g.los.intruders
-    default:
-      base.Error().Printf("Unable to SetLosMode for side == %d.", side)
-      return nil, nil
-    }
+  fcost, vs := algorithm.Dijkstra(graph, []int{src}, []int{dst})
+  if len(vs) <= 1 {
+    return 0, nil
   }
-  for dx := -1; dx <= 1; dx++ {
-    for dy := -1; dy <= 1; dy++ {
-      // Only run this loop if exactly one of dx and dy is non-zero
-      if (dx == 0) == (dy == 0) {
-        continue
-      }
-      tx := x + dx
-      ty := y + dy
-      if ent_occupied[[2]int{tx, ty}] {
-        continue
-      }
-      if data != nil && data.tex.Pix()[tx][ty] < house.LosVisibilityThreshold {
-        continue
-      }
-      // TODO: This is obviously inefficient
-      troom, _, _ := g.FromVertex(g.ToVertex(tx, ty))
-      if troom == nil {
-        continue
-      }
-      if furnitureAt(troom, tx-troom.X, ty-troom.Y) != nil {
-        continue
-      }
-      if !connected(room, troom, x, y, tx, ty) {
-        continue
-      }
-      adj = append(adj, g.ToVertex(tx, ty))
-      moves[dx+1][dy+1] = 1
-      weight = append(weight, 1)
-    }
+  for _, v := range vs {
+    _, vx, vy := g.FromVertex(v)
+    path = append(path, [2]int{vx, vy})
   }
-  for dx := -1; dx <= 1; dx++ {
-    for dy := -1; dy <= 1; dy++ {
-      // Only run this loop if both dx and dy are non-zero (moving diagonal)
-      if (dx == 0) != (dy == 0) {
-        continue
-      }
-      tx := x + dx
-      ty := y + dy
-      if ent_occupied[[2]int{tx, ty}] {
-        continue
-      }
-      if data != nil && data.tex.Pix()[tx][ty] < house.LosVisibilityThreshold {
-        continue
-      }
-      // TODO: This is obviously inefficient
-      troom, _, _ := g.FromVertex(g.ToVertex(tx, ty))
-      if troom == nil {
-        continue
-      }
-      if furnitureAt(troom, tx-troom.X, ty-troom.Y) != nil {
-        continue
-      }
-      if !connected(room, troom, x, y, tx, ty) {
-        continue
-      }
-      if !connected(troom, room, tx, ty, x, y) {
-        continue
-      }
-      if moves[dx+1][1] == 0 || moves[1][dy+1] == 0 {
-        continue
-      }
-      adj = append(adj, g.ToVertex(tx, ty))
-      w := (moves[dx+1][1] + moves[1][dy+1]) / 2
-      moves[dx+1][dy+1] = w
-      weight = append(weight, w)
-    }
+  return int(fcost), path
+}
+
+// Used by the viewer's measure mode, the cost is for the side whose turn it
+// is and, like FindPath, only goes through cells that side can see.
+func (g *Game) measureCost(x, y, x2, y2 int) (int, bool) {
+  if x == x2 && y == y2 {
+    return 0, true
   }
-  return adj, weight
+  cost, path := g.findPath(g.Side, x, y, x2, y2, nil)
+  return cost, path != nil
 }
 
 func (g *Game) setup() {
@@ -805,25 +1042,49 @@ func (g *Game) setup() {
   g.Ai.minions = inactiveAi{}
   g.Ai.denizens = inactiveAi{}
   g.Ai.intruders = inactiveAi{}
+  g.markTriggerDoors()
 }
 
 func makeGame(h *house.HouseDef) *Game {
+  g := makeGameData(h)
+  g.Rand.SeedWithDevRand()
+  g.setup()
+  return g
+}
+
+// Makes a Game that doesn't need an OpenGl context, so that connectivity,
+// los, pathing, and ais can be run from tests or a server.  The viewer is
+// still made since it only touches OpenGl when it is drawn, and the random
+// number generator isn't seeded so that runs are repeatable.
+func MakeHeadlessGame(h *house.HouseDef) *Game {
+  g := makeGameData(h)
+  g.headless = true
+  g.setup()
+  return g
+}
+
+// Like MakeHeadlessGame, but the random number generator is seeded with seed
+// so that tests can reproduce anything that depends on it.
+func MakeHeadlessGameWithSeed(h *house.HouseDef, seed int64) *Game {
+  g := MakeHeadlessGame(h)
+  g.Rand.Seed(seed)
+  return g
+}
+
+func makeGameData(h *house.HouseDef) *Game {
   var g Game
   g.Side = SideExplorers
   g.House = h
   g.House.Normalize()
   g.viewer = house.MakeHouseViewer(g.House, 62)
+  g.viewer.Measure_cost = g.measureCost
   g.Rand = cmwc.MakeCmwc(4285415527, 3)
-  g.Rand.SeedWithDevRand()
 
   // This way an unset id will be invalid
   g.Entity_id = 1
 
   g.Turn = 1
   g.Side = SideHaunt
-
-  g.setup()
-
   return &g
 }
 
@@ -877,7 +1138,9 @@ func (g *Game) SetLosMode(side Side, mode LosMode, rooms []*house.Room) {
     for _, room := range rooms {
       for x := room.X; x < room.X+room.Size.Dx; x++ {
         for y := room.Y; y < room.Y+room.Size.Dy; y++ {
-          in_room[g.ToVertex(x, y)] = true
+          if room.Contains(x, y) {
+            in_room[g.ToVertex(x, y)] = true
+          }
         }
       }
     }
@@ -899,7 +1162,37 @@ func (g *Game) SetLosMode(side Side, mode LosMode, rooms []*house.Room) {
   data.tex.Remap()
 }
 
+// Actions that stay InProgress for longer than this are assumed to be stuck.
+const defaultMaxActionTime = 30000
+
+func (g *Game) maxActionTime() int64 {
+  if g.Max_action_time > 0 {
+    return g.Max_action_time
+  }
+  return defaultMaxActionTime
+}
+
+// Cleans up after the current action and lets the script know that it has
+// finished.
+func (g *Game) completeAction() {
+  g.startCooldown()
+  g.current_action.Cancel()
+  g.viewer.RemoveFloorDrawable(g.current_action)
+  g.current_action = nil
+  g.interrupts.mover = nil
+  g.Action_state = noAction
+  if g.Turn_state != turnStateMainPhaseOver {
+    g.Turn_state = turnStateScriptOnAction
+  }
+  base.Log().Printf("ScriptComm: Action complete")
+  g.comm.game_to_script <- nil
+  g.checkWinConditions()
+}
+
 func (g *Game) Think(dt int64) {
+  if g.message.remaining > 0 {
+    g.message.remaining -= dt
+  }
   for _, ent := range g.Ents {
     if !g.all_ents_in_game[ent] {
       g.all_ents_in_game[ent] = true
@@ -918,6 +1211,23 @@ func (g *Game) Think(dt int64) {
     ent.Release()
   }
 
+  g.thinkDying(dt)
+
+  // Advance any doors that are swinging open or closed.  Los needs to be
+  // recalculated when a door becomes see-through and when it finishes.
+  for _, room := range g.CurrentFloor().Rooms {
+    for _, door := range room.Doors {
+      if !door.IsMoving() {
+        continue
+      }
+      los := door.IsLosOpened()
+      door.Think(dt)
+      if los != door.IsLosOpened() || !door.IsMoving() {
+        g.InvalidateLosNearDoor(room, door)
+      }
+    }
+  }
+
   // Figure out if there are any entities that might be occluded be any
   // furniture, if so we'll want to make that furniture a little transparent.
   for _, floor := range g.House.Floors {
@@ -972,9 +1282,7 @@ func (g *Game) Think(dt int64) {
   case turnStateInit:
     select {
     case <-g.comm.script_to_game:
-      base.Log().Printf("ScriptComm: change to turnStateStart")
-      g.Turn_state = turnStateStart
-      g.script.OnRound(g)
+      g.begin()
       // g.OnRound()
     default:
     }
@@ -1012,6 +1320,7 @@ func (g *Game) Think(dt int64) {
         g.current_action = ent.Actions[g.current_exec.ActionIndex()]
         g.viewer.AddFloorDrawable(g.current_action)
         ent.current_action = g.current_action
+        g.Notify(Event{Kind: EventActionCommitted, Ent: ent, Exec: g.current_exec})
       } else {
         g.Turn_state = turnStateEnd
         base.Log().Printf("ScriptComm: change to turnStateEnd for realzes")
@@ -1044,6 +1353,7 @@ func (g *Game) Think(dt int64) {
     select {
     case <-g.comm.script_to_game:
       g.Action_state = doingAction
+      g.Notify(Event{Kind: EventActionCommitted, Ent: g.EntityById(g.current_exec.EntityId()), Exec: g.current_exec})
     default:
     }
   }
@@ -1051,26 +1361,42 @@ func (g *Game) Think(dt int64) {
   // If there is an action that is currently executing we need to advance that
   // action.
   if g.Action_state == doingAction {
-    res := g.current_action.Maintain(dt, g, g.current_exec)
+    exec := g.current_exec
+    if exec != nil && !g.interrupts.active() {
+      if ent := g.EntityById(exec.EntityId()); ent != nil {
+        g.beginWatching(ent)
+      }
+    }
+    if g.interrupts.exec != nil {
+      exec = g.interrupts.exec
+      g.interrupts.exec = nil
+    }
+    res := g.current_action.Maintain(dt, g, exec)
     if g.current_exec != nil {
       base.Log().Printf("ScriptComm: sent action")
       g.current_exec = nil
     }
+    if res == InProgress {
+      g.action_time += dt
+      if g.action_time > g.maxActionTime() {
+        base.Warn().Printf("Action %s was in progress for more than %dms, cancelling it", g.current_action, g.maxActionTime())
+        res = Complete
+      }
+    }
+    if res != InProgress {
+      g.action_time = 0
+    }
     switch res {
     case Complete:
-      g.current_action.Cancel()
-      g.viewer.RemoveFloorDrawable(g.current_action)
-      g.current_action = nil
-      g.Action_state = noAction
-      if g.Turn_state != turnStateMainPhaseOver {
-        g.Turn_state = turnStateScriptOnAction
+      if g.interrupts.active() {
+        g.finishInterrupt()
+      } else {
+        g.completeAction()
       }
-      base.Log().Printf("ScriptComm: Action complete")
-      g.comm.game_to_script <- nil
-      g.checkWinConditions()
 
     case InProgress:
     case CheckForInterrupts:
+      g.checkInterrupts()
     }
   }
 
@@ -1131,7 +1457,7 @@ func (g *Game) Think(dt int64) {
     if los.r == nil {
       continue
     }
-    for _, spawn := range g.House.Floors[0].Spawns {
+    for _, spawn := range g.CurrentFloor().Spawns {
       if !los.r.MatchString(spawn.Name) {
         continue
       }
@@ -1147,9 +1473,14 @@ func (g *Game) Think(dt int64) {
     }
   }
 
-  for _, tex := range []*house.LosTexture{g.los.denizens.tex, g.los.intruders.tex} {
+  for _, data := range []*sideLosData{&g.los.denizens, &g.los.intruders} {
+    tex := data.tex
     pix := tex.Pix()
-    amt := dt/6 + 1
+    config := g.LosConfig()
+    amt := int64(255)
+    if config.Fade_time > 0 {
+      amt = dt*255/config.Fade_time + 1
+    }
     mod := false
     for i := range pix {
       for j := range pix[i] {
@@ -1159,8 +1490,8 @@ func (g *Game) Think(dt int64) {
         } else {
           v += amt
         }
-        if v < house.LosMinVisibility {
-          v = house.LosMinVisibility
+        if v < int64(config.Min_visibility) {
+          v = int64(config.Min_visibility)
         }
         if v < 0 {
           v = 0
@@ -1172,6 +1503,11 @@ func (g *Game) Think(dt int64) {
         pix[i][j] = byte(v)
       }
     }
+    // Ambient light is applied after fading, otherwise cells that it keeps
+    // below the visibility threshold would just fade away again.
+    if data.mode == LosModeEntities && g.applyAmbientLight(pix) {
+      mod = true
+    }
     if mod {
       tex.Remap()
     }
@@ -1188,21 +1524,26 @@ func (g *Game) Think(dt int64) {
   }
 
   // If any entities are not either ready or dead let's wait until they are
-  // before we do any of the ai stuff
-  for _, ent := range g.Ents {
-    if ent.Side() != SideHaunt && ent.Side() != SideExplorers {
-      // Relics and cleanse points and whatnot matter here, and they might not
-      // be in a 'ready' state.
-      continue
-    }
-    state := ent.sprite.Sprite().AnimState()
-    if state != "ready" && state != "killed" {
-      return
-    }
-    if !ent.sprite.Sprite().Idle() {
-      return
+  // before we do any of the ai stuff.  Relics and cleanse points and whatnot
+  // don't matter here, and they might not be in a 'ready' state.
+  for _, side := range []Side{SideHaunt, SideExplorers} {
+    for _, ent := range g.EntsForSide(side) {
+      if ent.Sprite() == nil {
+        continue
+      }
+      state := ent.sprite.Sprite().AnimState()
+      if state != "ready" && state != "killed" {
+        return
+      }
+      if !ent.sprite.Sprite().Idle() {
+        return
+      }
     }
   }
+
+  if g.current_exec == nil && g.runQueue() {
+    return
+  }
   // Do Ai - if there is any to do
   if g.Side == SideHaunt {
     if g.Ai.minions.Active() {
@@ -1241,57 +1582,177 @@ func (g *Game) Think(dt int64) {
   }
 }
 
-func (g *Game) doLos(dist int, line [][2]int, los [][]bool) {
+func (g *Game) doLos(dist int, line [][2]int, los [][]bool, supercover bool) {
+  g.traceLine(dist, line, los, false, supercover)
+}
+
+// Returns true if a shot fired from one cell would reach the other.  This
+// follows the same rules as los, except that shots are stopped by furniture
+// that blocks shots rather than by furniture that blocks los.
+func (g *Game) HasLineOfFire(from, to [2]int) bool {
+  var line [][2]int
+  bresenham(from[0], from[1], to[0], to[1], &line)
+  if len(line) == 0 {
+    return false
+  }
+  return g.traceLine(len(line), line, nil, true, g.Los_supercover)
+}
+
+// Returns the cells on the current floor that are within rng of origin, using
+// the same distance as attack ranges.  If requireLos is set then only cells
+// that can be seen from origin are included.  Actions use this to show what
+// they can reach before a target is picked.
+func (g *Game) HighlightTargets(origin [2]int, rng int, requireLos bool) map[[2]int]bool {
+  targets := make(map[[2]int]bool)
+  var line [][2]int
+  for x := origin[0] - rng; x <= origin[0]+rng; x++ {
+    for y := origin[1] - rng; y <= origin[1]+rng; y++ {
+      if roomAt(g.CurrentFloor(), x, y) == nil {
+        continue
+      }
+      if requireLos && !g.losBetween(rng, origin[0], origin[1], x, y, &line) {
+        continue
+      }
+      targets[[2]int{x, y}] = true
+    }
+  }
+  return targets
+}
+
+// Defense added to a target for each cell of cover it has, and the most cells
+// of cover that count.
+const (
+  coverBonusPerCell = 2
+  coverMaxCells     = 2
+)
+
+// Returns the defensive bonus that a target at to gets against a shot fired
+// from from.  Each cell next to the target, on the side facing the shooter,
+// that has furniture that blocks shots gives some cover.  A shooter that is
+// adjacent to the target can shoot around its cover, so it gets no bonus.
+func (g *Game) CoverBonus(from, to [2]int) int {
+  dx, dy := from[0]-to[0], from[1]-to[1]
+  if dx >= -1 && dx <= 1 && dy >= -1 && dy <= 1 {
+    return 0
+  }
+  sign := func(v int) int {
+    switch {
+    case v > 0:
+      return 1
+    case v < 0:
+      return -1
+    }
+    return 0
+  }
+  sx, sy := sign(dx), sign(dy)
+  var cells [][2]int
+  if sx != 0 {
+    cells = append(cells, [2]int{to[0] + sx, to[1]})
+  }
+  if sy != 0 {
+    cells = append(cells, [2]int{to[0], to[1] + sy})
+  }
+  if sx != 0 && sy != 0 {
+    cells = append(cells, [2]int{to[0] + sx, to[1] + sy})
+  }
+  count := 0
+  for _, cell := range cells {
+    room := roomAt(g.CurrentFloor(), cell[0], cell[1])
+    if room == nil {
+      continue
+    }
+    lx, ly := room.ToLocal(cell[0], cell[1])
+    if furnitureBlocksLine(room, lx, ly, 0, true) {
+      count++
+    }
+  }
+  if count > coverMaxCells {
+    count = coverMaxCells
+  }
+  return count * coverBonusPerCell
+}
+
+// Returns true if cell x, y, which is on the line traced by traceLine at
+// index i, is in a room and doesn't have furniture that would stop the line.
+func (g *Game) cellPassable(x, y, i int, shot bool) bool {
+  room := roomAt(g.CurrentFloor(), x, y)
+  if room == nil {
+    return false
+  }
+  lx, ly := room.ToLocal(x, y)
+  return !furnitureBlocksLine(room, lx, ly, i, shot)
+}
+
+// Walks along line for at most dist cells, stopping at walls, closed doors,
+// and furniture that blocks los, or blocks shots if shot is true.  Every cell
+// reached is marked in los, if it isn't nil.  Returns true if the entire line
+// was traversed.
+// If supercover is set then the line is treated as though it covers both
+// corner cells at every diagonal step, so it is blocked if either of them
+// would block it.  See Los_supercover.
+func (g *Game) traceLine(dist int, line [][2]int, los [][]bool, shot, supercover bool) bool {
   var x0, y0, x, y int
   var room0, room *house.Room
+  width := house.LosTextureSize
+  if los != nil {
+    width = len(los)
+  }
   x, y = line[0][0], line[0][1]
-  if x < 0 || y < 0 || x >= len(los) || y >= len(los[x]) {
-    return
+  if x < 0 || y < 0 || x >= width || y >= width {
+    return false
+  }
+  if los != nil {
+    los[x][y] = true
   }
-  los[x][y] = true
-  room = roomAt(g.House.Floors[0], x, y)
-  for _, p := range line[1:] {
+  room = roomAt(g.CurrentFloor(), x, y)
+  for i, p := range line[1:] {
     x0, y0 = x, y
     x, y = p[0], p[1]
-    if x < 0 || y < 0 || x >= len(los) || y >= len(los[x]) {
-      return
+    if x < 0 || y < 0 || x >= width || y >= width {
+      return false
     }
     room0 = room
-    room = roomAt(g.House.Floors[0], x, y)
+    room = roomAt(g.CurrentFloor(), x, y)
     if room == nil {
-      return
+      return false
     }
     if x == x0 || y == y0 {
-      if room0 != nil && room0 != room && !connected(room, room0, x, y, x0, y0) {
-        return
+      if room0 != nil && room0 != room && !losConnected(room, room0, x, y, x0, y0) {
+        return false
       }
     } else {
-      roomA := roomAt(g.House.Floors[0], x0, y0)
-      roomB := roomAt(g.House.Floors[0], x, y0)
-      roomC := roomAt(g.House.Floors[0], x0, y)
-      if roomA != nil && roomB != nil && roomA != roomB && !connected(roomA, roomB, x0, y0, x, y0) {
-        return
+      roomA := roomAt(g.CurrentFloor(), x0, y0)
+      roomB := roomAt(g.CurrentFloor(), x, y0)
+      roomC := roomAt(g.CurrentFloor(), x0, y)
+      if roomA != nil && roomB != nil && roomA != roomB && !losConnected(roomA, roomB, x0, y0, x, y0) {
+        return false
       }
-      if roomA != nil && roomC != nil && roomA != roomC && !connected(roomA, roomC, x0, y0, x0, y) {
-        return
+      if roomA != nil && roomC != nil && roomA != roomC && !losConnected(roomA, roomC, x0, y0, x0, y) {
+        return false
       }
-      if roomB != nil && room != roomB && !connected(room, roomB, x, y, x, y0) {
-        return
+      if roomB != nil && room != roomB && !losConnected(room, roomB, x, y, x, y0) {
+        return false
       }
-      if roomC != nil && room != roomC && !connected(room, roomC, x, y, x0, y) {
-        return
+      if roomC != nil && room != roomC && !losConnected(room, roomC, x, y, x0, y) {
+        return false
+      }
+      if supercover && (!g.cellPassable(x, y0, i+1, shot) || !g.cellPassable(x0, y, i+1, shot)) {
+        return false
       }
     }
-    furn := furnitureAt(room, x-room.X, y-room.Y)
-    if furn != nil && furn.Blocks_los {
-      return
+    lx, ly := room.ToLocal(x, y)
+    if furnitureBlocksLine(room, lx, ly, i+1, shot) {
+      return false
     }
     dist -= 1 // or whatever
     if dist < 0 {
-      return
+      return false
+    }
+    if los != nil {
+      los[x][y] = true
     }
-    los[x][y] = true
   }
+  return true
 }
 
 func (g *Game) TeamLos(side Side, x, y, dx, dy int) bool {
@@ -1338,6 +1799,17 @@ func (g *Game) ViewFrac(x, y, dx, dy int) float64 {
   return 0.0
 }
 
+// Clamps v to a valid index into the los textures.
+func clampLos(v int) int {
+  if v < 0 {
+    return 0
+  }
+  if v >= house.LosTextureSize {
+    return house.LosTextureSize - 1
+  }
+  return v
+}
+
 func (g *Game) mergeLos(side Side) {
   var pix [][]byte
   switch side {
@@ -1352,6 +1824,9 @@ func (g *Game) mergeLos(side Side) {
   for i := range g.los.full_merger {
     g.los.full_merger[i] = false
   }
+  if g.los.lights_dirty || g.los.lights_floor != g.Current_floor {
+    g.updateLights()
+  }
   for _, ent := range g.Ents {
     if ent.Side() != side && !ent.Enemy_los {
       continue
@@ -1359,13 +1834,18 @@ func (g *Game) mergeLos(side Side) {
     if ent.los == nil {
       continue
     }
-    for i := ent.los.minx; i <= ent.los.maxx; i++ {
-      for j := ent.los.miny; j <= ent.los.maxy; j++ {
-        if ent.los.grid[i][j] {
+    // The bounds only cover the texture as long as the entity's los was found
+    // by UpdateEntLos, so clamp them in case something else set them.
+    minx, miny := clampLos(ent.los.minx), clampLos(ent.los.miny)
+    maxx, maxy := clampLos(ent.los.maxx), clampLos(ent.los.maxy)
+    for i := minx; i <= maxx && i < len(ent.los.grid); i++ {
+      for j := miny; j <= maxy && j < len(ent.los.grid[i]); j++ {
+        if ent.los.grid[i][j] && !g.tooDarkToSee(ent.los.x, ent.los.y, i, j) {
           g.los.merger[i][j] = true
         }
       }
     }
+    g.mergeLitRoom(ent)
   }
   for i := 0; i < len(pix); i++ {
     for j := 0; j < len(pix); j++ {
@@ -1389,36 +1869,50 @@ func (g *Game) mergeLos(side Side) {
 }
 
 // This is the function used to determine LoS.  Nothing else should try to
-// make any attempts at doing so.  Eventually this should be replaced with
-// something more sensible and faster, so everyone needs to use this so that
-// everything stays in sync.
+// make any attempts at doing so, so that everything stays in sync.
+// Marks every cell in grid that can see, and be seen from, x, y.  Los is
+// symmetric, if a unit at x, y can see a cell then a unit in that cell can
+// see x, y.  Casting rays to the perimeter can't guarantee that, since the
+// cells a ray passes through on its way out aren't the cells on the line
+// between x, y and each of them, so every cell in range is traced
+// individually.  That is quadratic in los_dist, but cells outside of any
+// room are skipped and the trace back is only done when the trace out fails.
 func (g *Game) DetermineLos(x, y, los_dist int, grid [][]bool) {
   for i := range grid {
     for j := range grid[i] {
       grid[i][j] = false
     }
   }
-  minx := x - los_dist
-  miny := y - los_dist
-  maxx := x + los_dist
-  maxy := y + los_dist
-  line := make([][2]int, los_dist)
-  for vx := minx; vx <= maxx; vx++ {
-    line = line[0:0]
-    bresenham(x, y, vx, miny, &line)
-    g.doLos(los_dist, line, grid)
-    line = line[0:0]
-    bresenham(x, y, vx, maxy, &line)
-    g.doLos(los_dist, line, grid)
-  }
-  for vy := miny; vy <= maxy; vy++ {
-    line = line[0:0]
-    bresenham(x, y, minx, vy, &line)
-    g.doLos(los_dist, line, grid)
-    line = line[0:0]
-    bresenham(x, y, maxx, vy, &line)
-    g.doLos(los_dist, line, grid)
+  line := make([][2]int, los_dist+1)
+  for vx := x - los_dist; vx <= x+los_dist; vx++ {
+    if vx < 0 || vx >= len(grid) {
+      continue
+    }
+    for vy := y - los_dist; vy <= y+los_dist; vy++ {
+      if vy < 0 || vy >= len(grid[vx]) {
+        continue
+      }
+      if roomAt(g.CurrentFloor(), vx, vy) == nil {
+        continue
+      }
+      grid[vx][vy] = g.losBetween(los_dist, x, y, vx, vy, &line)
+    }
+  }
+}
+
+// Returns true if there is los between the two cells.  Near doorways the
+// line from one cell to the other doesn't always pass through the same cells
+// as the line going the other way, so both are traced and either one is
+// enough.  line is used as scratch space.
+func (g *Game) losBetween(dist, x, y, x2, y2 int, line *[][2]int) bool {
+  *line = (*line)[0:0]
+  bresenham(x, y, x2, y2, line)
+  if g.traceLine(dist, *line, nil, false, g.Los_supercover) {
+    return true
   }
+  *line = (*line)[0:0]
+  bresenham(x2, y2, x, y, line)
+  return g.traceLine(dist, *line, nil, false, g.Los_supercover)
 }
 
 func (g *Game) UpdateEntLos(ent *Entity, force bool) {
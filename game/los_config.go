@@ -0,0 +1,38 @@
+package game
+
+import (
+  "github.com/runningwild/haunts/house"
+)
+
+// Controls how the fog of war looks.  Whether or not a cell is visible is
+// always decided by house.LosVisibilityThreshold, this only changes how
+// cells fade between visible and not.
+type LosConfig struct {
+  // Milliseconds it takes a cell to fade all the way between black and fully
+  // visible.  If this is 0 cells snap between visible and not instantly.
+  Fade_time int64
+
+  // Cells that can't be seen fade out until they reach this brightness,
+  // where 0 is black.
+  Min_visibility byte
+}
+
+var defaultLosConfig = LosConfig{
+  Fade_time:      6 * 255,
+  Min_visibility: house.LosMinVisibility,
+}
+
+// Returns the LosConfig currently in use.
+func (g *Game) LosConfig() LosConfig {
+  if g.Los_config == nil {
+    return defaultLosConfig
+  }
+  return *g.Los_config
+}
+
+func (g *Game) SetLosConfig(config LosConfig) {
+  if config.Min_visibility >= house.LosVisibilityThreshold {
+    config.Min_visibility = house.LosVisibilityThreshold - 1
+  }
+  g.Los_config = &config
+}
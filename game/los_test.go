@@ -0,0 +1,143 @@
+package game_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/runningwild/haunts/game"
+  "github.com/runningwild/haunts/house"
+  "path/filepath"
+)
+
+func makeLosGrid() [][]bool {
+  grid := make([][]bool, house.LosTextureSize)
+  for i := range grid {
+    grid[i] = make([]bool, house.LosTextureSize)
+  }
+  return grid
+}
+
+func LosSpec(c gospec.Context) {
+  house.LoadAllRoomsInDir(filepath.Join(datadir, "rooms"))
+  house.LoadAllDoorsInDir(filepath.Join(datadir, "doors"))
+
+  // Two rooms side-by-side connected by a doorway at (4, 2) - (5, 2).
+  left := makeRoom(1, 1)
+  right := makeRoom(5, 1)
+  left.Doors = append(left.Doors, makeDoor(house.FarRight, 1))
+  right.Doors = append(right.Doors, makeDoor(house.NearLeft, 1))
+  h := &house.HouseDef{Name: "Los Test"}
+  h.Floors = append(h.Floors, &house.Floor{Rooms: []*house.Room{left, right}})
+  g := game.MakeHeadlessGame(h)
+
+  c.Specify("Los through a doorway is symmetric.", func() {
+    a := makeLosGrid()
+    b := makeLosGrid()
+    g.DetermineLos(1, 2, 10, a)
+    g.DetermineLos(7, 1, 10, b)
+    c.Expect(a[7][1], Equals, b[1][2])
+  })
+
+  c.Specify("Los is symmetric between every pair of cells.", func() {
+    var cells [][2]int
+    for x := 1; x < 9; x++ {
+      for y := 1; y < 5; y++ {
+        cells = append(cells, [2]int{x, y})
+      }
+    }
+    grids := make(map[[2]int][][]bool)
+    for _, cell := range cells {
+      grids[cell] = makeLosGrid()
+      g.DetermineLos(cell[0], cell[1], 10, grids[cell])
+    }
+    asymmetric := 0
+    for _, a := range cells {
+      for _, b := range cells {
+        if grids[a][b[0]][b[1]] != grids[b][a[0]][a[1]] {
+          asymmetric++
+        }
+      }
+    }
+    c.Expect(asymmetric, Equals, 0)
+  })
+
+  c.Specify("HighlightTargets finds cells in range, through doorways if los is required.", func() {
+    all := g.HighlightTargets([2]int{1, 2}, 2, false)
+    c.Expect(len(all), Equals, 12)
+    c.Expect(all[[2]int{0, 2}], Equals, false)
+    c.Expect(all[[2]int{3, 4}], Equals, true)
+
+    seen := g.HighlightTargets([2]int{3, 2}, 2, true)
+    c.Expect(seen[[2]int{5, 2}], Equals, true)
+    c.Expect(seen[[2]int{5, 4}], Equals, false)
+    c.Expect(seen[[2]int{1, 1}], Equals, true)
+  })
+
+  c.Specify("Supercover los doesn't leak between rooms that only share a corner.", func() {
+    a := makeRoom(1, 1)
+    b := makeRoom(5, 5)
+    sealed := &house.HouseDef{Name: "Corner Test"}
+    sealed.Floors = append(sealed.Floors, &house.Floor{Rooms: []*house.Room{a, b}})
+    g2 := game.MakeHeadlessGame(sealed)
+    grid := makeLosGrid()
+    g2.DetermineLos(4, 4, 10, grid)
+    c.Expect(grid[5][5], Equals, true)
+    c.Expect(g2.HasLineOfFire([2]int{4, 4}, [2]int{5, 5}), Equals, true)
+
+    g2.Los_supercover = true
+    g2.DetermineLos(4, 4, 10, grid)
+    c.Expect(grid[5][5], Equals, false)
+    c.Expect(grid[2][2], Equals, true)
+    c.Expect(g2.HasLineOfFire([2]int{4, 4}, [2]int{5, 5}), Equals, false)
+    g2.DetermineLos(6, 6, 10, grid)
+    c.Expect(grid[4][4], Equals, false)
+  })
+
+  c.Specify("Spectators see everything, and can go back to following the turn.", func() {
+    g.SetPovMode(game.PovAll)
+    c.Expect(g.GetViewer().Los_tex.Get(0, 0), Equals, byte(255))
+    g.Side = game.SideHaunt
+    g.SetPovMode(game.PovTurn)
+    c.Expect(g.PovMode(), Equals, game.PovTurn)
+    c.Expect(g.GetViewer().Los_tex.Get(0, 0) < house.LosVisibilityThreshold, Equals, true)
+    g.SetVisibility(game.SideExplorers)
+    c.Expect(g.PovMode(), Equals, game.PovFixed)
+  })
+
+  c.Specify("Cells in rooms with ambient light are lit even if nothing sees them.", func() {
+    lit := makeNamedRoom("Ambient Test", 1, 1)
+    dim := makeRoom(5, 1)
+    hall := &house.HouseDef{Name: "Ambient Test"}
+    hall.Floors = append(hall.Floors, &house.Floor{Rooms: []*house.Room{lit, dim}})
+    g2 := game.MakeHeadlessGame(hall)
+    c.Expect(g2.AmbientLight(2, 2), Equals, byte(220))
+    c.Expect(g2.AmbientLight(6, 2), Equals, byte(0))
+    c.Expect(g2.AmbientLight(-1, 2), Equals, byte(0))
+
+    g2.SetLosMode(game.SideExplorers, game.LosModeEntities, nil)
+    g2.SetVisibility(game.SideExplorers)
+    g2.Think(100)
+    c.Expect(g2.GetViewer().Los_tex.Get(2, 2) >= 220, Equals, true)
+    c.Expect(g2.GetViewer().Los_tex.Get(6, 2) < house.LosVisibilityThreshold, Equals, true)
+  })
+
+  c.Specify("Furniture next to a target gives cover from shots.", func() {
+    house.LoadAllFurnitureInDir(filepath.Join(datadir, "furniture"))
+    crate := house.MakeFurniture("Crate Test")
+    crate.X, crate.Y = 3, 2
+    left.Furniture = append(left.Furniture, crate)
+    c.Expect(g.CoverBonus([2]int{1, 1}, [2]int{4, 4}) > 0, Equals, true)
+    c.Expect(g.CoverBonus([2]int{1, 4}, [2]int{4, 4}), Equals, 0)
+    c.Expect(g.CoverBonus([2]int{3, 3}, [2]int{4, 4}), Equals, 0)
+  })
+
+  c.Specify("Walkable furniture doesn't hide furniture under it that blocks shots.", func() {
+    house.LoadAllFurnitureInDir(filepath.Join(datadir, "furniture"))
+    rug := house.MakeFurniture("Rug Test")
+    rug.X, rug.Y = 3, 2
+    crate := house.MakeFurniture("Crate Test")
+    crate.X, crate.Y = 3, 2
+    left.Furniture = append(left.Furniture, rug, crate)
+    c.Expect(g.CoverBonus([2]int{1, 1}, [2]int{4, 4}) > 0, Equals, true)
+    c.Expect(g.HasLineOfFire([2]int{4, 2}, [2]int{4, 4}), Equals, false)
+  })
+}
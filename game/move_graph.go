@@ -0,0 +1,189 @@
+package game
+
+import (
+  "github.com/runningwild/glop/util/algorithm"
+  "github.com/runningwild/haunts/base"
+  "github.com/runningwild/haunts/house"
+)
+
+// One move out of a cell.  Diagonal moves can only be taken if both of the
+// orthogonal moves next to them can be, and they cost the average of those
+// two moves times cost.
+type moveEdge struct {
+  v      int
+  x, y   int
+  dx, dy int
+  cost   float64
+}
+
+// A snapshot of the movement graph on the current floor.  Walls, doors, and
+// furniture are checked once when it is built, entities and los are checked
+// each time it is used, so it stays valid while entities move around but has
+// to be rebuilt once a door or a piece of furniture changes, see Stale.
+type MoveGraph struct {
+  g         *Game
+  signature uint64
+  edges     [][]moveEdge
+}
+
+// Returns a number that changes whenever anything that BuildGraph looks at
+// does.
+func (g *Game) graphSignature() uint64 {
+  var sig uint64
+  add := func(vs ...int) {
+    for _, v := range vs {
+      sig = sig*31 + uint64(v)
+    }
+  }
+  b := func(v bool) int {
+    if v {
+      return 1
+    }
+    return 0
+  }
+  add(g.Current_floor)
+  for _, room := range g.CurrentFloor().Rooms {
+    add(room.X, room.Y, room.Size.Dx, room.Size.Dy, len(room.Missing_cells))
+    for _, door := range room.Doors {
+      add(int(door.Facing), door.Pos, b(door.IsOpened()), b(door.Locked))
+    }
+    for _, f := range room.Furniture {
+      add(f.X, f.Y, f.Rotation, b(f.Flip), b(f.BlocksMove()))
+    }
+  }
+  return sig
+}
+
+// Builds a MoveGraph of the current floor.
+func (g *Game) BuildGraph() *MoveGraph {
+  mg := MoveGraph{g: g, signature: g.graphSignature()}
+  mg.edges = make([][]moveEdge, g.numVertex())
+  floor := g.CurrentFloor()
+  for v := range mg.edges {
+    room, x, y := g.FromVertex(v)
+    if room == nil || !room.Contains(x, y) {
+      continue
+    }
+    var edges []moveEdge
+    target := func(dx, dy int) (*house.Room, int, int, bool) {
+      tx, ty := x+dx, y+dy
+      troom := roomAt(floor, tx, ty)
+      if troom == nil {
+        return nil, 0, 0, false
+      }
+      if lx, ly := troom.ToLocal(tx, ty); furnitureBlocksMove(troom, lx, ly) {
+        return nil, 0, 0, false
+      }
+      return troom, tx, ty, true
+    }
+    // Orthogonal moves first so that diagonal moves can find them.
+    for dx := -1; dx <= 1; dx++ {
+      for dy := -1; dy <= 1; dy++ {
+        if (dx == 0) == (dy == 0) {
+          continue
+        }
+        troom, tx, ty, ok := target(dx, dy)
+        if !ok || !connected(room, troom, x, y, tx, ty) {
+          continue
+        }
+        edges = append(edges, moveEdge{g.ToVertex(tx, ty), tx, ty, dx, dy, troom.MoveCost(troom.ToLocal(tx, ty))})
+      }
+    }
+    for dx := -1; dx <= 1; dx++ {
+      for dy := -1; dy <= 1; dy++ {
+        if (dx == 0) != (dy == 0) {
+          continue
+        }
+        troom, tx, ty, ok := target(dx, dy)
+        if !ok || !connected(room, troom, x, y, tx, ty) || !connected(troom, room, tx, ty, x, y) {
+          continue
+        }
+        edges = append(edges, moveEdge{g.ToVertex(tx, ty), tx, ty, dx, dy, troom.MoveCost(troom.ToLocal(tx, ty))})
+      }
+    }
+    mg.edges[v] = edges
+  }
+  return &mg
+}
+
+// Returns true if a door or a piece of furniture has changed since mg was
+// built, or if the game has moved to another floor.
+func (mg *MoveGraph) Stale() bool {
+  return mg.signature != mg.g.graphSignature()
+}
+
+// Returns the graph for side, as with Game.Graph.  The entities are checked
+// now, so this should be called again if any of them move.
+func (mg *MoveGraph) Graph(side Side, los bool, exclude []*Entity) algorithm.Graph {
+  view := moveGraphView{mg: mg, occupied: make([]bool, len(mg.edges))}
+  if los {
+    switch side {
+    case SideHaunt:
+      view.los = &mg.g.los.denizens
+    case SideExplorers:
+      view.los = &mg.g.los.intruders
+    default:
+      base.Error().Printf("Unable to SetLosMode for side == %d.", side)
+      view.invalid = true
+    }
+  }
+  ex := make(map[*Entity]bool, len(exclude))
+  for i := range exclude {
+    ex[exclude[i]] = true
+  }
+  floor := mg.g.CurrentFloor()
+  for _, ent := range mg.g.Ents {
+    if ex[ent] {
+      continue
+    }
+    x, y := ent.Pos()
+    dx, dy := ent.Dims()
+    for i := x; i < x+dx; i++ {
+      for j := y; j < y+dy; j++ {
+        if roomAt(floor, i, j) != nil {
+          view.occupied[mg.g.ToVertex(i, j)] = true
+        }
+      }
+    }
+  }
+  return &view
+}
+
+type moveGraphView struct {
+  mg       *MoveGraph
+  los      *sideLosData
+  occupied []bool
+  invalid  bool
+}
+
+func (view *moveGraphView) NumVertex() int {
+  return len(view.mg.edges)
+}
+
+func (view *moveGraphView) Adjacent(v int) ([]int, []float64) {
+  if view.invalid || v < 0 || v >= len(view.mg.edges) {
+    return nil, nil
+  }
+  var adj []int
+  var weight []float64
+  var moves [3][3]float64
+  for _, e := range view.mg.edges[v] {
+    if view.occupied[e.v] {
+      continue
+    }
+    if view.los != nil && view.los.tex.Get(e.x, e.y) < house.LosVisibilityThreshold {
+      continue
+    }
+    w := e.cost
+    if e.dx != 0 && e.dy != 0 {
+      if moves[e.dx+1][1] == 0 || moves[1][e.dy+1] == 0 {
+        continue
+      }
+      w *= (moves[e.dx+1][1] + moves[1][e.dy+1]) / 2
+    }
+    moves[e.dx+1][e.dy+1] = w
+    adj = append(adj, e.v)
+    weight = append(weight, w)
+  }
+  return adj, weight
+}
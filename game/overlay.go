@@ -4,9 +4,19 @@ import (
   gl "github.com/chsc/gogl/gl21"
   "github.com/runningwild/glop/gui"
   "github.com/runningwild/haunts/base"
+  "github.com/runningwild/haunts/house"
   "time"
 )
 
+// Actions that need to draw something in window coordinates, like a label,
+// implement this.  It is called every frame that the action is the current
+// action.
+type OverlayAction interface {
+  Action
+
+  RenderOverlay(viewer *house.HouseViewer)
+}
+
 type Overlay struct {
   region gui.Region
   game   *Game
@@ -44,9 +54,23 @@ func (o *Overlay) Think(g *gui.Gui, dt int64) {
     o.game.Waypoints[i].active = o.game.Waypoints[i].Side == side
     o.game.Waypoints[i].drawn = false
   }
+  for _, item := range o.game.Items {
+    o.game.viewer.RemoveFloorDrawable(item)
+    o.game.viewer.AddFloorDrawable(item)
+  }
 }
 func (o *Overlay) Draw(region gui.Region) {
   o.region = region
+  if oa, ok := o.game.current_action.(OverlayAction); ok {
+    oa.RenderOverlay(o.game.viewer)
+  }
+  if o.game.message.remaining > 0 {
+    gl.Color4ub(255, 255, 255, 255)
+    d := base.GetDictionary(20)
+    x := float64(region.X + region.Dx/2)
+    y := float64(region.Y+region.Dy) - 2*d.MaxHeight()
+    d.RenderString(o.game.message.text, x, y, 0, d.MaxHeight(), gui.Center)
+  }
   switch o.game.Side {
   case SideHaunt:
     if o.game.los.denizens.mode == LosModeBlind {
@@ -71,7 +95,7 @@ func (o *Overlay) Draw(region gui.Region) {
     cx2, cy2 := o.game.viewer.BoardToWindow(cx-r, cy+r)
     cx3, cy3 := o.game.viewer.BoardToWindow(cx+r, cy+r)
     cx4, cy4 := o.game.viewer.BoardToWindow(cx+r, cy-r)
-    gl.Color4ub(200, 0, 0, 128)
+    house.CurrentPalette().Waypoint.Set()
 
     base.EnableShader("waypoint")
     base.SetUniformF("waypoint", "radius", float32(wp.Radius))
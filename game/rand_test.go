@@ -0,0 +1,28 @@
+package game_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/runningwild/haunts/game"
+  "github.com/runningwild/haunts/house"
+)
+
+func RandSpec(c gospec.Context) {
+  makeHouse := func() *house.HouseDef {
+    return &house.HouseDef{Floors: []*house.Floor{&house.Floor{}}}
+  }
+  c.Specify("Games made with the same seed make the same rolls.", func() {
+    g1 := game.MakeHeadlessGameWithSeed(makeHouse(), 1234)
+    g2 := game.MakeHeadlessGameWithSeed(makeHouse(), 1234)
+    g3 := game.MakeHeadlessGameWithSeed(makeHouse(), 4321)
+    same := true
+    different := false
+    for i := 0; i < 10; i++ {
+      v := g1.Rand.Int63()
+      same = same && v == g2.Rand.Int63()
+      different = different || v != g3.Rand.Int63()
+    }
+    c.Expect(same, Equals, true)
+    c.Expect(different, Equals, true)
+  })
+}
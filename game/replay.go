@@ -0,0 +1,222 @@
+package game
+
+import (
+  "bytes"
+  "encoding/gob"
+  "errors"
+  "fmt"
+  "github.com/runningwild/haunts/base"
+  "github.com/runningwild/haunts/house"
+  "io"
+)
+
+// One thing that happened in the game.  Entries refer to entities by id, and
+// to rooms and doors by their index on the current floor, so that they can
+// be applied to a game loaded from a save.  Names are kept so that the log
+// can still be displayed after the entities are gone.
+type LogEntry struct {
+  Kind EventKind
+
+  Turn int
+  Side Side
+
+  Ent         EntityId
+  Name        string
+  Target      EntityId
+  Target_name string
+
+  // Where Ent moved to
+  X, Y int
+
+  // Whether or not Ent hit Target, the damage dealt, and the hp Target was
+  // left with
+  Hit    bool
+  Damage int
+  Hp     int
+
+  Room, Door int
+  Opened     bool
+}
+
+func (le LogEntry) String() string {
+  switch le.Kind {
+  case EventEntityMoved:
+    return fmt.Sprintf("%s moved to (%d, %d)", le.Name, le.X, le.Y)
+  case EventAttack:
+    if !le.Hit {
+      return fmt.Sprintf("%s attacked %s and missed", le.Name, le.Target_name)
+    }
+    return fmt.Sprintf("%s hit %s for %d", le.Name, le.Target_name, le.Damage)
+  case EventEntityDied:
+    return fmt.Sprintf("%s died", le.Name)
+  case EventTurnChanged:
+    return fmt.Sprintf("Turn %d", le.Turn)
+  case EventDoorChanged:
+    if le.Opened {
+      return "A door was opened"
+    }
+    return "A door was closed"
+  }
+  return fmt.Sprintf("Unknown event %d", le.Kind)
+}
+
+// Returns everything that has happened in the game so far, in order.
+func (g *Game) Log() []LogEntry {
+  return g.log.entries
+}
+
+func (g *Game) record(e Event) {
+  le := LogEntry{Kind: e.Kind, Turn: g.Turn, Side: g.Side}
+  if e.Ent != nil {
+    le.Ent = e.Ent.Id
+    le.Name = e.Ent.Name
+    le.X, le.Y = e.Ent.Pos()
+  }
+  switch e.Kind {
+  case EventEntityMoved, EventEntityDied, EventTurnChanged:
+
+  case EventAttack:
+    le.Target = e.Target.Id
+    le.Target_name = e.Target.Name
+    le.Hit = e.Hit
+    le.Damage = e.Damage
+    le.Hp = e.Target.Stats.HpCur()
+
+  case EventDoorChanged:
+    le.Room, le.Door = -1, -1
+    for i, room := range g.CurrentFloor().Rooms {
+      if room != e.Room {
+        continue
+      }
+      le.Room = i
+      for j, door := range room.Doors {
+        if door == e.Door {
+          le.Door = j
+        }
+      }
+    }
+    le.Opened = e.Door.Opened
+
+  default:
+    return
+  }
+  g.log.entries = append(g.log.entries, le)
+}
+
+// Remembers the state of the game so that everything logged from now on can
+// be replayed on top of it.  Does nothing if this has already been done.
+func (g *Game) startReplay() {
+  if g.log.start != nil {
+    return
+  }
+  buf := bytes.NewBuffer(nil)
+  if err := g.Save(buf); err != nil {
+    base.Warn().Printf("Unable to start recording a replay: %v", err)
+    return
+  }
+  g.log.start = buf.Bytes()
+  g.log.first = len(g.log.entries)
+}
+
+type replayFile struct {
+  Start []byte
+  Log   []LogEntry
+}
+
+// Writes a replay that Replay can use to reconstruct this game as it is now.
+// Recording starts at the beginning of the first round.
+func (g *Game) WriteReplay(w io.Writer) error {
+  if g.log.start == nil {
+    return errors.New("Nothing has been recorded yet.")
+  }
+  rf := replayFile{Start: g.log.start, Log: g.log.entries[g.log.first:]}
+  return gob.NewEncoder(w).Encode(rf)
+}
+
+// Reads a replay written by WriteReplay and returns the game as it was when
+// the replay was written.  Positions, hp, deaths, doors, and turns are
+// restored from the log, nothing else is.
+func Replay(r io.Reader) (*Game, error) {
+  return replay(r, false)
+}
+
+// Like Replay, but the game is headless.
+func ReplayHeadless(r io.Reader) (*Game, error) {
+  return replay(r, true)
+}
+
+func replay(r io.Reader, headless bool) (*Game, error) {
+  var rf replayFile
+  if err := gob.NewDecoder(r).Decode(&rf); err != nil {
+    return nil, err
+  }
+  var sg savedGame
+  if err := gob.NewDecoder(bytes.NewBuffer(rf.Start)).Decode(&sg); err != nil {
+    return nil, err
+  }
+  known := false
+  for _, name := range base.GetAllNamesInRegistry("houses") {
+    known = known || name == sg.House_name
+  }
+  if !known {
+    return nil, fmt.Errorf("Unable to find a house named '%s'.", sg.House_name)
+  }
+  load := LoadGame
+  if headless {
+    load = LoadHeadlessGame
+  }
+  g, err := load(bytes.NewBuffer(rf.Start), house.MakeHouseFromName(sg.House_name))
+  if err != nil {
+    return nil, err
+  }
+  for _, le := range rf.Log {
+    if err := g.applyLogEntry(le); err != nil {
+      return nil, err
+    }
+  }
+  return g, nil
+}
+
+func (g *Game) applyLogEntry(le LogEntry) error {
+  switch le.Kind {
+  case EventTurnChanged:
+    g.Turn = le.Turn
+    g.Side = le.Side
+    return nil
+
+  case EventDoorChanged:
+    rooms := g.CurrentFloor().Rooms
+    if le.Room < 0 || le.Room >= len(rooms) || le.Door < 0 || le.Door >= len(rooms[le.Room].Doors) {
+      return fmt.Errorf("Replay refers to a door that doesn't exist: %v", le)
+    }
+    room := rooms[le.Room]
+    door := room.Doors[le.Door]
+    door.SetOpened(le.Opened)
+    if _, other_door := g.CurrentFloor().FindMatchingDoor(room, door); other_door != nil {
+      other_door.SetOpened(le.Opened)
+    }
+    g.InvalidateLosNearDoor(room, door)
+    return nil
+  }
+
+  ent := g.EntityById(le.Ent)
+  if ent == nil {
+    return fmt.Errorf("Replay refers to an entity that doesn't exist: %v", le)
+  }
+  switch le.Kind {
+  case EventEntityMoved:
+    ent.SetPos(le.X, le.Y)
+    g.UpdateEntLos(ent, false)
+
+  case EventAttack:
+    target := g.EntityById(le.Target)
+    if target == nil || target.Stats == nil {
+      return fmt.Errorf("Replay refers to a target that doesn't exist: %v", le)
+    }
+    target.Stats.SetHp(le.Hp)
+
+  case EventEntityDied:
+    g.DespawnEntity(ent)
+  }
+  return nil
+}
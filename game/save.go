@@ -0,0 +1,283 @@
+package game
+
+import (
+  "encoding/gob"
+  "errors"
+  "fmt"
+  "github.com/runningwild/cmwc"
+  "github.com/runningwild/haunts/base"
+  "github.com/runningwild/haunts/game/status"
+  "github.com/runningwild/haunts/house"
+  "io"
+)
+
+// Everything about an entity that can't be recovered by looking its Defname
+// up in the registry.
+type savedEntity struct {
+  Defname string
+  Id      EntityId
+
+  X, Y float64
+
+  Stats *status.Inst
+
+  Ai_file_override base.Path
+  Ai_data          map[string]string
+
+  Info   Info
+  Active bool
+
+  Keys      []string
+  Inventory []savedItem
+}
+
+type savedItem struct {
+  Defname string
+  X, Y    int
+}
+
+func saveItems(items []*Item) []savedItem {
+  var saved []savedItem
+  for _, item := range items {
+    saved = append(saved, savedItem{item.Defname, item.X, item.Y})
+  }
+  return saved
+}
+
+// Doors are identified by the room they are in and where they are on its
+// walls, since the house is reloaded from the registry rather than saved.
+type savedDoor struct {
+  Floor, Room int
+  Facing      house.WallFacing
+  Pos         int
+
+  Opened, Locked bool
+}
+
+func saveDoors(h *house.HouseDef) []savedDoor {
+  var saved []savedDoor
+  for i, floor := range h.Floors {
+    for j, room := range floor.Rooms {
+      for _, door := range room.Doors {
+        saved = append(saved, savedDoor{i, j, door.Facing, door.Pos, door.Opened, door.Locked})
+      }
+    }
+  }
+  return saved
+}
+
+// Returns the door in h that sd was saved from, or nil if there isn't one.
+func (sd savedDoor) find(h *house.HouseDef) *house.Door {
+  if sd.Floor < 0 || sd.Floor >= len(h.Floors) {
+    return nil
+  }
+  rooms := h.Floors[sd.Floor].Rooms
+  if sd.Room < 0 || sd.Room >= len(rooms) {
+    return nil
+  }
+  for _, door := range rooms[sd.Room].Doors {
+    if door.Facing == sd.Facing && door.Pos == sd.Pos {
+      return door
+    }
+  }
+  return nil
+}
+
+type savedGame struct {
+  // The house is referenced by name, the caller of LoadGame is responsible
+  // for supplying the matching HouseDef.
+  House_name string
+
+  Ents  []savedEntity
+  Items []savedItem
+  Doors []savedDoor
+
+  Entity_id EntityId
+  Side      Side
+  Turn      int
+  Rand      *cmwc.Cmwc
+
+  Current_floor int
+
+  Cooldowns map[EntityId]map[string]int
+
+  Fired_triggers map[string]bool
+
+  Victory  *Victory
+  Finished bool
+  Winner   Side
+
+  Los_config *LosConfig
+}
+
+// Writes the state of an in-progress game to w.  Games cannot be saved while
+// an action is executing since there is no way to serialize a partially
+// completed action.
+func (g *Game) Save(w io.Writer) error {
+  if g.Action_state != noAction {
+    return errors.New("Cannot save a game while an action is in progress.")
+  }
+  var sg savedGame
+  sg.House_name = g.House.Name
+  sg.Entity_id = g.Entity_id
+  sg.Side = g.Side
+  sg.Turn = g.Turn
+  sg.Current_floor = g.Current_floor
+  sg.Cooldowns = g.Cooldowns
+  sg.Fired_triggers = g.Fired_triggers
+  sg.Victory = g.Victory
+  sg.Finished = g.Finished
+  sg.Winner = g.Winner
+  sg.Los_config = g.Los_config
+  sg.Rand = g.Rand
+  sg.Items = saveItems(g.Items)
+  sg.Doors = saveDoors(g.House)
+  for _, ent := range g.Ents {
+    sg.Ents = append(sg.Ents, savedEntity{
+      Defname:          ent.Defname,
+      Id:               ent.Id,
+      X:                ent.X,
+      Y:                ent.Y,
+      Stats:            ent.Stats,
+      Ai_file_override: ent.Ai_file_override,
+      Ai_data:          ent.Ai_data,
+      Info:             ent.Info,
+      Active:           ent.Active,
+      Keys:             ent.Keys,
+      Inventory:        saveItems(ent.Inventory),
+    })
+  }
+  enc := gob.NewEncoder(w)
+  return enc.Encode(sg)
+}
+
+// Reads a game that was written with Game.Save.  h must be the same house
+// that was in use when the game was saved.  Entities are recreated from the
+// registry by their Defname and then have their saved state applied on top.
+func LoadGame(r io.Reader, h *house.HouseDef) (*Game, error) {
+  return loadGame(r, h, false)
+}
+
+// Like LoadGame, but the game is headless, as with MakeHeadlessGame.
+func LoadHeadlessGame(r io.Reader, h *house.HouseDef) (*Game, error) {
+  return loadGame(r, h, true)
+}
+
+func loadGame(r io.Reader, h *house.HouseDef, headless bool) (*Game, error) {
+  var sg savedGame
+  dec := gob.NewDecoder(r)
+  if err := dec.Decode(&sg); err != nil {
+    return nil, err
+  }
+  if h == nil {
+    return nil, errors.New("Cannot load a game without a house.")
+  }
+  if h.Name != sg.House_name {
+    return nil, fmt.Errorf("Saved game uses house '%s', not '%s'.", sg.House_name, h.Name)
+  }
+  if sg.Current_floor < 0 || sg.Current_floor >= len(h.Floors) {
+    return nil, fmt.Errorf("Saved game is on floor %d, but '%s' only has %d floors.", sg.Current_floor, h.Name, len(h.Floors))
+  }
+
+  // GetObject doesn't fail gracefully on unknown names, so check them all
+  // before we start building anything.
+  known := make(map[string]bool)
+  for _, name := range base.GetAllNamesInRegistry("entities") {
+    known[name] = true
+  }
+  ids := make(map[EntityId]bool)
+  for _, se := range sg.Ents {
+    if !known[se.Defname] {
+      return nil, fmt.Errorf("Unable to find an entity named '%s'.", se.Defname)
+    }
+    // Ids are handed out in order starting at 1, so anything else means the
+    // save is corrupt and EntityById would find the wrong entity.
+    if se.Id <= 0 || se.Id >= sg.Entity_id || ids[se.Id] {
+      return nil, fmt.Errorf("Saved entity '%s' has an invalid id %d.", se.Defname, se.Id)
+    }
+    ids[se.Id] = true
+  }
+  known_items := make(map[string]bool)
+  for _, name := range GetAllItemNames() {
+    known_items[name] = true
+  }
+  all_items := append([]savedItem{}, sg.Items...)
+  for _, se := range sg.Ents {
+    all_items = append(all_items, se.Inventory...)
+  }
+  for _, si := range all_items {
+    if !known_items[si.Defname] {
+      return nil, fmt.Errorf("Unable to find an item named '%s'.", si.Defname)
+    }
+  }
+  for _, sd := range sg.Doors {
+    if sd.find(h) == nil {
+      return nil, fmt.Errorf("Saved game has a door at position %d on the %v wall of room %d on floor %d, but '%s' does not.", sd.Pos, sd.Facing, sd.Room, sd.Floor, h.Name)
+    }
+  }
+
+  var g *Game
+  if headless {
+    g = MakeHeadlessGame(h)
+  } else {
+    g = makeGame(h)
+  }
+  g.Side = sg.Side
+  g.Turn = sg.Turn
+  g.Current_floor = sg.Current_floor
+  g.Cooldowns = sg.Cooldowns
+  g.Fired_triggers = sg.Fired_triggers
+  g.markTriggerDoors()
+  g.Victory = sg.Victory
+  g.Finished = sg.Finished
+  g.Winner = sg.Winner
+  g.Los_config = sg.Los_config
+  if sg.Rand != nil {
+    g.Rand = sg.Rand
+  }
+  for _, se := range sg.Ents {
+    ent := MakeEntity(se.Defname, g)
+    ent.Id = se.Id
+    ent.X = se.X
+    ent.Y = se.Y
+    if se.Stats != nil {
+      ent.Stats = se.Stats
+    }
+    if se.Ai_file_override != ent.Ai_file_override {
+      ent.Ai_file_override = se.Ai_file_override
+      ent.LoadAi()
+    }
+    ent.Ai_data = se.Ai_data
+    ent.Info = se.Info
+    if ent.Info.RoomsExplored == nil {
+      ent.Info.RoomsExplored = make(map[int]bool)
+    }
+    ent.Active = se.Active
+    ent.Keys = se.Keys
+    for _, si := range se.Inventory {
+      ent.Inventory = append(ent.Inventory, MakeItem(si.Defname))
+    }
+    ent.refreshItemModifiers()
+    g.addEnt(ent)
+  }
+  for _, si := range sg.Items {
+    g.PlaceItem(MakeItem(si.Defname), si.X, si.Y)
+  }
+  for _, sd := range sg.Doors {
+    door := sd.find(h)
+    door.SetOpened(sd.Opened)
+    door.Locked = sd.Locked
+  }
+
+  // MakeEntity hands out ids as it goes, so this needs to be restored after
+  // all of the entities have been made.
+  g.Entity_id = sg.Entity_id
+
+  for _, ent := range g.Ents {
+    g.UpdateEntLos(ent, true)
+  }
+  g.mergeLos(SideHaunt)
+  g.mergeLos(SideExplorers)
+  g.buildActivationQueue()
+  return g, nil
+}
@@ -0,0 +1,153 @@
+package game_test
+
+import (
+  "bytes"
+  "github.com/orfjackal/gospec/src/gospec"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/runningwild/glop/util/algorithm"
+  "github.com/runningwild/haunts/base"
+  "github.com/runningwild/haunts/game"
+  "github.com/runningwild/haunts/game/status"
+  "github.com/runningwild/haunts/house"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+)
+
+func SaveSpec(c gospec.Context) {
+  house.LoadAllRoomsInDir(filepath.Join(datadir, "rooms"))
+  house.LoadAllDoorsInDir(filepath.Join(datadir, "doors"))
+  game.LoadAllEntities()
+  game.LoadAllItemsInDir(filepath.Join(datadir, "items"))
+
+  // Two rooms side-by-side connected by a door that starts out closed.
+  makeHouse := func() *house.HouseDef {
+    left := makeRoom(1, 1)
+    right := makeRoom(5, 1)
+    for _, d := range []struct {
+      room   *house.Room
+      facing house.WallFacing
+    }{{left, house.FarRight}, {right, house.NearLeft}} {
+      door := &house.Door{Defname: "Closing Door Test", Facing: d.facing, Pos: 1}
+      door.Load()
+      d.room.Doors = append(d.room.Doors, door)
+    }
+    h := &house.HouseDef{Name: "Save Test"}
+    h.Floors = append(h.Floors, &house.Floor{Rooms: []*house.Room{left, right}})
+    return h
+  }
+  passable := func(g *game.Game) bool {
+    graph := g.Graph(game.SideExplorers, false, nil)
+    _, path := algorithm.Dijkstra(graph, []int{g.ToVertex(2, 2)}, []int{g.ToVertex(7, 2)})
+    return len(path) > 0
+  }
+
+  c.Specify("Opened doors are still open after saving and loading.", func() {
+    g := game.MakeHeadlessGame(makeHouse())
+    c.Expect(passable(g), Equals, false)
+    for _, room := range g.House.Floors[0].Rooms {
+      room.Doors[0].SetOpened(true)
+    }
+    c.Expect(passable(g), Equals, true)
+
+    var buf bytes.Buffer
+    c.Assume(g.Save(&buf), IsNil)
+    loaded, err := game.LoadHeadlessGame(&buf, makeHouse())
+    c.Assume(err, IsNil)
+    c.Expect(loaded.House.Floors[0].Rooms[0].Doors[0].Opened, Equals, true)
+    c.Expect(passable(loaded), Equals, true)
+  })
+
+  c.Specify("Houses keep their rooms and doors when saved to a file.", func() {
+    dir, err := ioutil.TempDir("", "haunts")
+    c.Assume(err, IsNil)
+    defer os.RemoveAll(dir)
+    path := filepath.Join(dir, "test.house")
+    c.Assume(makeHouse().Save(path), IsNil)
+    h, err := house.MakeHouseFromPath(path)
+    c.Assume(err, IsNil)
+    c.Expect(len(h.Floors), Equals, 1)
+    c.Expect(len(h.Floors[0].Rooms), Equals, 2)
+    left, right := h.Floors[0].Rooms[0], h.Floors[0].Rooms[1]
+    c.Expect(right.X-left.X, Equals, 4)
+    c.Expect(len(left.Doors), Equals, 1)
+    room, _ := h.Floors[0].FindMatchingDoor(left, left.Doors[0])
+    c.Expect(room == right, Equals, true)
+  })
+
+  c.Specify("Houses can be converted to gob and still loaded.", func() {
+    dir, err := ioutil.TempDir("", "haunts")
+    c.Assume(err, IsNil)
+    defer os.RemoveAll(dir)
+    path := filepath.Join(dir, "test.house")
+    c.Assume(makeHouse().Save(path), IsNil)
+    house.LoadAllHousesInDir(dir)
+    c.Assume(base.ConvertFormat(dir, "json", "gob"), IsNil)
+    _, err = os.Stat(path)
+    c.Expect(err == nil, Equals, false)
+    h, err := house.MakeHouseFromPath(path + base.GobSuffix)
+    c.Assume(err, IsNil)
+    c.Expect(len(h.Floors[0].Rooms), Equals, 2)
+    c.Expect(len(h.Floors[0].Rooms[0].Doors), Equals, 1)
+  })
+
+  c.Specify("Registries that share a suffix are converted as their own types.", func() {
+    dir, err := ioutil.TempDir("", "haunts")
+    c.Assume(err, IsNil)
+    defer os.RemoveAll(dir)
+    for _, f := range []string{"doors/test.json", "furniture/crate.json"} {
+      data, err := ioutil.ReadFile(filepath.Join(datadir, f))
+      c.Assume(err, IsNil)
+      c.Assume(os.MkdirAll(filepath.Dir(filepath.Join(dir, f)), 0755), IsNil)
+      c.Assume(ioutil.WriteFile(filepath.Join(dir, f), data, 0644), IsNil)
+    }
+    house.LoadAllDoorsInDir(filepath.Join(dir, "doors"))
+    house.LoadAllFurnitureInDir(filepath.Join(dir, "furniture"))
+    c.Assume(base.ConvertFormat(dir, "json", "gob"), IsNil)
+
+    house.LoadAllDoorsInDir(filepath.Join(dir, "doors"))
+    house.LoadAllFurnitureInDir(filepath.Join(dir, "furniture"))
+    c.Expect(house.MakeDoor("Door Test").Width, Equals, 1)
+    c.Expect(house.MakeFurniture("Crate Test").Blocks_shot, Equals, true)
+  })
+
+  c.Specify("Replays end up where the game they were written from was.", func() {
+    dir, err := ioutil.TempDir("", "haunts")
+    c.Assume(err, IsNil)
+    defer os.RemoveAll(dir)
+    c.Assume(makeHouse().Save(filepath.Join(dir, "test.house")), IsNil)
+    house.LoadAllHousesInDir(dir)
+
+    g := game.MakeHeadlessGame(makeHouse())
+    ent, ok := g.SpawnEntity("Explorer Test", game.SideExplorers, 2, 2)
+    c.Assume(ok, Equals, true)
+    g.OnRound(true)
+    ent.SetPos(3, 2)
+    g.Notify(game.Event{Kind: game.EventEntityMoved, Ent: ent})
+    ent.Stats.ApplyDamage(0, -1, status.Unspecified)
+    g.Notify(game.Event{Kind: game.EventAttack, Ent: ent, Target: ent, Hit: true, Damage: 1})
+
+    var buf bytes.Buffer
+    c.Assume(g.WriteReplay(&buf), IsNil)
+    replayed, err := game.ReplayHeadless(&buf)
+    c.Assume(err, IsNil)
+    c.Expect(replayed.Turn, Equals, g.Turn)
+    c.Expect(replayed.Side, Equals, g.Side)
+    replayed_ent := replayed.EntityById(ent.Id)
+    c.Assume(replayed_ent == nil, Equals, false)
+    x, y := replayed_ent.Pos()
+    c.Expect(x, Equals, 3)
+    c.Expect(y, Equals, 2)
+    c.Expect(replayed_ent.Stats.HpCur(), Equals, ent.Stats.HpCur())
+  })
+
+  c.Specify("Saved doors that aren't in the house are an error.", func() {
+    g := game.MakeHeadlessGame(makeHouse())
+    var buf bytes.Buffer
+    c.Assume(g.Save(&buf), IsNil)
+    h := makeHouse()
+    h.Floors[0].Rooms[1].Doors = nil
+    _, err := game.LoadHeadlessGame(&buf, h)
+    c.Expect(err == nil, Equals, false)
+  })
+}
@@ -97,6 +97,13 @@ func startGameScript(gp *GamePanel, path string, player *Player, data map[string
     "SetPosition":                       func() { gp.script.L.PushGoFunctionAsCFunction(setPosition(gp)) },
     "SetHp":                             func() { gp.script.L.PushGoFunctionAsCFunction(setHp(gp)) },
     "SetAp":                             func() { gp.script.L.PushGoFunctionAsCFunction(setAp(gp)) },
+    "GiveKey":                           func() { gp.script.L.PushGoFunctionAsCFunction(giveKey(gp)) },
+    "SetDoorLocked":                     func() { gp.script.L.PushGoFunctionAsCFunction(setDoorLocked(gp)) },
+    "PlaceItem":                         func() { gp.script.L.PushGoFunctionAsCFunction(placeItem(gp)) },
+    "SetRoomDark":                       func() { gp.script.L.PushGoFunctionAsCFunction(setRoomDark(gp)) },
+    "SetLosConfig":                      func() { gp.script.L.PushGoFunctionAsCFunction(setLosConfig(gp)) },
+    "LoadVictory":                       func() { gp.script.L.PushGoFunctionAsCFunction(loadVictory(gp)) },
+    "GetOutcome":                        func() { gp.script.L.PushGoFunctionAsCFunction(getOutcome(gp)) },
     "RemoveEnt":                         func() { gp.script.L.PushGoFunctionAsCFunction(removeEnt(gp)) },
     "PlayAnimations":                    func() { gp.script.L.PushGoFunctionAsCFunction(playAnimations(gp)) },
     "PlayMusic":                         func() { gp.script.L.PushGoFunctionAsCFunction(playMusic(gp)) },
@@ -802,8 +809,7 @@ func spawnEntityAtPosition(gp *GamePanel) lua.GoFunction {
     defer gp.script.syncEnd()
     name := L.ToString(-2)
     x, y := LuaToPoint(L, -1)
-    ent := MakeEntity(name, gp.game)
-    if gp.game.SpawnEntity(ent, x, y) {
+    if ent, ok := gp.game.SpawnEntity(name, SideNone, x, y); ok {
       LuaPushEntity(L, ent)
     } else {
       L.PushNil()
@@ -827,7 +833,7 @@ func getSpawnPointsMatching(gp *GamePanel) lua.GoFunction {
     }
     L.NewTable()
     count := 0
-    for _, sp := range gp.game.House.Floors[0].Spawns {
+    for _, sp := range gp.game.CurrentFloor().Spawns {
       if !re.MatchString(sp.Name) {
         continue
       }
@@ -853,13 +859,17 @@ func spawnEntitySomewhereInSpawnPoints(gp *GamePanel) lua.GoFunction {
 
     var tx, ty int
     var count int64 = 0
+    ent_side, ok := entitySide(name)
+    if !ok {
+      base.Error().Printf("Cannot make an entity named '%s', no such thing.", name)
+      return 0
+    }
     L.PushNil()
-    ent := MakeEntity(name, gp.game)
     var side Side
-    if ent.Side() == SideExplorers {
+    if ent_side == SideExplorers {
       side = SideHaunt
     }
-    if ent.Side() == SideHaunt {
+    if ent_side == SideHaunt {
       side = SideExplorers
     }
     for L.Next(-2) != 0 {
@@ -875,7 +885,7 @@ func spawnEntitySomewhereInSpawnPoints(gp *GamePanel) lua.GoFunction {
           if gp.game.IsCellOccupied(x, y) {
             continue
           }
-          if hidden && ent.game.TeamLos(side, x, y, 1, 1) {
+          if hidden && gp.game.TeamLos(side, x, y, 1, 1) {
             continue
           }
           // This will choose a random position from all positions and giving
@@ -892,11 +902,7 @@ func spawnEntitySomewhereInSpawnPoints(gp *GamePanel) lua.GoFunction {
       base.Error().Printf("Unable to find an available position to spawn %s", name)
       return 0
     }
-    if ent == nil {
-      base.Error().Printf("Cannot make an entity named '%s', no such thing.", name)
-      return 0
-    }
-    if gp.game.SpawnEntity(ent, tx, ty) {
+    if ent, ok := gp.game.SpawnEntity(name, SideNone, tx, ty); ok {
       LuaPushEntity(L, ent)
     } else {
       L.PushNil()
@@ -978,8 +984,8 @@ func roomAtPos(gp *GamePanel) lua.GoFunction {
     gp.script.syncStart()
     defer gp.script.syncEnd()
     x, y := LuaToPoint(L, -1)
-    room, _, _ := gp.game.House.Floors[0].RoomFurnSpawnAtPos(x, y)
-    for i, r := range gp.game.House.Floors[0].Rooms {
+    room, _, _ := gp.game.CurrentFloor().RoomFurnSpawnAtPos(x, y)
+    for i, r := range gp.game.CurrentFloor().Rooms {
       if r == room {
         L.PushInteger(i)
         return 1
@@ -1267,18 +1273,19 @@ func setVisibility(gp *GamePanel) lua.GoFunction {
     gp.script.syncStart()
     defer gp.script.syncEnd()
     side_str := L.ToString(-1)
-    var side Side
+    base.Log().Printf("SetVisibility: %s", side_str)
     switch side_str {
     case "denizens":
-      side = SideHaunt
+      gp.game.SetVisibility(SideHaunt)
     case "intruders":
-      side = SideExplorers
+      gp.game.SetVisibility(SideExplorers)
+    case "turn":
+      gp.game.SetPovMode(PovTurn)
+    case "all":
+      gp.game.SetPovMode(PovAll)
     default:
       base.Error().Printf("Cannot pass '%s' as first parameter of setVisibility()", side_str)
-      return 0
     }
-    base.Log().Printf("SetVisibility: %s", side_str)
-    gp.game.SetVisibility(side)
     return 0
   }
 }
@@ -1453,6 +1460,154 @@ func setAp(gp *GamePanel) lua.GoFunction {
   }
 }
 
+func giveKey(gp *GamePanel) lua.GoFunction {
+  return func(L *lua.State) int {
+    if !LuaCheckParamsOk(L, "GiveKey", LuaEntity, LuaString) {
+      return 0
+    }
+    gp.script.syncStart()
+    defer gp.script.syncEnd()
+    ent := LuaToEntity(L, gp.game, -2)
+    if ent == nil {
+      base.Warn().Printf("Tried to GiveKey to an entity that doesn't exist.")
+      return 0
+    }
+    key := L.ToString(-1)
+    for _, k := range ent.Keys {
+      if k == key {
+        return 0
+      }
+    }
+    ent.Keys = append(ent.Keys, key)
+    return 0
+  }
+}
+
+func setDoorLocked(gp *GamePanel) lua.GoFunction {
+  return func(L *lua.State) int {
+    if !LuaCheckParamsOk(L, "SetDoorLocked", LuaDoor, LuaBoolean) {
+      return 0
+    }
+    gp.script.syncStart()
+    defer gp.script.syncEnd()
+    door := LuaToDoor(L, gp.game, -2)
+    if door == nil {
+      base.Warn().Printf("Tried to SetDoorLocked on a door that doesn't exist.")
+      return 0
+    }
+    locked := L.ToBoolean(-1)
+    door.Locked = locked
+    for _, floor := range gp.game.House.Floors {
+      for _, room := range floor.Rooms {
+        for _, d := range room.Doors {
+          if d != door {
+            continue
+          }
+          _, other_door := floor.FindMatchingDoor(room, door)
+          if other_door != nil {
+            other_door.Locked = locked
+          }
+        }
+      }
+    }
+    return 0
+  }
+}
+
+func placeItem(gp *GamePanel) lua.GoFunction {
+  return func(L *lua.State) int {
+    if !LuaCheckParamsOk(L, "PlaceItem", LuaString, LuaPoint) {
+      return 0
+    }
+    gp.script.syncStart()
+    defer gp.script.syncEnd()
+    name := L.ToString(-2)
+    x, y := LuaToPoint(L, -1)
+    for _, item_name := range GetAllItemNames() {
+      if item_name == name {
+        gp.game.PlaceItem(MakeItem(name), x, y)
+        return 0
+      }
+    }
+    base.Warn().Printf("Tried to PlaceItem an item that doesn't exist: '%s'.", name)
+    return 0
+  }
+}
+
+func setRoomDark(gp *GamePanel) lua.GoFunction {
+  return func(L *lua.State) int {
+    if !LuaCheckParamsOk(L, "SetRoomDark", LuaRoom, LuaBoolean) {
+      return 0
+    }
+    gp.script.syncStart()
+    defer gp.script.syncEnd()
+    room := LuaToRoom(L, gp.game, -2)
+    if room == nil {
+      base.Warn().Printf("Tried to SetRoomDark on a room that doesn't exist.")
+      return 0
+    }
+    gp.game.SetRoomDark(room, L.ToBoolean(-1))
+    return 0
+  }
+}
+
+func setLosConfig(gp *GamePanel) lua.GoFunction {
+  return func(L *lua.State) int {
+    if !LuaCheckParamsOk(L, "SetLosConfig", LuaInteger, LuaInteger) {
+      return 0
+    }
+    gp.script.syncStart()
+    defer gp.script.syncEnd()
+    fade_time := L.ToInteger(-2)
+    min_visibility := L.ToInteger(-1)
+    if fade_time < 0 || min_visibility < 0 || min_visibility > 255 {
+      base.Warn().Printf("Tried to SetLosConfig with invalid values: %d %d.", fade_time, min_visibility)
+      return 0
+    }
+    gp.game.SetLosConfig(LosConfig{Fade_time: int64(fade_time), Min_visibility: byte(min_visibility)})
+    return 0
+  }
+}
+
+func loadVictory(gp *GamePanel) lua.GoFunction {
+  return func(L *lua.State) int {
+    if !LuaCheckParamsOk(L, "LoadVictory", LuaString) {
+      return 0
+    }
+    gp.script.syncStart()
+    defer gp.script.syncEnd()
+    path := filepath.Join(base.GetDataDir(), filepath.FromSlash(L.ToString(-1)))
+    var victory Victory
+    if err := base.LoadJson(path, &victory); err != nil {
+      base.Warn().Printf("Unable to LoadVictory from '%s': %v", path, err)
+      return 0
+    }
+    gp.game.Victory = &victory
+    return 0
+  }
+}
+
+func getOutcome(gp *GamePanel) lua.GoFunction {
+  return func(L *lua.State) int {
+    if !LuaCheckParamsOk(L, "GetOutcome") {
+      return 0
+    }
+    gp.script.syncStart()
+    defer gp.script.syncEnd()
+    finished, winner := gp.game.Outcome()
+    L.PushBoolean(finished)
+    switch {
+    case !finished:
+      L.PushNil()
+    case winner == SideExplorers:
+      L.PushString("intruders")
+    default:
+      L.PushString("denizens")
+    }
+    return 2
+  }
+}
+
 func removeEnt(gp *GamePanel) lua.GoFunction {
   return func(L *lua.State) int {
     if !LuaCheckParamsOk(L, "RemoveEnt", LuaEntity) {
@@ -1463,19 +1618,7 @@ func removeEnt(gp *GamePanel) lua.GoFunction {
       base.Warn().Printf("Tried to RemoveEnt on an entity that doesn't exist.")
       return 0
     }
-    removed := false
-    for i := range gp.game.Ents {
-      if gp.game.Ents[i] == ent {
-        gp.game.Ents[i] = gp.game.Ents[len(gp.game.Ents)-1]
-        gp.game.Ents = gp.game.Ents[0 : len(gp.game.Ents)-1]
-        gp.game.viewer.RemoveDrawable(ent)
-        removed = true
-        break
-      }
-    }
-    if !removed {
-      base.Warn().Printf("Tried to RemoveEnt an entity that wasn't in the game.")
-    }
+    gp.game.DespawnEntity(ent)
     return 0
   }
 }
@@ -1643,7 +1786,7 @@ func setLosMode(gp *GamePanel) lua.GoFunction {
         return 0
       }
       L.PushNil()
-      all_rooms := gp.game.House.Floors[0].Rooms
+      all_rooms := gp.game.CurrentFloor().Rooms
       var rooms []*house.Room
       for L.Next(-2) != 0 {
         index := L.ToInteger(-1)
@@ -1691,7 +1834,7 @@ func endGameFunc(gp *GamePanel) lua.GoFunction {
     if !LuaCheckParamsOk(L, "EndGame") {
       return 0
     }
-    gp.game.Ents = nil
+    gp.game.clearEnts()
     gp.game.Think(1) // This should clean things up
     Restart()
     return 1
@@ -492,7 +492,7 @@ func LuaToDoor(L *lua.State, game *Game, index int) *house.Door {
 
 func LuaPushSpawnPoint(L *lua.State, game *Game, sp *house.SpawnPoint) {
   index := -1
-  for i, spawn := range game.House.Floors[0].Spawns {
+  for i, spawn := range game.CurrentFloor().Spawns {
     if spawn == sp {
       index = i
     }
@@ -533,10 +533,10 @@ func LuaToSpawnPoint(L *lua.State, game *Game, pos int) *house.SpawnPoint {
   L.GetTable(pos - 1)
   index := L.ToInteger(-1)
   L.Pop(1)
-  if index < 0 || index >= len(game.House.Floors[0].Spawns) {
+  if index < 0 || index >= len(game.CurrentFloor().Spawns) {
     return nil
   }
-  return game.House.Floors[0].Spawns[index]
+  return game.CurrentFloor().Spawns[index]
 }
 
 type LuaType int
@@ -0,0 +1,77 @@
+package game
+
+import (
+  "sort"
+)
+
+// Sorts entities so that the ones drawn in front come first.  Cells nearer
+// to the camera have smaller x+y, ties are broken by EntityId so that the
+// order is stable.
+type byDepth []*Entity
+
+func (b byDepth) Len() int {
+  return len(b)
+}
+func (b byDepth) Swap(i, j int) {
+  b[i], b[j] = b[j], b[i]
+}
+func (b byDepth) Less(i, j int) bool {
+  xi, yi := b[i].FPos()
+  xj, yj := b[j].FPos()
+  if xi+yi != xj+yj {
+    return xi+yi < xj+yj
+  }
+  return b[i].Id < b[j].Id
+}
+
+// Returns every living entity whose sprite covers the window coordinates wx,
+// wy, frontmost first.
+func (g *Game) entsAt(wx, wy int) []*Entity {
+  var ents []*Entity
+  for _, ent := range g.Ents {
+    if ent.Stats != nil && ent.Stats.HpCur() <= 0 {
+      continue
+    }
+    fx, fy := ent.FPos()
+    x, y := g.viewer.BoardToWindow(float32(fx), float32(fy))
+    x2 := x + int(ent.last_render_width/2)
+    y2 := y + int(150*ent.last_render_width/100)
+    x -= int(ent.last_render_width / 2)
+    if wx >= x && wx <= x2 && wy >= y && wy <= y2 {
+      ents = append(ents, ent)
+    }
+  }
+  sort.Sort(byDepth(ents))
+  return ents
+}
+
+// Selects the frontmost entity on the current side under the window
+// coordinates wx, wy.  If the selected entity is already under that point
+// then the next one behind it is selected instead, so that clicking the same
+// spot repeatedly cycles through everything that is stacked up there.
+// Returns the entity that ends up selected, or nil if there was nothing to
+// select.
+func (g *Game) SelectAt(wx, wy int) *Entity {
+  var candidates []*Entity
+  for _, ent := range g.entsAt(wx, wy) {
+    if ent.Side() == g.Side {
+      candidates = append(candidates, ent)
+    }
+  }
+  if len(candidates) == 0 {
+    return nil
+  }
+  next := candidates[0]
+  for i, ent := range candidates {
+    if ent == g.selected_ent {
+      next = candidates[(i+1)%len(candidates)]
+      break
+    }
+  }
+  if g.selected_ent != nil {
+    g.selected_ent.selected = false
+  }
+  g.selected_ent = next
+  g.selected_ent.selected = true
+  return next
+}
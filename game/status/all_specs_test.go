@@ -10,5 +10,6 @@ func TestAllSpecs(t *testing.T) {
   status.RegisterAllConditions()
   r := gospec.NewRunner()
   r.AddSpec(ConditionsSpec)
+  r.AddSpec(ModifiersSpec)
   gospec.MainGoTest(r, t)
 }
@@ -89,6 +89,10 @@ type BasicConditionDef struct {
   // to the unit's Base stats
   Base Base
 
+  // Applied to its target unit after Base, this allows for multiplicative
+  // changes to the unit's stats.
+  Modifiers []Modifier
+
   // Use Type here instead of Kind so it doesn't overlap with the required
   // method name Kind.  Also Type will be used in the json files so it should
   // be no less obvious what it is.
@@ -131,11 +135,12 @@ func (bc *BasicConditionDef) ModifyBase(base Base, kind Kind) Base {
   base.Attack += bc.Base.Attack
   base.Corpus += bc.Base.Corpus
   base.Ego += bc.Base.Ego
+  base.Initiative += bc.Base.Initiative
   if val, ok := bc.Resistances[string(kind)]; ok {
     base.Corpus += val
     base.Ego += val
   }
-  return base
+  return applyModifiers(base, bc.Modifiers)
 }
 
 func (bc *BasicCondition) OnRound() (dmg *Damage, complete bool) {
@@ -154,4 +154,49 @@ func ConditionsSpec(c gospec.Context) {
     s.OnRound()
     c.Expect(s.HpCur(), Equals, 75)
   })
+
+  c.Specify("A two round poison deals damage exactly twice", func() {
+    var s status.Inst
+    s.UnmarshalJSON([]byte(`
+      {
+        "Base": {
+          "Hp_max": 20,
+          "Ap_max": 10
+        },
+        "Dynamic": {
+          "Hp": 20
+        }
+      }`))
+    s.ApplyCondition(status.MakeCondition("Poison Test"))
+    c.Expect(len(s.ConditionNames()), Equals, 1)
+    c.Expect(s.ConditionKinds()[0], Equals, status.Poison)
+    s.OnRound()
+    c.Expect(s.HpCur(), Equals, 17)
+    s.OnRound()
+    c.Expect(s.HpCur(), Equals, 14)
+    c.Expect(len(s.ConditionNames()), Equals, 0)
+    s.OnRound()
+    c.Expect(s.HpCur(), Equals, 14)
+  })
+
+  c.Specify("Slowing conditions reduce ap until they expire", func() {
+    var s status.Inst
+    s.UnmarshalJSON([]byte(`
+      {
+        "Base": {
+          "Hp_max": 20,
+          "Ap_max": 10
+        },
+        "Dynamic": {
+          "Hp": 20
+        }
+      }`))
+    s.ApplyCondition(status.MakeCondition("Slow Test"))
+    s.OnRound()
+    c.Expect(s.ApCur(), Equals, 6)
+    s.OnRound()
+    c.Expect(s.ApCur(), Equals, 6)
+    s.OnRound()
+    c.Expect(s.ApCur(), Equals, 10)
+  })
 }
@@ -0,0 +1,103 @@
+package status
+
+// Which of the Base stats a Modifier changes, these match the names of the
+// fields in Base.
+type Stat string
+
+const (
+  Stat_ApMax      Stat = "Ap_max"
+  Stat_HpMax      Stat = "Hp_max"
+  Stat_Corpus     Stat = "Corpus"
+  Stat_Ego        Stat = "Ego"
+  Stat_Sight      Stat = "Sight"
+  Stat_Attack     Stat = "Attack"
+  Stat_Initiative Stat = "Initiative"
+)
+
+// A Modifier changes one of a unit's Base stats until it is removed.  Every
+// modifier's Add is applied before any of their Mults, so the order that
+// modifiers are added in doesn't change the result.
+type Modifier struct {
+  // Whatever attached this modifier, e.g. the name of an item.  Modifiers
+  // are removed by their source.
+  Source string
+
+  Stat Stat
+
+  // Amount added to the stat
+  Add int
+
+  // The stat is multiplied by this, 0 is the same as 1 so that purely
+  // additive modifiers don't need to specify it.
+  Mult float64
+
+  // Persistent modifiers are saved along with the rest of the unit's stats,
+  // others are expected to be reattached by their source when it is loaded.
+  Persistent bool
+}
+
+func (m Modifier) stat(b *Base) *int {
+  switch m.Stat {
+  case Stat_ApMax:
+    return &b.Ap_max
+  case Stat_HpMax:
+    return &b.Hp_max
+  case Stat_Corpus:
+    return &b.Corpus
+  case Stat_Ego:
+    return &b.Ego
+  case Stat_Sight:
+    return &b.Sight
+  case Stat_Attack:
+    return &b.Attack
+  case Stat_Initiative:
+    return &b.Initiative
+  }
+  return nil
+}
+
+func applyModifiers(b Base, mods []Modifier) Base {
+  for _, m := range mods {
+    if v := m.stat(&b); v != nil {
+      *v += m.Add
+    }
+  }
+  for _, m := range mods {
+    if v := m.stat(&b); v != nil && m.Mult != 0 {
+      *v = int(float64(*v) * m.Mult)
+    }
+  }
+  return b
+}
+
+func (s *Inst) AddModifier(m Modifier) {
+  s.inst.Modifiers = append(s.inst.Modifiers, m)
+}
+
+// Removes every modifier that was attached by source.
+func (s *Inst) RemoveModifiers(source string) {
+  var keep []Modifier
+  for _, m := range s.inst.Modifiers {
+    if m.Source != source {
+      keep = append(keep, m)
+    }
+  }
+  s.inst.Modifiers = keep
+}
+
+// Returns a copy of the modifiers currently attached.
+func (s *Inst) Modifiers() []Modifier {
+  return append([]Modifier{}, s.inst.Modifiers...)
+}
+
+// Returns s.inst without any modifiers that shouldn't be saved.
+func (s Inst) persistent() inst {
+  in := s.inst
+  in.Modifiers = nil
+  for _, m := range s.inst.Modifiers {
+    if m.Persistent {
+      in.Modifiers = append(in.Modifiers, m)
+    }
+  }
+  return in
+}
@@ -0,0 +1,46 @@
+package status_test
+
+import (
+  "bytes"
+  "encoding/gob"
+  "github.com/orfjackal/gospec/src/gospec"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/runningwild/haunts/game/status"
+)
+
+func ModifiersSpec(c gospec.Context) {
+  var s status.Inst
+  err := s.UnmarshalJSON([]byte(`{"Base": {"Ap_max": 10, "Hp_max": 10, "Attack": 2}}`))
+  c.Assume(err, Equals, nil)
+
+  c.Specify("Adds are applied before mults regardless of order.", func() {
+    s.AddModifier(status.Modifier{Source: "a", Stat: status.Stat_ApMax, Mult: 2})
+    s.AddModifier(status.Modifier{Source: "b", Stat: status.Stat_ApMax, Add: 3})
+    c.Expect(s.ApMax(), Equals, 26)
+    c.Expect(s.HpMax(), Equals, 10)
+  })
+
+  c.Specify("Modifiers are removed by source.", func() {
+    s.AddModifier(status.Modifier{Source: "a", Stat: status.Stat_Attack, Add: 1})
+    s.AddModifier(status.Modifier{Source: "a", Stat: status.Stat_HpMax, Add: -4})
+    s.AddModifier(status.Modifier{Source: "b", Stat: status.Stat_Attack, Add: 5})
+    c.Expect(s.AttackBonusWith(status.Unspecified), Equals, 8)
+    s.RemoveModifiers("a")
+    c.Expect(s.AttackBonusWith(status.Unspecified), Equals, 7)
+    c.Expect(s.HpMax(), Equals, 10)
+    c.Expect(len(s.Modifiers()), Equals, 1)
+  })
+
+  c.Specify("Only persistent modifiers are gobbed.", func() {
+    s.AddModifier(status.Modifier{Source: "a", Stat: status.Stat_ApMax, Add: 1, Persistent: true})
+    s.AddModifier(status.Modifier{Source: "b", Stat: status.Stat_ApMax, Add: 2})
+    buf := bytes.NewBuffer(nil)
+    err := gob.NewEncoder(buf).Encode(s)
+    c.Assume(err, Equals, nil)
+    var s2 status.Inst
+    err = gob.NewDecoder(buf).Decode(&s2)
+    c.Assume(err, Equals, nil)
+    c.Expect(s2.ApMax(), Equals, 11)
+    c.Expect(len(s2.Modifiers()), Equals, 1)
+  })
+}
@@ -83,6 +83,9 @@ type Base struct {
   Ego    int
   Sight  int
   Attack int
+
+  // Entities with higher initiative act earlier in their side's turn
+  Initiative int
 }
 
 func MakeInst(b Base) Inst {
@@ -95,6 +98,7 @@ type inst struct {
   Base       Base
   Dynamic    Dynamic
   Conditions []Condition
+  Modifiers  []Modifier
 }
 
 type Inst struct {
@@ -105,7 +109,7 @@ type Inst struct {
 }
 
 func (s Inst) modifiedBase(kind Kind) Base {
-  b := s.inst.Base
+  b := applyModifiers(s.inst.Base, s.inst.Modifiers)
   for _, e := range s.inst.Conditions {
     b = e.ModifyBase(b, kind)
   }
@@ -181,6 +185,10 @@ func (s Inst) Sight() int {
   return sight
 }
 
+func (s Inst) Initiative() int {
+  return s.modifiedBase(Unspecified).Initiative
+}
+
 // Returns a list of the names of the conditions this status object currently
 // has.  This lets external packages see the conditions without accidentally
 // mucking with them.
@@ -195,6 +203,18 @@ func (s *Inst) ConditionNames() []string {
   return names
 }
 
+// Returns the Kind of each condition, in the same order as ConditionNames.
+func (s *Inst) ConditionKinds() []Kind {
+  if s == nil {
+    return nil
+  }
+  kinds := make([]Kind, len(s.inst.Conditions))
+  for i := range kinds {
+    kinds[i] = s.inst.Conditions[i].Kind()
+  }
+  return kinds
+}
+
 func (s *Inst) ApplyCondition(c Condition) {
   for i := range s.inst.Conditions {
     if s.inst.Conditions[i].Kind() == c.Kind() {
@@ -288,7 +308,7 @@ func (s *Inst) OnRound() {
 // Encoding routines - only support json and gob right now
 
 func (si Inst) MarshalJSON() ([]byte, error) {
-  return json.Marshal(si.inst)
+  return json.Marshal(si.persistent())
 }
 
 func (si *Inst) UnmarshalJSON(data []byte) error {
@@ -298,7 +318,7 @@ func (si *Inst) UnmarshalJSON(data []byte) error {
 func (si Inst) GobEncode() ([]byte, error) {
   buf := bytes.NewBuffer(nil)
   enc := gob.NewEncoder(buf)
-  err := enc.Encode(si.inst)
+  err := enc.Encode(si.persistent())
   return buf.Bytes(), err
 }
 
@@ -0,0 +1,107 @@
+package game
+
+import (
+  gl "github.com/chsc/gogl/gl21"
+  "github.com/runningwild/haunts/house"
+)
+
+// The cells that the current entity has walked through since its activation
+// started, oldest first.  This is drawn on the floor so that players can see
+// how far a unit has already moved this turn.
+type movementTrail struct {
+  ent   *Entity
+  cells [][2]int
+}
+
+func (t *movementTrail) bounds() (minx, miny, maxx, maxy int) {
+  if len(t.cells) == 0 {
+    return 0, 0, -1, -1
+  }
+  minx, miny = t.cells[0][0], t.cells[0][1]
+  maxx, maxy = minx, miny
+  for _, cell := range t.cells[1:] {
+    if cell[0] < minx {
+      minx = cell[0]
+    }
+    if cell[0] > maxx {
+      maxx = cell[0]
+    }
+    if cell[1] < miny {
+      miny = cell[1]
+    }
+    if cell[1] > maxy {
+      maxy = cell[1]
+    }
+  }
+  return
+}
+
+func (t *movementTrail) Dims() (int, int) {
+  minx, miny, maxx, maxy := t.bounds()
+  return maxx - minx + 1, maxy - miny + 1
+}
+func (t *movementTrail) Pos() (int, int) {
+  minx, miny, _, _ := t.bounds()
+  return minx, miny
+}
+func (t *movementTrail) RenderOnFloor() {
+  if len(t.cells) == 0 {
+    return
+  }
+  r, g, b, a := house.CurrentPalette().Trail.RGBA()
+  gl.Disable(gl.TEXTURE_2D)
+  gl.Begin(gl.QUADS)
+  for i, cell := range t.cells {
+    // Older cells are fainter so the direction of travel is obvious
+    alpha := int(a)/4 + (3*int(a)*(i+1))/(4*len(t.cells))
+    gl.Color4ub(r, g, b, uint8(alpha))
+    x, y := int32(cell[0]), int32(cell[1])
+    gl.Vertex2i(x, y)
+    gl.Vertex2i(x, y+1)
+    gl.Vertex2i(x+1, y+1)
+    gl.Vertex2i(x+1, y)
+  }
+  gl.End()
+  gl.Enable(gl.TEXTURE_2D)
+}
+
+// Adds ent's current cell to the trail if ent is on the side whose turn it
+// is.  The trail starts over whenever a different entity moves, and when an
+// activation ends.
+func (g *Game) recordTrail(ent *Entity) {
+  if ent.Side() != g.Side {
+    return
+  }
+  if g.trail.ent != ent {
+    g.clearTrail()
+    g.trail.ent = ent
+  }
+  x, y := ent.Pos()
+  if n := len(g.trail.cells); n > 0 && g.trail.cells[n-1] == [2]int{x, y} {
+    return
+  }
+  g.trail.cells = append(g.trail.cells, [2]int{x, y})
+}
+
+func (g *Game) clearTrail() {
+  g.trail.ent = nil
+  g.trail.cells = g.trail.cells[0:0]
+}
+
+// Sets whether the cells the current entity has moved through during its
+// activation are drawn on the floor.
+func (g *Game) SetTrailVisible(visible bool) {
+  if visible == g.show_trail {
+    return
+  }
+  g.show_trail = visible
+  if visible {
+    g.viewer.AddFloorDrawable(&g.trail)
+  } else {
+    g.viewer.RemoveFloorDrawable(&g.trail)
+  }
+}
+
+func (g *Game) TrailVisible() bool {
+  return g.show_trail
+}
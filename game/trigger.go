@@ -0,0 +1,314 @@
+package game
+
+import (
+  "fmt"
+  "github.com/runningwild/haunts/base"
+  "github.com/runningwild/haunts/game/status"
+  "github.com/runningwild/haunts/house"
+)
+
+// A trigger does something once its condition is met.  Triggers are loaded
+// into the "triggers" registry and placed on a house by listing their names
+// in a Floor's or a Room's Triggers.  Exactly one of Enter, Turn, and Pickup
+// should be set, every effect that is set happens when the trigger fires.
+type triggerDef struct {
+  Name string
+
+  // Fires when an entity moves into a cell in the region.
+  Enter *TriggerRegion
+
+  // Fires at the start of this turn.
+  Turn int
+
+  // Fires when an item with this name is picked up.
+  Pickup string
+
+  // Triggers only fire once unless they are repeatable.
+  Repeatable bool
+
+  // Makes an entity with this name at Spawn_x, Spawn_y, in floor coordinates.
+  Spawn            string
+  Spawn_x, Spawn_y int
+
+  // Changes the Door-th door of the Room-th room on the current floor.
+  Door *TriggerDoor
+
+  // Applied to the entity that caused the trigger to fire, if there is one.
+  Condition string
+
+  // Shown to the player for a few seconds.
+  Message string
+}
+
+type TriggerRegion struct {
+  // "intruders" or "denizens", or empty for entities on any side.
+  Side string
+
+  // If Dx or Dy is zero the region is the entire room the trigger is placed
+  // on, or the entire floor.  Otherwise X and Y are relative to the room, if
+  // the trigger is on one.
+  X, Y, Dx, Dy int
+}
+
+type TriggerDoor struct {
+  Room, Door int
+
+  // Each of these is only changed if it is set.
+  Opened, Locked *bool
+}
+
+type Trigger struct {
+  Defname string
+  *triggerDef
+}
+
+// Incremented every time the trigger registry is reloaded, so that games
+// know to look their triggers up again.
+var trigger_generation int
+
+func LoadAllTriggersInDir(dir string) {
+  base.RemoveRegistry("triggers")
+  base.RegisterRegistry("triggers", make(map[string]*triggerDef))
+  base.RegisterAllObjectsInDir("triggers", dir, ".json", "json")
+  trigger_generation++
+}
+
+// How long, in milliseconds, a trigger's message stays on screen.
+const triggerMessageTime = 4000
+
+// The name of a trigger placed on a floor, and the room, and its index, that
+// it was placed on.  room is nil and index is -1 for the floor itself.
+type triggerPlacement struct {
+  name  string
+  room  *house.Room
+  index int
+}
+
+type triggerCache struct {
+  floor       *house.Floor
+  floor_index int
+  generation  int
+  placements  []triggerPlacement
+
+  triggers []*Trigger
+  rooms    []*house.Room
+  keys     []string
+}
+
+// Returns true if the triggers in the cache are the ones placed on floor,
+// which is the floor_index-th floor.
+func (tc *triggerCache) matches(floor *house.Floor, floor_index int) bool {
+  if tc.floor != floor || tc.floor_index != floor_index || tc.generation != trigger_generation {
+    return false
+  }
+  n := 0
+  check := func(name string, room *house.Room, index int) bool {
+    if n >= len(tc.placements) || tc.placements[n] != (triggerPlacement{name, room, index}) {
+      return false
+    }
+    n++
+    return true
+  }
+  for _, name := range floor.Triggers {
+    if !check(name, nil, -1) {
+      return false
+    }
+  }
+  for i, room := range floor.Rooms {
+    for _, name := range room.Triggers {
+      if !check(name, room, i) {
+        return false
+      }
+    }
+  }
+  return n == len(tc.placements)
+}
+
+// Returns the triggers placed on the current floor and its rooms, along with
+// the room each is on and a key that identifies it in Fired_triggers.  Rooms
+// are nil for triggers on the floor itself.  The triggers are only looked up
+// again when the floor, the triggers placed on it, or the registry changes.
+// Firing a trigger can cause this to be called again, so the cache is rebuilt
+// into new slices rather than reusing the old ones.
+func (g *Game) placedTriggers() (triggers []*Trigger, rooms []*house.Room, keys []string) {
+  floor := g.CurrentFloor()
+  cache := &g.trigger_cache
+  if cache.matches(floor, g.Current_floor) {
+    return cache.triggers, cache.rooms, cache.keys
+  }
+  var placements []triggerPlacement
+  add := func(name string, room *house.Room, index int, key string) {
+    placements = append(placements, triggerPlacement{name, room, index})
+    for _, known := range base.GetAllNamesInRegistry("triggers") {
+      if known == name {
+        t := Trigger{Defname: name}
+        base.GetObject("triggers", &t)
+        triggers = append(triggers, &t)
+        rooms = append(rooms, room)
+        keys = append(keys, key)
+        return
+      }
+    }
+    base.Warn().Printf("Unable to find a trigger named '%s'.", name)
+  }
+  for _, name := range floor.Triggers {
+    add(name, nil, -1, fmt.Sprintf("%d:%s", g.Current_floor, name))
+  }
+  for i, room := range floor.Rooms {
+    for _, name := range room.Triggers {
+      add(name, room, i, fmt.Sprintf("%d:%d:%s", g.Current_floor, i, name))
+    }
+  }
+  *cache = triggerCache{
+    floor:       floor,
+    floor_index: g.Current_floor,
+    generation:  trigger_generation,
+    placements:  placements,
+    triggers:    triggers,
+    rooms:       rooms,
+    keys:        keys,
+  }
+  return
+}
+
+// Returns true if x, y, given in floor coordinates, is in r.  room is the
+// room the trigger is on, or nil.
+func (r *TriggerRegion) contains(room *house.Room, x, y int) bool {
+  if r.Dx <= 0 || r.Dy <= 0 {
+    return room == nil || room.Contains(x, y)
+  }
+  if room != nil {
+    x, y = room.ToLocal(x, y)
+  }
+  return x >= r.X && y >= r.Y && x < r.X+r.Dx && y < r.Y+r.Dy
+}
+
+func (r *TriggerRegion) matchesSide(side Side) bool {
+  if r.Side == "" {
+    return true
+  }
+  s, ok := sideFromString(r.Side)
+  if !ok {
+    base.Warn().Printf("Unknown side '%s' in a trigger region.", r.Side)
+  }
+  return ok && s == side
+}
+
+// Fires any triggers whose condition is met by e.
+func (g *Game) checkTriggers(e Event) {
+  var met []int
+  triggers, rooms, keys := g.placedTriggers()
+  for i, t := range triggers {
+    if g.Fired_triggers[keys[i]] && !t.Repeatable {
+      continue
+    }
+    switch {
+    case t.Enter != nil:
+      if e.Kind != EventEntityMoved || !t.Enter.matchesSide(e.Ent.Side()) {
+        continue
+      }
+      x, y := e.Ent.Pos()
+      if !t.Enter.contains(rooms[i], x, y) {
+        continue
+      }
+
+    case t.Turn > 0:
+      if e.Kind != EventTurnChanged || e.Turn < t.Turn {
+        continue
+      }
+
+    case t.Pickup != "":
+      if e.Kind != EventItemPickedUp || e.Item.Defname != t.Pickup {
+        continue
+      }
+
+    default:
+      continue
+    }
+    met = append(met, i)
+  }
+
+  // Everything is marked before any effects happen since the effects can
+  // cause more events.
+  for _, i := range met {
+    if g.Fired_triggers == nil {
+      g.Fired_triggers = make(map[string]bool)
+    }
+    g.Fired_triggers[keys[i]] = true
+  }
+  for _, i := range met {
+    g.fireTrigger(triggers[i], e.Ent)
+  }
+  if len(met) > 0 {
+    g.markTriggerDoors()
+  }
+}
+
+// Marks every door on the current floor that a trigger can still change as
+// an objective, and clears the mark on every other door.
+func (g *Game) markTriggerDoors() {
+  floor := g.CurrentFloor()
+  for _, room := range floor.Rooms {
+    for _, door := range room.Doors {
+      door.SetObjective(false)
+    }
+  }
+  triggers, _, keys := g.placedTriggers()
+  for i, t := range triggers {
+    if t.Door == nil || (g.Fired_triggers[keys[i]] && !t.Repeatable) {
+      continue
+    }
+    td := t.Door
+    if td.Room < 0 || td.Room >= len(floor.Rooms) || td.Door < 0 || td.Door >= len(floor.Rooms[td.Room].Doors) {
+      continue
+    }
+    room := floor.Rooms[td.Room]
+    door := room.Doors[td.Door]
+    door.SetObjective(true)
+    if _, other_door := floor.FindMatchingDoor(room, door); other_door != nil {
+      other_door.SetObjective(true)
+    }
+  }
+}
+
+func (g *Game) fireTrigger(t *Trigger, ent *Entity) {
+  base.Log().Printf("Trigger '%s' fired.", t.Name)
+  if t.Spawn != "" {
+    g.SpawnEntity(t.Spawn, SideNone, t.Spawn_x, t.Spawn_y)
+  }
+  if t.Door != nil {
+    g.applyTriggerDoor(t.Door)
+  }
+  if t.Condition != "" && ent != nil && ent.Stats != nil {
+    ent.Stats.ApplyCondition(status.MakeCondition(t.Condition))
+  }
+  if t.Message != "" {
+    g.message.text = t.Message
+    g.message.remaining = triggerMessageTime
+  }
+}
+
+func (g *Game) applyTriggerDoor(td *TriggerDoor) {
+  floor := g.CurrentFloor()
+  if td.Room < 0 || td.Room >= len(floor.Rooms) || td.Door < 0 || td.Door >= len(floor.Rooms[td.Room].Doors) {
+    base.Warn().Printf("Trigger refers to a door that doesn't exist: %v", *td)
+    return
+  }
+  room := floor.Rooms[td.Room]
+  door := room.Doors[td.Door]
+  _, other_door := floor.FindMatchingDoor(room, door)
+  if td.Locked != nil {
+    door.Locked = *td.Locked
+    if other_door != nil {
+      other_door.Locked = *td.Locked
+    }
+  }
+  if td.Opened != nil && door.Opened != *td.Opened {
+    door.SetOpened(*td.Opened)
+    if other_door != nil {
+      other_door.SetOpened(*td.Opened)
+    }
+    g.InvalidateLosNearDoor(room, door)
+    g.Notify(Event{Kind: EventDoorChanged, Room: room, Door: door})
+  }
+}
@@ -0,0 +1,47 @@
+package game_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/runningwild/haunts/game"
+  "github.com/runningwild/haunts/house"
+  "path/filepath"
+)
+
+func TriggerSpec(c gospec.Context) {
+  house.LoadAllRoomsInDir(filepath.Join(datadir, "rooms"))
+  house.LoadAllDoorsInDir(filepath.Join(datadir, "doors"))
+  game.LoadAllTriggersInDir(filepath.Join(datadir, "triggers"))
+
+  left := makeRoom(1, 1)
+  right := makeRoom(5, 1)
+  left.Doors = append(left.Doors, makeDoor(house.FarRight, 1))
+  right.Doors = append(right.Doors, makeDoor(house.NearLeft, 1))
+  floor := &house.Floor{Rooms: []*house.Room{left, right}, Triggers: []string{"Turn Test"}}
+  h := &house.HouseDef{Name: "Trigger Test", Floors: []*house.Floor{floor}}
+  g := game.MakeHeadlessGame(h)
+
+  c.Specify("Triggers wait for their condition.", func() {
+    g.Notify(game.Event{Kind: game.EventTurnChanged, Turn: 2})
+    c.Expect(len(g.Fired_triggers), Equals, 0)
+    c.Expect(left.Doors[0].Locked, Equals, false)
+  })
+
+  c.Specify("Triggers apply their effects to both sides of a door, and only fire once.", func() {
+    g.Notify(game.Event{Kind: game.EventTurnChanged, Turn: 3})
+    c.Expect(len(g.Fired_triggers), Equals, 1)
+    c.Expect(left.Doors[0].Locked, Equals, true)
+    c.Expect(right.Doors[0].Locked, Equals, true)
+    left.Doors[0].Locked = false
+    g.Notify(game.Event{Kind: game.EventTurnChanged, Turn: 4})
+    c.Expect(left.Doors[0].Locked, Equals, false)
+  })
+
+  c.Specify("Doors that a trigger will change are objectives until it fires.", func() {
+    c.Expect(left.Doors[0].IsObjective(), Equals, true)
+    c.Expect(right.Doors[0].IsObjective(), Equals, true)
+    g.Notify(game.Event{Kind: game.EventTurnChanged, Turn: 3})
+    c.Expect(left.Doors[0].IsObjective(), Equals, false)
+    c.Expect(right.Doors[0].IsObjective(), Equals, false)
+  })
+}
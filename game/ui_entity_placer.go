@@ -78,7 +78,7 @@ func MakeEntityPlacer(game *Game, roster_names []string, roster_costs []int, min
     ent := ep.ents[len(ep.ents)-1]
     ep.points += ep.roster[ent.Name]
     ep.ents = ep.ents[0 : len(ep.ents)-1]
-    algorithm.Choose2(&game.Ents, func(e *Entity) bool { return e != ent })
+    game.removeEnt(ent)
     game.viewer.RemoveDrawable(ent)
   }
 
@@ -209,7 +209,7 @@ func (ep *EntityPlacer) Respond(g *gui.Gui, group gui.EventGroup) bool {
     return false
   }
 
-  if found, event := group.FindEvent(gin.MouseLButton); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["place"].Id()); found && event.Type == gin.Press {
     ent := ep.game.new_ent
     if ep.game.placeEntity(ep.pattern) {
       cost := ep.roster[ent.Name]
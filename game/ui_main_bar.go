@@ -133,55 +133,32 @@ func buttonFuncActionRight(mbi interface{}) {
   mb := mbi.(*MainBar)
   mb.state.Actions.scroll_target += float64(mb.layout.Actions.Count)
 }
-func buttonFuncUnitLeft(mbi interface{}) {
-  mb := mbi.(*MainBar)
-  if !mb.game.SetCurrentAction(nil) || len(mb.game.Ents) == 0 {
+// Selects the unit on the current side after the one the main bar is
+// showing, or before it if step is -1, wrapping around at either end.
+func (mb *MainBar) cycleUnit(step int) {
+  if !mb.game.SetCurrentAction(nil) {
     return
   }
-  start_index := len(mb.game.Ents) - 1
-  for i := 0; i < len(mb.game.Ents); i++ {
-    if mb.game.Ents[i] == mb.ent {
-      start_index = i
-      break
-    }
+  ents := mb.game.EntsForSide(mb.game.Side)
+  if len(ents) == 0 {
+    return
   }
-  for i := start_index - 1; i >= 0; i-- {
-    if mb.game.Ents[i].Side() == mb.game.Side {
-      mb.game.SelectEnt(mb.game.Ents[i])
-      return
-    }
+  next := 0
+  if step < 0 {
+    next = len(ents) - 1
   }
-  for i := len(mb.game.Ents) - 1; i >= start_index; i-- {
-    if mb.game.Ents[i].Side() == mb.game.Side {
-      mb.game.SelectEnt(mb.game.Ents[i])
-      return
+  for i, ent := range ents {
+    if ent == mb.ent {
+      next = (i + step + len(ents)) % len(ents)
     }
   }
+  mb.game.SelectEnt(ents[next])
+}
+func buttonFuncUnitLeft(mbi interface{}) {
+  mbi.(*MainBar).cycleUnit(-1)
 }
 func buttonFuncUnitRight(mbi interface{}) {
-  mb := mbi.(*MainBar)
-  if !mb.game.SetCurrentAction(nil) || len(mb.game.Ents) == 0 {
-    return
-  }
-  start_index := 0
-  for i := 0; i < len(mb.game.Ents); i++ {
-    if mb.game.Ents[i] == mb.ent {
-      start_index = i
-      break
-    }
-  }
-  for i := start_index + 1; i < len(mb.game.Ents); i++ {
-    if mb.game.Ents[i].Side() == mb.game.Side {
-      mb.game.SelectEnt(mb.game.Ents[i])
-      return
-    }
-  }
-  for i := 0; i <= start_index; i++ {
-    if mb.game.Ents[i].Side() == mb.game.Side {
-      mb.game.SelectEnt(mb.game.Ents[i])
-      return
-    }
-  }
+  mbi.(*MainBar).cycleUnit(1)
 }
 
 func MakeMainBar(game *Game) (*MainBar, error) {
@@ -526,7 +503,7 @@ func (m *MainBar) Draw(region gui.Region) {
         }
         gl.Enable(gl.TEXTURE_2D)
         action.Icon().Data().Bind()
-        if action.Preppable(m.ent, m.game) {
+        if action.Preppable(m.ent, m.game) && action.ApCost(m.ent, m.game) <= m.ent.Stats.ApCur() {
           gl.Color4d(1, 1, 1, 1)
         } else {
           gl.Color4d(0.5, 0.5, 0.5, 1)
@@ -560,7 +537,7 @@ func (m *MainBar) Draw(region gui.Region) {
         d := base.GetDictionary(15)
         x := m.layout.Actions.X + m.layout.Actions.Width/2
         y := float64(m.layout.ActionLeft.Y)
-        str := fmt.Sprintf("%s:%dAP", m.state.Actions.selected.String(), m.state.Actions.selected.AP())
+        str := fmt.Sprintf("%s:%dAP", m.state.Actions.selected.String(), m.state.Actions.selected.ApCost(m.ent, m.game))
         gl.Color4d(1, 1, 1, 1)
         d.RenderString(str, x, y, 0, d.MaxHeight(), gui.Center)
       }
@@ -49,7 +49,7 @@ func MakeSystemMenu(gp *GamePanel, player *Player) (gui.Widget, error) {
 
   sm.layout.Sub.Return.f = func(_ui interface{}) {
     ui := _ui.(*gui.Gui)
-    gp.game.Ents = nil
+    gp.game.clearEnts()
     gp.game.Think(1) // This should clean things up
     ui.DropFocus()
     Restart()
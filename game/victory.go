@@ -0,0 +1,128 @@
+package game
+
+import (
+  "github.com/runningwild/haunts/base"
+)
+
+// A rectangle of cells in floor coordinates.
+type Region struct {
+  X, Y, Dx, Dy int
+}
+
+func (r Region) Contains(x, y int) bool {
+  return x >= r.X && y >= r.Y && x < r.X+r.Dx && y < r.Y+r.Dy
+}
+
+// One way for a scenario to end.  Winner is "intruders" or "denizens", and
+// exactly one of the other fields should be set.
+type VictoryCondition struct {
+  Winner string
+
+  // Met once every living unit on the winning side is in Exit.
+  Exit *Region
+
+  // Met once a unit on the winning side carries an item with this name into
+  // Carry_to.
+  Carry    string
+  Carry_to Region
+
+  // Met once this turn is reached.
+  Survive int
+
+  // Met once no living units are left on this side, "intruders" or
+  // "denizens".
+  Eliminate string
+}
+
+// The conditions that end a scenario, the first one met decides the winner.
+type Victory struct {
+  Conditions []VictoryCondition
+}
+
+// Converts "intruders" and "denizens", as used by scripts and data files, to
+// a Side.
+func sideFromString(s string) (Side, bool) {
+  switch s {
+  case "intruders":
+    return SideExplorers, true
+  case "denizens":
+    return SideHaunt, true
+  }
+  return SideNone, false
+}
+
+// Returns the living units on side.
+func (g *Game) livingUnits(side Side) []*Entity {
+  var units []*Entity
+  for _, ent := range g.EntsForSide(side) {
+    if ent.Stats != nil && ent.Stats.HpCur() > 0 {
+      units = append(units, ent)
+    }
+  }
+  return units
+}
+
+func (g *Game) victoryMet(vc VictoryCondition, winner Side) bool {
+  switch {
+  case vc.Exit != nil:
+    units := g.livingUnits(winner)
+    for _, ent := range units {
+      if !vc.Exit.Contains(ent.Pos()) {
+        return false
+      }
+    }
+    return len(units) > 0
+
+  case vc.Carry != "":
+    for _, ent := range g.livingUnits(winner) {
+      if !vc.Carry_to.Contains(ent.Pos()) {
+        continue
+      }
+      for _, item := range ent.Inventory {
+        if item.Defname == vc.Carry {
+          return true
+        }
+      }
+    }
+    return false
+
+  case vc.Survive > 0:
+    return g.Turn >= vc.Survive
+
+  case vc.Eliminate != "":
+    side, ok := sideFromString(vc.Eliminate)
+    if !ok {
+      base.Warn().Printf("Unknown side '%s' in a victory condition.", vc.Eliminate)
+      return false
+    }
+    return len(g.livingUnits(side)) == 0
+  }
+  return false
+}
+
+// Decides the outcome if any of the scenario's victory conditions have been
+// met.  Does nothing once the outcome is decided.
+func (g *Game) checkWinConditions() {
+  if g.Victory == nil || g.Finished {
+    return
+  }
+  for _, vc := range g.Victory.Conditions {
+    winner, ok := sideFromString(vc.Winner)
+    if !ok {
+      base.Warn().Printf("Unknown winner '%s' in a victory condition.", vc.Winner)
+      continue
+    }
+    if g.victoryMet(vc, winner) {
+      g.Finished = true
+      g.Winner = winner
+      base.Log().Printf("Game over, side %d won.", winner)
+      g.Notify(Event{Kind: EventGameOver, Side: winner})
+      return
+    }
+  }
+}
+
+// Returns true once the scenario has ended, along with the side that won.
+func (g *Game) Outcome() (finished bool, winner Side) {
+  return g.Finished, g.Winner
+}
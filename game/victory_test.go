@@ -0,0 +1,47 @@
+package game_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/runningwild/haunts/game"
+  "github.com/runningwild/haunts/house"
+)
+
+func VictorySpec(c gospec.Context) {
+  g := game.MakeHeadlessGame(&house.HouseDef{Floors: []*house.Floor{&house.Floor{}}})
+
+  c.Specify("Games without victory conditions never end.", func() {
+    g.OnRound(false)
+    finished, _ := g.Outcome()
+    c.Expect(finished, Equals, false)
+  })
+
+  c.Specify("The outcome is decided once a condition is met.", func() {
+    var over []game.Event
+    g.Subscribe(func(e game.Event) {
+      if e.Kind == game.EventGameOver {
+        over = append(over, e)
+      }
+    })
+    g.Victory = &game.Victory{Conditions: []game.VictoryCondition{{Winner: "intruders", Survive: 3}}}
+    g.Turn = 2
+    g.OnRound(false)
+    finished, _ := g.Outcome()
+    c.Expect(finished, Equals, false)
+    g.Turn = 3
+    g.OnRound(false)
+    finished, winner := g.Outcome()
+    c.Expect(finished, Equals, true)
+    c.Expect(winner, Equals, game.SideExplorers)
+    g.OnRound(false)
+    c.Expect(len(over), Equals, 1)
+  })
+
+  c.Specify("A side with no living units has been eliminated.", func() {
+    g.Victory = &game.Victory{Conditions: []game.VictoryCondition{{Winner: "denizens", Eliminate: "intruders"}}}
+    g.OnRound(false)
+    finished, winner := g.Outcome()
+    c.Expect(finished, Equals, true)
+    c.Expect(winner, Equals, game.SideHaunt)
+  })
+}
@@ -0,0 +1,16 @@
+package house_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  "testing"
+)
+
+func TestAllSpecs(t *testing.T) {
+  r := gospec.NewRunner()
+  r.AddSpec(SorterSpec)
+  r.AddSpec(WallFacingSpec)
+  r.AddSpec(LosTextureSpec)
+  r.AddSpec(PaletteSpec)
+  r.AddSpec(RoomSpec)
+  gospec.MainGoTest(r, t)
+}
@@ -0,0 +1,110 @@
+package house
+
+import (
+  "github.com/runningwild/glop/gin"
+  "github.com/runningwild/glop/gui"
+  "github.com/runningwild/haunts/base"
+)
+
+// Lets the cells along the walls be marked as able or unable to have doors.
+// Clicking a cell toggles it, dragging afterwards sets every cell the mouse
+// passes over to the same value.  Right clicking works the same way on any
+// cell in the room, but toggles whether the cell is part of the room at all.
+type CellPanel struct {
+  *gui.VerticalTable
+  room   *roomDef
+  viewer *RoomViewer
+
+  painting    bool
+  paint_value bool
+
+  // True while painting cells in or out of the room with the right button
+  painting_cells bool
+}
+
+func MakeCellPanel(room *roomDef, viewer *RoomViewer) *CellPanel {
+  var cp CellPanel
+  cp.room = room
+  cp.viewer = viewer
+  cp.VerticalTable = gui.MakeVerticalTable()
+  cp.VerticalTable.AddChild(gui.MakeTextLine("standard", "Click along the walls to", 300, 1, 1, 1, 1))
+  cp.VerticalTable.AddChild(gui.MakeTextLine("standard", "toggle where doors can go.", 300, 1, 1, 1, 1))
+  cp.VerticalTable.AddChild(gui.MakeTextLine("standard", "Right click to carve cells", 300, 1, 1, 1, 1))
+  cp.VerticalTable.AddChild(gui.MakeTextLine("standard", "out of the room.", 300, 1, 1, 1, 1))
+  return &cp
+}
+
+func (w *CellPanel) cellAt(wx, wy int) (x, y int, ok bool) {
+  bx, by := w.viewer.WindowToBoard(wx, wy)
+  x, y = roundDown(bx), roundDown(by)
+  return x, y, w.room.isWallCell(x, y)
+}
+
+func (w *CellPanel) roomCellAt(wx, wy int) (x, y int, ok bool) {
+  bx, by := w.viewer.WindowToBoard(wx, wy)
+  x, y = roundDown(bx), roundDown(by)
+  return x, y, w.room.inBounds(x, y)
+}
+
+func (w *CellPanel) Respond(ui *gui.Gui, group gui.EventGroup) bool {
+  if w.VerticalTable.Respond(ui, group) {
+    return true
+  }
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["place"].Id()); found && event.Type == gin.Press {
+    x, y, ok := w.cellAt(event.Key.Cursor().Point())
+    if ok {
+      w.painting = true
+      w.paint_value = !w.room.CanHaveDoor(x, y)
+      w.room.SetCanHaveDoor(x, y, w.paint_value)
+    }
+    return true
+  }
+  if found, event := group.FindEvent(gin.MouseRButton); found && event.Type == gin.Press {
+    x, y, ok := w.roomCellAt(event.Key.Cursor().Point())
+    if ok {
+      w.painting_cells = true
+      w.paint_value = !w.room.HasCell(x, y)
+      w.room.SetHasCell(x, y, w.paint_value)
+    }
+    return true
+  }
+  return false
+}
+
+func (w *CellPanel) Think(ui *gui.Gui, t int64) {
+  if w.painting {
+    if base.GetDefaultKeyMap()["place"].IsDown() {
+      x, y, ok := w.cellAt(gin.In().GetCursor("Mouse").Point())
+      if ok {
+        w.room.SetCanHaveDoor(x, y, w.paint_value)
+      }
+    } else {
+      w.painting = false
+    }
+  }
+  if w.painting_cells {
+    if gin.In().GetKey(gin.MouseRButton).IsDown() {
+      x, y, ok := w.roomCellAt(gin.In().GetCursor("Mouse").Point())
+      if ok {
+        w.room.SetHasCell(x, y, w.paint_value)
+      }
+    } else {
+      w.painting_cells = false
+    }
+  }
+  w.VerticalTable.Think(ui, t)
+}
+
+func (w *CellPanel) Collapse() {
+  w.painting = false
+  w.painting_cells = false
+}
+
+func (w *CellPanel) Expand() {
+  w.viewer.SetEditMode(editCells)
+}
+
+func (w *CellPanel) Reload() {
+  w.painting = false
+  w.painting_cells = false
+}
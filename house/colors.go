@@ -0,0 +1,233 @@
+package house
+
+import (
+  gl "github.com/chsc/gogl/gl21"
+  "github.com/runningwild/haunts/base"
+  "reflect"
+)
+
+// An rgba color, stored in json as an array of four numbers from 0 to 255.
+type Color [4]byte
+
+func (c Color) RGBA() (r, g, b, a byte) {
+  return c[0], c[1], c[2], c[3]
+}
+
+// Makes c the current gl color.
+func (c Color) Set() {
+  gl.Color4ub(c[0], c[1], c[2], c[3])
+}
+
+// Returns the color frac of the way from c to c2.
+func (c Color) Mix(c2 Color, frac float64) Color {
+  var m Color
+  for i := range m {
+    m[i] = byte(float64(c[i])*(1-frac) + float64(c2[i])*frac)
+  }
+  return m
+}
+
+// The colors used for everything that is drawn over the art, like grids,
+// highlights, and los overlays.  Players can load a different one to make
+// things easier to tell apart.
+type Palette struct {
+  Defname string
+  *paletteDef
+}
+
+type paletteDef struct {
+  Name string
+
+  // Lines between cells in the room editor
+  Grid Color
+
+  // Outlines of furniture when editing a room's cells
+  Furniture_outline Color
+
+  // Tints for rooms, doors, and furniture that are being placed in an
+  // editor, depending on whether they can be placed where they are.
+  Placing         Color
+  Placing_invalid Color
+
+  // Tint for furniture that is being dragged around the room editor
+  Placing_furniture Color
+
+  // Tint for furniture that is selected in the room editor
+  Selected Color
+
+  // Tint for rooms that overlap the room being placed in the house editor
+  Conflict Color
+
+  // Cells along the walls of a room, depending on whether a door can go there
+  Door_cell         Color
+  Door_cell_invalid Color
+
+  // Lines showing where dragged furniture lines up with other furniture
+  Guide Color
+
+  // Cells covered by furniture that is selected or being dragged
+  Footprint         Color
+  Footprint_invalid Color
+
+  // Markers on the floor under doors
+  Door_opened Color
+  Door_closed Color
+
+  // Tints for locked doors, depending on whether a key can open them
+  Door_locked Color
+  Door_keyed  Color
+
+  // Cells that an action that is being prepped can reach
+  Reach Color
+
+  // Los overlays in the game
+  Waypoint  Color
+  Debug_los Color
+  Trail     Color
+
+  // Rooms on the house editor's minimap that aren't being placed, what is
+  // behind them, and the outline of the part of the house that is in view
+  Minimap_room       Color
+  Minimap_background Color
+  Minimap_view       Color
+
+  // The line drawn by the house viewer's measure mode
+  Measure Color
+
+  // Edges of a room that can be dragged to resize it, and the ones that are
+  // being dragged
+  Handle         Color
+  Handle_grabbed Color
+
+  // Cells that an area attack will hit, depending on whether it can be used
+  // where it is aimed
+  Area         Color
+  Area_invalid Color
+
+  // Drawn behind the health bars and condition icons above entities
+  Status_background Color
+
+  // Health bars go from Health_empty to Health_full as entities heal
+  Health_empty Color
+  Health_full  Color
+
+  // Icons above entities for the conditions they have, by the name of the
+  // condition's kind.  Kinds that aren't listed use Condition.
+  Condition  Color
+  Conditions map[string]Color
+}
+
+// Matches the colors that were used before palettes could be loaded, and is
+// used until SetPalette is called.
+var defaultPalette = paletteDef{
+  Name:               "Default",
+  Grid:               Color{255, 0, 255, 230},
+  Furniture_outline:  Color{255, 0, 0, 255},
+  Placing:            Color{127, 255, 127, 200},
+  Placing_invalid:    Color{255, 127, 127, 200},
+  Placing_furniture:  Color{127, 127, 255, 200},
+  Selected:           Color{127, 255, 127, 255},
+  Conflict:           Color{255, 80, 80, 255},
+  Door_cell:          Color{64, 255, 64, 100},
+  Door_cell_invalid:  Color{255, 64, 64, 100},
+  Guide:              Color{0, 255, 255, 204},
+  Footprint:          Color{255, 255, 64, 96},
+  Footprint_invalid:  Color{255, 64, 64, 96},
+  Door_opened:        Color{64, 255, 64, 128},
+  Door_closed:        Color{255, 64, 64, 128},
+  Door_locked:        Color{255, 110, 110, 255},
+  Door_keyed:         Color{255, 210, 120, 255},
+  Reach:              Color{255, 200, 64, 64},
+  Waypoint:           Color{200, 0, 0, 128},
+  Debug_los:          Color{255, 0, 255, 96},
+  Trail:              Color{255, 255, 192, 128},
+  Minimap_room:       Color{160, 160, 160, 255},
+  Minimap_background: Color{0, 0, 0, 160},
+  Minimap_view:       Color{255, 255, 64, 255},
+  Measure:            Color{255, 255, 64, 255},
+  Handle:             Color{255, 255, 255, 64},
+  Handle_grabbed:     Color{255, 255, 64, 200},
+  Area:               Color{255, 255, 255, 200},
+  Area_invalid:       Color{255, 64, 64, 200},
+  Status_background:  Color{0, 0, 0, 200},
+  Health_empty:       Color{255, 0, 0, 255},
+  Health_full:        Color{0, 255, 0, 255},
+  Condition:          Color{255, 255, 255, 255},
+  Conditions: map[string]Color{
+    "AP":     Color{80, 160, 255, 255},
+    "Attack": Color{255, 160, 40, 255},
+    "Corpus": Color{200, 200, 200, 255},
+    "Ego":    Color{200, 80, 255, 255},
+    "Sight":  Color{255, 255, 120, 255},
+    "HP":     Color{80, 255, 80, 255},
+    "Panic":  Color{255, 120, 200, 255},
+    "Terror": Color{120, 0, 160, 255},
+    "Fire":   Color{255, 60, 0, 255},
+    "Brutal": Color{160, 0, 0, 255},
+    "Poison": Color{0, 160, 0, 255},
+  },
+}
+
+var palette = &Palette{Defname: defaultPalette.Name, paletteDef: &defaultPalette}
+
+func GetAllPaletteNames() []string {
+  return base.GetAllNamesInRegistry("palettes")
+}
+
+func LoadAllPalettesInDir(dir string) {
+  base.RemoveRegistry("palettes")
+  base.RegisterRegistry("palettes", make(map[string]*paletteDef))
+  base.RegisterAllObjectsInDir("palettes", dir, ".json", "json")
+}
+
+// Copies every color that is set in src into dst.  Colors that a palette
+// file leaves out are all zero, so they are left alone.  Maps of colors are
+// merged into a copy of the one in dst, so dst's map is never modified.
+func overlayColors(dst, src *paletteDef) {
+  dv := reflect.ValueOf(dst).Elem()
+  sv := reflect.ValueOf(src).Elem()
+  var zero Color
+  for i := 0; i < sv.NumField(); i++ {
+    switch c := sv.Field(i).Interface().(type) {
+    case Color:
+      if c != zero {
+        dv.Field(i).Set(sv.Field(i))
+      }
+
+    case map[string]Color:
+      merged := make(map[string]Color)
+      for name, color := range dv.Field(i).Interface().(map[string]Color) {
+        merged[name] = color
+      }
+      for name, color := range c {
+        if color != zero {
+          merged[name] = color
+        }
+      }
+      dv.Field(i).Set(reflect.ValueOf(merged))
+    }
+  }
+}
+
+// Switches to the palette with the specified name.  If there is no such
+// palette the current one is kept.  Any colors that the palette doesn't
+// specify are taken from the default palette.
+func SetPalette(name string) {
+  for _, n := range GetAllPaletteNames() {
+    if n == name {
+      p := Palette{Defname: name}
+      base.GetObject("palettes", &p)
+      def := defaultPalette
+      overlayColors(&def, p.paletteDef)
+      def.Name = p.Name
+      palette = &Palette{Defname: name, paletteDef: &def}
+      return
+    }
+  }
+  base.Warn().Printf("No palette named '%s', keeping '%s'", name, palette.Defname)
+}
+
+// Returns the palette that everything should currently be drawn with.
+func CurrentPalette() *Palette {
+  return palette
+}
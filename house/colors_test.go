@@ -0,0 +1,24 @@
+package house_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/runningwild/haunts/house"
+  "path/filepath"
+)
+
+func PaletteSpec(c gospec.Context) {
+  datadir, _ := filepath.Abs("../data_test")
+  house.LoadAllPalettesInDir(filepath.Join(datadir, "palettes"))
+
+  c.Specify("SetPalette loads colors from the registry.", func() {
+    house.SetPalette("Palette Test")
+    c.Expect(house.CurrentPalette().Defname, Equals, "Palette Test")
+    c.Expect(house.CurrentPalette().Grid, Equals, house.Color{1, 2, 3, 4})
+    c.Expect(house.CurrentPalette().Placing, Equals, house.Color{127, 255, 127, 200})
+    c.Expect(house.CurrentPalette().Conditions["Fire"], Equals, house.Color{5, 6, 7, 8})
+    c.Expect(house.CurrentPalette().Conditions["Poison"], Equals, house.Color{0, 160, 0, 255})
+    house.SetPalette("Not A Palette")
+    c.Expect(house.CurrentPalette().Defname, Equals, "Palette Test")
+  })
+}
@@ -0,0 +1,140 @@
+package house
+
+import (
+  "errors"
+  "fmt"
+  "github.com/runningwild/glop/gui"
+  "github.com/runningwild/glop/render"
+  "github.com/runningwild/mathgl"
+  "github.com/runningwild/opengl/gl"
+  "image"
+  "image/png"
+  "io"
+)
+
+// Exported images are always this many pixels on a side, regardless of the
+// size of the window or how far the viewer is zoomed in.
+const exportImageSize = 1024
+
+// Renders the rooms, walls, doors, and furniture on the specified floor to an
+// offscreen buffer and writes it to w as a png.
+func (hv *HouseViewer) ExportImage(floor int, w io.Writer) error {
+  if floor < 0 || floor >= len(hv.house.Floors) {
+    return fmt.Errorf("Floor %d does not exist", floor)
+  }
+  f := hv.house.Floors[floor]
+  if len(f.Rooms) == 0 {
+    return fmt.Errorf("Floor %d has no rooms", floor)
+  }
+  img, err := renderFloorImage(f, hv.angle, exportImageSize)
+  if err != nil {
+    return err
+  }
+  return png.Encode(w, img)
+}
+
+// Renders everything on f to an offscreen buffer that is size pixels on a
+// side, zoomed so that all of the rooms on f fit in the middle of it.
+func renderFloorImage(f *Floor, angle float32, size int) (*image.RGBA, error) {
+  var minx, miny, maxx, maxy float32
+  minx, miny = float32(f.Rooms[0].X), float32(f.Rooms[0].Y)
+  maxx, maxy = minx, miny
+  for _, room := range f.Rooms {
+    minx = min32(minx, float32(room.X))
+    miny = min32(miny, float32(room.Y))
+    maxx = max32(maxx, float32(room.X+room.Size.Dx))
+    maxy = max32(maxy, float32(room.Y+room.Size.Dy))
+  }
+
+  // Rooms between the focus and the camera get faded out, so focus on a
+  // point behind all of the rooms and shift the region so that the house
+  // still ends up in the middle of the image.
+  focusx, focusy := minx-3, miny-3
+  region := gui.Region{gui.Point{0, 0}, gui.Dims{size, size}}
+
+  // Find the size of the floor on screen at a zoom of 1, then scale it so
+  // that it fills most of the image, leaving room for the walls.
+  mat, _, _, _, _, _ := makeRoomMats(&roomDef{}, region, focusx, focusy, angle, 1)
+  var sminx, sminy, smaxx, smaxy float32
+  for i, c := range [][2]float32{{minx, miny}, {minx, maxy}, {maxx, miny}, {maxx, maxy}} {
+    v := mathgl.Vec4{X: c[0], Y: c[1], W: 1}
+    v.Transform(&mat)
+    if i == 0 {
+      sminx, smaxx, sminy, smaxy = v.X, v.X, v.Y, v.Y
+    }
+    sminx, smaxx = min32(sminx, v.X), max32(smaxx, v.X)
+    sminy, smaxy = min32(sminy, v.Y), max32(smaxy, v.Y)
+  }
+  fsize := float32(size)
+  zoom := min32(fsize/(smaxx-sminx), fsize/(smaxy-sminy)) * 0.7
+
+  mat, _, _, _, _, _ = makeRoomMats(&roomDef{}, region, focusx, focusy, angle, zoom)
+  center := mathgl.Vec4{X: (minx + maxx) / 2, Y: (miny + maxy) / 2, W: 1}
+  center.Transform(&mat)
+  region.X += size/2 - int(center.X)
+  region.Y += size/2 - int(center.Y)
+
+  pix := make([]byte, 4*size*size)
+  var status gl.GLenum
+  render.Queue(func() {
+    fb := gl.GenFramebuffer()
+    fb.Bind()
+    color := gl.GenRenderbuffer()
+    color.Bind()
+    gl.RenderbufferStorage(gl.RENDERBUFFER, gl.RGBA8, size, size)
+    color.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.RENDERBUFFER)
+    status = gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+    if status == gl.FRAMEBUFFER_COMPLETE {
+      gl.PushAttrib(gl.VIEWPORT_BIT)
+      gl.Viewport(0, 0, size, size)
+      gl.MatrixMode(gl.PROJECTION)
+      gl.PushMatrix()
+      gl.LoadIdentity()
+      gl.Ortho(0, float64(size), 0, float64(size), 1000, -1000)
+      gl.MatrixMode(gl.MODELVIEW)
+      gl.PushMatrix()
+      gl.LoadIdentity()
+      gl.ClearColor(0, 0, 0, 0)
+      gl.Clear(gl.COLOR_BUFFER_BIT)
+
+      f.render(region, focusx, focusy, angle, zoom, nil, nil, nil)
+      gl.ReadPixels(0, 0, size, size, gl.RGBA, gl.UNSIGNED_BYTE, pix)
+
+      gl.MatrixMode(gl.MODELVIEW)
+      gl.PopMatrix()
+      gl.MatrixMode(gl.PROJECTION)
+      gl.PopMatrix()
+      gl.MatrixMode(gl.MODELVIEW)
+      gl.PopAttrib()
+    }
+    fb.Unbind()
+    color.Delete()
+    fb.Delete()
+  })
+  render.Purge()
+  if status != gl.FRAMEBUFFER_COMPLETE {
+    return nil, errors.New("Unable to create a framebuffer to render the floor")
+  }
+
+  // OpenGl returns rows bottom to top
+  img := image.NewRGBA(image.Rect(0, 0, size, size))
+  stride := 4 * size
+  for y := 0; y < size; y++ {
+    copy(img.Pix[y*img.Stride:y*img.Stride+stride], pix[(size-1-y)*stride:(size-y)*stride])
+  }
+  return img, nil
+}
+
+func min32(a, b float32) float32 {
+  if a < b {
+    return a
+  }
+  return b
+}
+
+func max32(a, b float32) float32 {
+  if a > b {
+    return a
+  }
+  return b
+}
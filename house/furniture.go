@@ -5,6 +5,7 @@ import (
   "github.com/runningwild/haunts/base"
   "github.com/runningwild/haunts/texture"
   "github.com/runningwild/mathgl"
+  "image"
 )
 
 func MakeFurniture(name string) *Furniture {
@@ -42,6 +43,9 @@ type Furniture struct {
   // Used to determine how this is drawn as it is being moved in the editor
   invalid bool
 
+  // Whether this is part of the editor's selection
+  selected bool
+
   // If someone is walking behind this, and it blocks los, then we'll want to
   // make it transparent.
   alpha         float64
@@ -61,10 +65,16 @@ func (f *Furniture) Alpha() float64 {
 func (f *Furniture) Constrain(dx, dy int) {
   cdx, cdy := f.Dims()
   if f.X+cdx > dx {
-    f.X += dx - f.X + cdx
+    f.X = dx - cdx
   }
   if f.Y+cdy > dy {
-    f.Y += dy - f.Y + cdy
+    f.Y = dy - cdy
+  }
+  if f.X < 0 {
+    f.X = 0
+  }
+  if f.Y < 0 {
+    f.Y = 0
   }
 }
 
@@ -101,6 +111,52 @@ type furnitureDef struct {
   // of furniture blocks los, then the entire piece blocks los, regardless of
   // orientation.
   Blocks_los bool
+
+  // If Blocks_los is set and this is greater than zero then this piece of
+  // furniture is short enough to see over from up close.  It only blocks
+  // los along lines that have travelled more than this many cells by the
+  // time they reach it.  Zero means that it always blocks los.
+  Los_height int
+
+  // Whether or not this piece of furniture stops shots.  This is separate
+  // from Blocks_los so that something like a low railing can stop shots
+  // without hiding what is behind it.
+  Blocks_shot bool
+
+  // Whether or not entities are kept from walking through this piece of
+  // furniture.  Unset is the same as true, so that only things like rugs
+  // need to say otherwise.
+  Blocks_move *bool
+
+  // If this is greater than zero then this piece of furniture is a light
+  // source.  It lights every cell within this many cells of it that it has
+  // line-of-sight to.
+  Light_radius int
+}
+
+func (f *Furniture) BlocksMove() bool {
+  return f.Blocks_move == nil || *f.Blocks_move
+}
+
+// Returns true if a and b can't both be placed where they are, which is when
+// they overlap and both block movement.  Decorative pieces, like rugs, can
+// overlap anything.
+func furnitureConflicts(a, b *Furniture) bool {
+  if !a.BlocksMove() || !b.BlocksMove() {
+    return false
+  }
+  adx, ady := a.Dims()
+  bdx, bdy := b.Dims()
+  return image.Rect(a.X, a.Y, a.X+adx, a.Y+ady).Overlaps(image.Rect(b.X, b.Y, b.X+bdx, b.Y+bdy))
+}
+
+// Returns true if this piece of furniture blocks a line of sight that has
+// travelled dist cells to reach it.
+func (f *Furniture) BlocksLosAt(dist int) bool {
+  if !f.Blocks_los {
+    return false
+  }
+  return f.Los_height <= 0 || dist > f.Los_height
 }
 
 func (f *Furniture) Dims() (int, int) {
@@ -114,11 +170,14 @@ func (f *Furniture) Dims() (int, int) {
 func (f *Furniture) Color() (r, g, b, a byte) {
   if f.temporary {
     if f.invalid {
-      return 255, 127, 127, 200
+      return palette.Placing_invalid.RGBA()
     } else {
-      return 127, 127, 255, 200
+      return palette.Placing_furniture.RGBA()
     }
   }
+  if f.selected {
+    return palette.Selected.RGBA()
+  }
   return 255, 255, 255, 255
 }
 
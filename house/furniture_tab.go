@@ -1,7 +1,6 @@
 package house
 
 import (
-  "image"
   "github.com/runningwild/glop/gin"
   "github.com/runningwild/glop/gui"
   "github.com/runningwild/glop/util/algorithm"
@@ -28,9 +27,28 @@ type FurniturePanel struct {
   // The piece of furniture that we are currently dragging around
   furniture *Furniture
 
+  // Furniture that has been shift-clicked.  Picking up any selected piece
+  // picks up all of them.
+  selected map[*Furniture]bool
+
+  // The other pieces being dragged along with furniture.
+  group []groupedFurniture
+
+  // State of the furniture before the current operation began
+  undo    *editUndoStack
+  pending *furnitureSnapshot
+
   key_map base.KeyMap
 }
 
+type groupedFurniture struct {
+  f    *Furniture
+  prev Furniture
+
+  // Offset from the piece that is actually being dragged
+  dx, dy int
+}
+
 func (w *FurniturePanel) Collapse() {
   w.onEscape()
 }
@@ -38,10 +56,11 @@ func (w *FurniturePanel) Expand() {
   w.RoomViewer.SetEditMode(editFurniture)
 }
 
-func makeFurniturePanel(room *roomDef, viewer *RoomViewer) *FurniturePanel {
+func makeFurniturePanel(room *roomDef, viewer *RoomViewer, undo *editUndoStack) *FurniturePanel {
   var fp FurniturePanel
   fp.Room = room
   fp.RoomViewer = viewer
+  fp.undo = undo
   fp.key_map = base.GetDefaultKeyMap()
   if room.Name == "" {
     room.Name = "name"
@@ -80,9 +99,10 @@ func makeFurniturePanel(room *roomDef, viewer *RoomViewer) *FurniturePanel {
     name := fnames[i]
     furn_table.AddChild(gui.MakeButton("standard", name, 300, 1, 1, 1, 1, func(t int64) {
       f := MakeFurniture(name)
-      if f == nil {
+      if f == nil || fp.furniture != nil {
         return
       }
+      fp.pending = snapshotFurniture(fp.Room)
       fp.furniture = f
       fp.furniture.temporary = true
       fp.Room.Furniture = append(fp.Room.Furniture, fp.furniture)
@@ -96,7 +116,15 @@ func makeFurniturePanel(room *roomDef, viewer *RoomViewer) *FurniturePanel {
   return &fp
 }
 
+func (w *FurniturePanel) commit() {
+  if w.pending != nil {
+    w.undo.Push(&furnitureEdit{w.pending, snapshotFurniture(w.Room)})
+    w.pending = nil
+  }
+}
+
 func (w *FurniturePanel) onEscape() {
+  w.pending = nil
   if w.furniture != nil {
     if w.prev_object != nil {
       *w.furniture = *w.prev_object
@@ -106,8 +134,34 @@ func (w *FurniturePanel) onEscape() {
         return f != w.furniture
       })
     }
+    for _, g := range w.group {
+      *g.f = g.prev
+    }
+    w.group = nil
     w.furniture = nil
+  } else {
+    w.clearSelection()
+  }
+}
+
+func (w *FurniturePanel) clearSelection() {
+  for f := range w.selected {
+    f.selected = false
+  }
+  w.selected = nil
+}
+
+// Returns the piece of furniture under the cursor, if any.
+func (w *FurniturePanel) furnitureAt(wx, wy int) *Furniture {
+  bx, by := w.RoomViewer.WindowToBoard(wx, wy)
+  for _, f := range w.Room.Furniture {
+    x, y := f.Pos()
+    dx, dy := f.Dims()
+    if int(bx) >= x && int(bx) < x+dx && int(by) >= y && int(by) < y+dy {
+      return f
+    }
   }
+  return nil
 }
 
 func (w *FurniturePanel) Respond(ui *gui.Gui, group gui.EventGroup) bool {
@@ -118,7 +172,7 @@ func (w *FurniturePanel) Respond(ui *gui.Gui, group gui.EventGroup) bool {
   // On escape we want to revert the furniture we're moving back to where it was
   // and what state it was in before we selected it.  If we don't have any
   // furniture selected then we don't do anything.
-  if found, event := group.FindEvent(gin.Escape); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(w.key_map["cancel"].Id()); found && event.Type == gin.Press {
     w.onEscape()
     return true
   }
@@ -126,11 +180,22 @@ func (w *FurniturePanel) Respond(ui *gui.Gui, group gui.EventGroup) bool {
   // If we hit delete then we want to remove the furniture we're moving around
   // from the room.  If we're not moving anything around then nothing happens.
   if found, event := group.FindEvent(gin.DeleteOrBackspace); found && event.Type == gin.Press {
+    moving := make(map[*Furniture]bool)
+    for _, g := range w.group {
+      moving[g.f] = true
+      delete(w.selected, g.f)
+    }
     algorithm.Choose2(&w.Room.Furniture, func(f *Furniture) bool {
-      return f != w.furniture
+      return f != w.furniture && !moving[f]
     })
+    delete(w.selected, w.furniture)
+    if w.prev_object != nil {
+      w.commit()
+    }
+    w.pending = nil
     w.furniture = nil
     w.prev_object = nil
+    w.group = nil
     return true
   }
 
@@ -149,26 +214,56 @@ func (w *FurniturePanel) Respond(ui *gui.Gui, group gui.EventGroup) bool {
       w.furniture.Flip = !w.furniture.Flip
     }
   }
-  if found, event := group.FindEvent(gin.MouseLButton); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(w.key_map["place"].Id()); found && event.Type == gin.Press {
     if w.furniture != nil {
       if !w.furniture.invalid {
         w.furniture.temporary = false
+        for _, g := range w.group {
+          g.f.temporary = false
+        }
+        w.commit()
         w.furniture = nil
+        w.group = nil
       }
-    } else if w.furniture == nil {
-      bx, by := w.RoomViewer.WindowToBoard(event.Key.Cursor().Point())
-      for i := range w.Room.Furniture {
-        x, y := w.Room.Furniture[i].Pos()
-        dx, dy := w.Room.Furniture[i].Dims()
-        if int(bx) >= x && int(bx) < x+dx && int(by) >= y && int(by) < y+dy {
-          w.furniture = w.Room.Furniture[i]
-          w.prev_object = new(Furniture)
-          *w.prev_object = *w.furniture
-          w.furniture.temporary = true
-          px, py := w.furniture.Pos()
-          w.drag_anchor.x = bx - float32(px)
-          w.drag_anchor.y = by - float32(py)
-          break
+    } else if gin.In().GetKey(gin.EitherShift).IsDown() {
+      // Shift-click toggles whether or not a piece is in the selection
+      f := w.furnitureAt(event.Key.Cursor().Point())
+      if f != nil {
+        if w.selected == nil {
+          w.selected = make(map[*Furniture]bool)
+        }
+        f.selected = !w.selected[f]
+        if f.selected {
+          w.selected[f] = true
+        } else {
+          delete(w.selected, f)
+        }
+      }
+    } else {
+      f := w.furnitureAt(event.Key.Cursor().Point())
+      if f != nil {
+        bx, by := w.RoomViewer.WindowToBoard(event.Key.Cursor().Point())
+        w.pending = snapshotFurniture(w.Room)
+        w.furniture = f
+        w.prev_object = new(Furniture)
+        *w.prev_object = *w.furniture
+        w.furniture.temporary = true
+        px, py := w.furniture.Pos()
+        w.drag_anchor.x = bx - float32(px)
+        w.drag_anchor.y = by - float32(py)
+        if w.selected[f] {
+          for other := range w.selected {
+            if other == f {
+              continue
+            }
+            w.group = append(w.group, groupedFurniture{
+              f:    other,
+              prev: *other,
+              dx:   other.X - px,
+              dy:   other.Y - py,
+            })
+            other.temporary = true
+          }
         }
       }
     }
@@ -197,31 +292,34 @@ func (w *FurniturePanel) Think(ui *gui.Gui, t int64) {
     f := w.furniture
     f.X = roundDown(bx - w.drag_anchor.x + 0.5)
     f.Y = roundDown(by - w.drag_anchor.y + 0.5)
-    fdx, fdy := f.Dims()
-    f.invalid = false
-    if f.X < 0 {
-      f.invalid = true
-    }
-    if f.Y < 0 {
-      f.invalid = true
-    }
-    if f.X+fdx > w.Room.Size.Dx {
-      f.invalid = true
+    if len(w.group) == 0 {
+      // Keep the piece on the grid, otherwise rotating something near a wall
+      // would push part of it out of the room.
+      f.Constrain(w.Room.Size.Dx, w.Room.Size.Dy)
     }
-    if f.Y+fdy > w.Room.Size.Dy {
-      f.invalid = true
+    moving := map[*Furniture]bool{f: true}
+    for _, g := range w.group {
+      g.f.X = f.X + g.dx
+      g.f.Y = f.Y + g.dy
+      moving[g.f] = true
     }
-    for _, t := range w.Room.Furniture {
-      if t == f {
-        continue
+
+    // The whole group can only be placed if every piece in it can be placed
+    invalid := false
+    for m := range moving {
+      mdx, mdy := m.Dims()
+      if m.X < 0 || m.Y < 0 || m.X+mdx > w.Room.Size.Dx || m.Y+mdy > w.Room.Size.Dy {
+        invalid = true
       }
-      tdx, tdy := t.Dims()
-      r1 := image.Rect(t.X, t.Y, t.X+tdx, t.Y+tdy)
-      r2 := image.Rect(f.X, f.Y, f.X+fdx, f.Y+fdy)
-      if r1.Overlaps(r2) {
-        f.invalid = true
+      for _, t := range w.Room.Furniture {
+        if !moving[t] && furnitureConflicts(t, m) {
+          invalid = true
+        }
       }
     }
+    for m := range moving {
+      m.invalid = invalid
+    }
   }
 
   w.VerticalTable.Think(ui, t)
@@ -1,6 +1,7 @@
 package house
 
 import (
+  "fmt"
   gl "github.com/chsc/gogl/gl21"
   "github.com/runningwild/glop/gin"
   "github.com/runningwild/glop/gui"
@@ -10,6 +11,8 @@ import (
   "image"
   "math"
   "path/filepath"
+  "sort"
+  "time"
   "unsafe"
 )
 
@@ -23,8 +26,24 @@ type Room struct {
   // The offset of this room on this floor
   X, Y int
 
+  // If this room was resized in the house editor this is the part of its def
+  // that it covers.  Rooms always get their def from the registry when they
+  // are loaded, so this is what lets a resized room keep its shape.
+  Bounds *RoomBounds
+
+  // Entities can only see a short distance into a dark room, except for the
+  // parts of it that are lit.
+  Dark bool
+
+  // Names of triggers, from the game's trigger registry, that are placed on
+  // this room.
+  Triggers []string
+
   temporary, invalid bool
 
+  // Set in the editor on rooms that are in the way of the room being placed
+  conflict bool
+
   // whether or not to draw the walls transparent
   far_left struct {
     wall_alpha byte
@@ -42,6 +61,8 @@ type Room struct {
   left_buffer  uint32
   right_buffer uint32
   floor_buffer uint32
+  left_count   int
+  right_count  int
   floor_count  int
 
   // we don't want to redo all of the vertex and index buffers unless we
@@ -50,23 +71,108 @@ type Room struct {
   gl struct {
     x, y, dx, dy             int
     wall_tex_dx, wall_tex_dy int
+    wall_height              int
+    missing_cells            []RoomCell
   }
 
   wall_texture_gl_map    map[*WallTexture]wallTextureGlIds
   wall_texture_state_map map[*WallTexture]wallTextureState
+
+  // Theme of the floor this room was last drawn on, determines which floor
+  // and wall textures it uses.
+  theme string
+
+  // The last depth-sort of the objects in this room, see orderObjects
+  order_cache struct {
+    keys    []orderKey
+    ordered []RectObject
+  }
+
+  // The doors on each wall of this room, see DoorsOnWall
+  door_cache struct {
+    clean bool
+    walls [4][]*Door
+  }
 }
 
 func (room *Room) Color() (r, g, b, a byte) {
   if room.temporary {
     if room.invalid {
-      return 255, 127, 127, 200
+      return palette.Placing_invalid.RGBA()
     } else {
-      return 127, 127, 255, 200
+      return palette.Placing.RGBA()
     }
   }
+  if room.conflict {
+    return palette.Conflict.RGBA()
+  }
   return 255, 255, 255, 255
 }
 
+// Returns a copy of the room, its furniture, and its doors that doesn't
+// share any slices or maps with the original, so editing one won't affect the
+// other.  None of the original's gl state is carried over.
+func (room *Room) copy() *Room {
+  c := &Room{Defname: room.Defname, roomDef: room.roomDef.copyDef(), X: room.X, Y: room.Y, Dark: room.Dark}
+  c.Triggers = append([]string{}, room.Triggers...)
+  if room.Bounds != nil {
+    b := *room.Bounds
+    c.Bounds = &b
+  }
+  for _, door := range room.Doors {
+    dc := MakeDoor(door.Defname)
+    dc.Facing = door.Facing
+    dc.Pos = door.Pos
+    dc.Opened = door.Opened
+    dc.Locked = door.Locked
+    dc.Key = door.Key
+    c.Doors = append(c.Doors, dc)
+  }
+  return c
+}
+
+// Returns a copy of the def that doesn't share any slices or maps with the
+// original.
+func (room *roomDef) copyDef() *roomDef {
+  def := *room
+  def.Furniture = nil
+  for _, f := range room.Furniture {
+    fc := *f
+    def.Furniture = append(def.Furniture, &fc)
+  }
+  def.WallTextures = nil
+  for _, wt := range room.WallTextures {
+    wtc := *wt
+    def.WallTextures = append(def.WallTextures, &wtc)
+  }
+  def.Move_costs = append([]MoveCost{}, room.Move_costs...)
+  def.No_door_cells = append([]RoomCell{}, room.No_door_cells...)
+  def.Missing_cells = append([]RoomCell{}, room.Missing_cells...)
+  def.Floor_tiles = append([]FloorTile{}, room.Floor_tiles...)
+  def.Themes = copyStringSet(room.Themes)
+  def.Sizes = copyStringSet(room.Sizes)
+  def.Decor = copyStringSet(room.Decor)
+  if room.Theme_textures != nil {
+    def.Theme_textures = make(map[string]*ThemeTextures, len(room.Theme_textures))
+    for theme, tt := range room.Theme_textures {
+      ttc := *tt
+      def.Theme_textures[theme] = &ttc
+    }
+  }
+  return &def
+}
+
+func copyStringSet(m map[string]bool) map[string]bool {
+  if m == nil {
+    return nil
+  }
+  c := make(map[string]bool, len(m))
+  for k, v := range m {
+    c[k] = v
+  }
+  return c
+}
+
 type WallFacing int
 
 const (
@@ -76,6 +182,25 @@ const (
   FarRight
 )
 
+// Returns true if f is one of the four walls that a door can be on.
+func (f WallFacing) Valid() bool {
+  return f >= NearLeft && f <= FarRight
+}
+
+func (f WallFacing) String() string {
+  switch f {
+  case NearLeft:
+    return "NearLeft"
+  case NearRight:
+    return "NearRight"
+  case FarLeft:
+    return "FarLeft"
+  case FarRight:
+    return "FarRight"
+  }
+  return fmt.Sprintf("WallFacing(%d)", int(f))
+}
+
 func MakeDoor(name string) *Door {
   d := Door{Defname: name}
   base.GetObject("doors", &d)
@@ -90,10 +215,18 @@ func LoadAllDoorsInDir(dir string) {
   base.RemoveRegistry("doors")
   base.RegisterRegistry("doors", make(map[string]*doorDef))
   base.RegisterAllObjectsInDir("doors", dir, ".json", "json")
+  for _, name := range GetAllDoorNames() {
+    if d := MakeDoor(name); d.Width < 1 {
+      base.Error().Printf("Door '%s' has a width of %d, it must be at least 1.", name, d.Width)
+    }
+  }
 }
 
 func (d *Door) Load() {
   base.GetObject("doors", d)
+  if !d.Facing.Valid() {
+    base.Error().Printf("Door '%s' has an invalid facing: %v.", d.Defname, d.Facing)
+  }
 }
 
 type doorDef struct {
@@ -101,6 +234,9 @@ type doorDef struct {
   // all Doors
   Name string
 
+  // Groups this door with others in the editor's list of doors
+  Category string
+
   // Number of cells wide the door is
   Width int
 
@@ -128,10 +264,25 @@ type Door struct {
   // Whether or not the door is opened - determines what texture to use
   Opened bool
 
+  // A locked door can't be moved through, even if it is opened, until it is
+  // unlocked by an entity carrying Key.  If Key is empty then the door can
+  // only be unlocked by a script.
+  Locked bool
+  Key    string
+
   temporary, invalid bool
 
   highlight_threshold bool
 
+  // Set on doors that something in the scenario is waiting to change, which
+  // makes them pulse.
+  objective bool
+
+  // Tracks the door swinging between open and closed, swing is how long it
+  // has been moving, in ms.
+  moving bool
+  swing  int64
+
   // gl stuff for drawing the threshold on the ground
   threshold_glids doorGlIds
   door_glids      doorGlIds
@@ -142,18 +293,118 @@ func (d *Door) AlwaysOpen() bool {
   return d.doorDef.Always_open
 }
 
+// How long, in ms, it takes a door to swing open or closed.
+const DoorSwingTime = 300
+
+// Returns true if the door is open for the purposes of movement, which
+// requires that it has finished swinging open.
 func (d *Door) IsOpened() bool {
-  return d.doorDef.Always_open || d.Opened
+  return d.doorDef.Always_open || (d.Opened && !d.moving)
 }
 
+// Sets whether the door is opened immediately, without animating it.
 func (d *Door) SetOpened(opened bool) {
   d.Opened = opened
+  d.moving = false
+}
+
+// Starts the door swinging open.  Does nothing if it is already open or
+// opening.
+func (d *Door) Open() {
+  d.startSwing(true)
+}
+
+// Starts the door swinging closed.  Does nothing if it is already closed or
+// closing.
+func (d *Door) Close() {
+  d.startSwing(false)
+}
+
+func (d *Door) startSwing(opened bool) {
+  if d.Opened == opened {
+    return
+  }
+  d.Opened = opened
+  if d.moving {
+    // Reversing partway through, so it only has to go back as far as it came
+    d.swing = DoorSwingTime - d.swing
+  } else {
+    d.swing = 0
+  }
+  d.moving = true
+}
+
+func (d *Door) IsMoving() bool {
+  return d.moving
+}
+
+// Returns how far open the door is, from 0 (closed) to 1 (open).
+func (d *Door) OpenAmount() float64 {
+  if d.doorDef.Always_open {
+    return 1
+  }
+  if !d.moving {
+    if d.Opened {
+      return 1
+    }
+    return 0
+  }
+  frac := float64(d.swing) / DoorSwingTime
+  if d.Opened {
+    return frac
+  }
+  return 1 - frac
+}
+
+// Returns true if the door is open far enough to see through.  This happens
+// halfway through the swing, so los can open up before the door has
+// finished moving.
+func (d *Door) IsLosOpened() bool {
+  return d.OpenAmount() >= 0.5
+}
+
+// Advances the door's animation by dt ms.
+func (d *Door) Think(dt int64) {
+  if !d.moving {
+    return
+  }
+  d.swing += dt
+  if d.swing >= DoorSwingTime {
+    d.swing = 0
+    d.moving = false
+  }
+}
+
+// Returns true if ent_keys contains the key that unlocks this door.
+func (d *Door) CanUnlock(ent_keys []string) bool {
+  if d.Key == "" {
+    return false
+  }
+  for _, key := range ent_keys {
+    if key == d.Key {
+      return true
+    }
+  }
+  return false
 }
 
 func (d *Door) HighlightThreshold(v bool) {
   d.highlight_threshold = v
 }
 
+// Marks the door as an objective, which makes it pulse so that players can
+// tell that something will happen to it.
+func (d *Door) SetObjective(v bool) {
+  d.objective = v
+}
+
+func (d *Door) IsObjective() bool {
+  return d.objective
+}
+
+// How long, in ms, one pulse of an objective door takes.
+const doorPulsePeriod = 1500
+
 type doorState struct {
   // for tracking whether the buffers are dirty
   facing WallFacing
@@ -328,7 +579,7 @@ func (d *Door) setupGlStuff(room *Room) {
 }
 
 func (d *Door) TextureData() *texture.Data {
-  if d.IsOpened() {
+  if d.IsLosOpened() {
     return d.Opened_texture.Data()
   }
   return d.Closed_texture.Data()
@@ -337,33 +588,212 @@ func (d *Door) TextureData() *texture.Data {
 func (d *Door) Color() (r, g, b, a byte) {
   if d.temporary {
     if d.invalid {
-      return 255, 127, 127, 200
+      return palette.Placing_invalid.RGBA()
     } else {
-      return 127, 127, 255, 200
+      return palette.Placing.RGBA()
     }
   }
-  return 255, 255, 255, 255
+  if d.moving {
+    // Fade out the old texture and fade in the new one as the door swings
+    amt := 2*d.OpenAmount() - 1
+    if amt < 0 {
+      amt = -amt
+    }
+    return 255, 255, 255, byte(255 * amt)
+  }
+  r, g, b, a = 255, 255, 255, 255
+  if d.Locked {
+    if d.Key == "" {
+      // Only a script can unlock this one
+      r, g, b, _ = palette.Door_locked.RGBA()
+    } else {
+      r, g, b, _ = palette.Door_keyed.RGBA()
+    }
+  }
+  if d.objective {
+    t := float64(time.Now().UnixNano()/1e6%doorPulsePeriod) / doorPulsePeriod
+    pulse := 0.8 + 0.2*math.Cos(2*math.Pi*t)
+    r = byte(float64(r) * pulse)
+    g = byte(float64(g) * pulse)
+    b = byte(float64(b) * pulse)
+  }
+  return
+}
+
+// Returns the texture to draw on the floor of the room, taking the theme of
+// the floor it is on into account.
+func (room *Room) floorTexture() *texture.Object {
+  if tt := room.Theme_textures[room.theme]; tt != nil && tt.Floor.Path != "" {
+    return &tt.Floor
+  }
+  return &room.Floor
+}
+
+// Like floorTexture, but for the walls.
+func (room *Room) wallTexture() *texture.Object {
+  if tt := room.Theme_textures[room.theme]; tt != nil && tt.Wall.Path != "" {
+    return &tt.Wall
+  }
+  return &room.Wall
+}
+
+// Returns the height of room's walls and how many times the wall texture is
+// repeated vertically to fill them without being stretched.
+func (room *Room) wallHeight() (height, tiles float32) {
+  wall := room.wallTexture().Data()
+  var natural float32
+  if wall.Dx() > 0 {
+    natural = float32(wall.Dy()*(room.Size.Dx+room.Size.Dy)) / float32(wall.Dx())
+  }
+  if room.Wall_height <= 0 || natural == 0 {
+    return natural, 1
+  }
+  return float32(room.Wall_height), float32(room.Wall_height) / natural
 }
 
 func (r *Room) Pos() (x, y int) {
   return r.X, r.Y
 }
 
+// Converts fx, fy from floor coordinates to coordinates relative to r.
+func (r *Room) ToLocal(fx, fy int) (lx, ly int) {
+  return fx - r.X, fy - r.Y
+}
+
+// Converts lx, ly from coordinates relative to r to floor coordinates.
+func (r *Room) ToFloor(lx, ly int) (fx, fy int) {
+  return lx + r.X, ly + r.Y
+}
+
+// Returns true if the cell at fx, fy, given in floor coordinates, is part of
+// r.
+func (r *Room) Contains(fx, fy int) bool {
+  return r.HasCell(r.ToLocal(fx, fy))
+}
+
+// If the cell x, y in r and the cell x2, y2 in r2, both given in floor
+// coordinates, are next to each other across one of r's walls, returns the
+// facing of that wall and true.  Otherwise returns false.
+func FacingBetween(r, r2 *Room, x, y, x2, y2 int) (WallFacing, bool) {
+  if r == r2 || !r.Contains(x, y) || !r2.Contains(x2, y2) {
+    return 0, false
+  }
+  lx, ly := r.ToLocal(x, y)
+  switch {
+  case x2 == x-1 && y2 == y && lx == 0:
+    return NearLeft, true
+  case x2 == x+1 && y2 == y && lx == r.Size.Dx-1:
+    return FarRight, true
+  case y2 == y-1 && x2 == x && ly == 0:
+    return NearRight, true
+  case y2 == y+1 && x2 == x && ly == r.Size.Dy-1:
+    return FarLeft, true
+  }
+  return 0, false
+}
+
+// Returns the multiplier on the cost of moving into the cell at x, y, which
+// are given in room coordinates.
+func (r *Room) MoveCost(x, y int) float64 {
+  for _, mc := range r.Move_costs {
+    if mc.X == x && mc.Y == y && mc.Cost > 0 {
+      return mc.Cost
+    }
+  }
+  return 1
+}
+
 type Floor struct {
   Rooms  []*Room `registry:"loadfrom-rooms"`
   Spawns []*SpawnPoint
+
+  // One of the themes in tags.json, or empty to use the rooms' default
+  // textures.
+  Theme string
+
+  // Names of triggers, from the game's trigger registry, that are placed on
+  // this floor.
+  Triggers []string
 }
 
-func (f *Floor) canAddRoom(add *Room) bool {
+// Returns the rooms on f that are in the way of adding add.
+func (f *Floor) overlappingRooms(add *Room) []*Room {
+  var rooms []*Room
   for _, room := range f.Rooms {
     if room.temporary {
       continue
     }
     if roomOverlap(room, add) {
-      return false
+      rooms = append(rooms, room)
     }
   }
-  return true
+  return rooms
+}
+
+// Returns the i-th cell, in room coordinates, that door is placed against.
+func (room *Room) doorCell(door *Door, i int) (x, y int) {
+  switch door.Facing {
+  case FarLeft:
+    return door.Pos + i, room.Size.Dy - 1
+  case FarRight:
+    return room.Size.Dx - 1, door.Pos + i
+  case NearLeft:
+    return 0, door.Pos + i
+  }
+  return door.Pos + i, 0
+}
+
+// Must be called after adding doors to, removing doors from, or moving doors
+// in a room so that DoorsOnWall notices.
+func (room *Room) DoorsChanged() {
+  room.door_cache.clean = false
+}
+
+// Returns the doors on the wall of the room with the given facing, sorted by
+// Pos.  This is cached until DoorsChanged is called, callers may hold on to
+// the slice but must not modify it.
+func (room *Room) DoorsOnWall(facing WallFacing) []*Door {
+  if !facing.Valid() {
+    return nil
+  }
+  cache := &room.door_cache
+  if !cache.clean {
+    cache.clean = true
+    for i := range cache.walls {
+      cache.walls[i] = nil
+    }
+    for _, door := range room.Doors {
+      if door.Facing.Valid() {
+        cache.walls[door.Facing] = append(cache.walls[door.Facing], door)
+      }
+    }
+    for i := range cache.walls {
+      sort.Sort(doorsByPos(cache.walls[i]))
+    }
+  }
+  return cache.walls[facing]
+}
+
+type doorsByPos []*Door
+
+func (d doorsByPos) Len() int {
+  return len(d)
+}
+func (d doorsByPos) Less(i, j int) bool {
+  return d[i].Pos < d[j].Pos
+}
+func (d doorsByPos) Swap(i, j int) {
+  d[i], d[j] = d[j], d[i]
+}
+
+// Returns true if door isn't too wide for the wall it is on, which can happen
+// to a door that was placed before its room was resized.  A door occupies the
+// cells from Pos up to, but not including, Pos+Width.
+func (room *Room) doorFitsWall(door *Door) bool {
+  if door.Facing == FarLeft || door.Facing == NearRight {
+    return door.Pos+door.Width <= room.Size.Dx
+  }
+  return door.Pos+door.Width <= room.Size.Dy
 }
 
 func (room *Room) canAddDoor(door *Door) bool {
@@ -372,13 +802,15 @@ func (room *Room) canAddDoor(door *Door) bool {
   }
 
   // Make sure that the door only occupies valid cells
-  if door.Facing == FarLeft || door.Facing == NearRight {
-    if door.Pos+door.Width >= room.Size.Dx {
-      return false
-    }
+  if !room.doorFitsWall(door) {
+    return false
   }
-  if door.Facing == FarRight || door.Facing == NearLeft {
-    if door.Pos+door.Width >= room.Size.Dy {
+
+  // Make sure that the room allows doors on every cell the door touches, and
+  // that all of those cells are actually part of the room
+  for i := 0; i < door.Width; i++ {
+    x, y := room.doorCell(door, i)
+    if !room.CanHaveDoor(x, y) || !room.HasCell(x, y) {
       return false
     }
   }
@@ -458,6 +890,8 @@ func (f *Floor) findRoomForDoor(target *Room, door *Door) (*Room, *Door) {
         temp := MakeDoor(door.Defname)
         temp.Pos = door.Pos - (room.X - target.X)
         temp.Facing = NearRight
+        temp.Locked = door.Locked
+        temp.Key = door.Key
         if room.canAddDoor(temp) {
           return room, temp
         }
@@ -469,6 +903,34 @@ func (f *Floor) findRoomForDoor(target *Room, door *Door) (*Room, *Door) {
         temp := MakeDoor(door.Defname)
         temp.Pos = door.Pos - (room.Y - target.Y)
         temp.Facing = NearLeft
+        temp.Locked = door.Locked
+        temp.Key = door.Key
+        if room.canAddDoor(temp) {
+          return room, temp
+        }
+      }
+    }
+  } else if door.Facing == NearRight {
+    for _, room := range f.Rooms {
+      if target.Y == room.Y+room.Size.Dy {
+        temp := MakeDoor(door.Defname)
+        temp.Pos = door.Pos - (room.X - target.X)
+        temp.Facing = FarLeft
+        temp.Locked = door.Locked
+        temp.Key = door.Key
+        if room.canAddDoor(temp) {
+          return room, temp
+        }
+      }
+    }
+  } else if door.Facing == NearLeft {
+    for _, room := range f.Rooms {
+      if target.X == room.X+room.Size.Dx {
+        temp := MakeDoor(door.Defname)
+        temp.Pos = door.Pos - (room.Y - target.Y)
+        temp.Facing = FarRight
+        temp.Locked = door.Locked
+        temp.Key = door.Key
         if room.canAddDoor(temp) {
           return room, temp
         }
@@ -478,6 +940,22 @@ func (f *Floor) findRoomForDoor(target *Room, door *Door) (*Room, *Door) {
   return nil, nil
 }
 
+// Adds door to target along with its matching door in the room on the other
+// side of the wall, which works for a door on any of the four walls.  Returns
+// false and leaves both rooms alone if there is no room there that can take
+// the matching door.
+func (f *Floor) AddDoor(target *Room, door *Door) bool {
+  other_room, other_door := f.findRoomForDoor(target, door)
+  if other_room == nil {
+    return false
+  }
+  target.Doors = append(target.Doors, door)
+  other_room.Doors = append(other_room.Doors, other_door)
+  target.DoorsChanged()
+  other_room.DoorsChanged()
+  return true
+}
+
 func (f *Floor) canAddDoor(target *Room, door *Door) bool {
   r, _ := f.findRoomForDoor(target, door)
   return r != nil
@@ -489,14 +967,91 @@ func (f *Floor) removeInvalidDoors() {
       _, other_door := f.FindMatchingDoor(room, a.(*Door))
       return other_door != nil && !other_door.temporary
     }).([]*Door)
+    room.DoorsChanged()
+  }
+}
+
+// Places a matched pair of doors, of the type named defname, between every
+// pair of adjacent rooms that aren't already connected by a door and share
+// enough wall to fit one.  Doors are placed as close to the middle of the
+// shared wall as possible.  Returns the number of pairs of doors created.
+func (f *Floor) AutoConnect(defname string) int {
+  count := 0
+  for _, target := range f.Rooms {
+    for _, facing := range []WallFacing{FarLeft, FarRight} {
+      // Rooms that are already connected to target through this wall
+      connected := make(map[*Room]bool)
+      for _, door := range target.Doors {
+        if door.Facing != facing {
+          continue
+        }
+        if room, _ := f.FindMatchingDoor(target, door); room != nil {
+          connected[room] = true
+        }
+      }
+
+      // Collect every position along this wall that a door could go, grouped
+      // by the room on the other side.
+      length := target.Size.Dx
+      if facing == FarRight {
+        length = target.Size.Dy
+      }
+      candidates := make(map[*Room][]int)
+      var rooms []*Room
+      for pos := 0; pos < length; pos++ {
+        door := MakeDoor(defname)
+        door.Facing = facing
+        door.Pos = pos
+        room, _ := f.findRoomForDoor(target, door)
+        if room == nil || connected[room] {
+          continue
+        }
+        if _, ok := candidates[room]; !ok {
+          rooms = append(rooms, room)
+        }
+        candidates[room] = append(candidates[room], pos)
+      }
+
+      for _, room := range rooms {
+        positions := candidates[room]
+        valid := make(map[int]bool)
+        for _, pos := range positions {
+          valid[pos] = true
+        }
+        mid := (positions[0] + positions[len(positions)-1]) / 2
+        placed := false
+        for d := 0; d < length && !placed; d++ {
+          for _, pos := range []int{mid - d, mid + d} {
+            if !valid[pos] {
+              continue
+            }
+            door := MakeDoor(defname)
+            door.Facing = facing
+            door.Pos = pos
+            other_room, other_door := f.findRoomForDoor(target, door)
+            if other_room != room {
+              continue
+            }
+            target.Doors = append(target.Doors, door)
+            room.Doors = append(room.Doors, other_door)
+            target.DoorsChanged()
+            room.DoorsChanged()
+            count++
+            placed = true
+            break
+          }
+        }
+      }
+    }
   }
+  return count
 }
 
 func (f *Floor) RoomFurnSpawnAtPos(x, y int) (room *Room, furn *Furniture, spawn *SpawnPoint) {
   for _, croom := range f.Rooms {
     rx, ry := croom.Pos()
     rdx, rdy := croom.Dims()
-    if x < rx || y < ry || x >= rx+rdx || y >= ry+rdy {
+    if x < rx || y < ry || x >= rx+rdx || y >= ry+rdy || !croom.HasCell(x-rx, y-ry) {
       continue
     }
     room = croom
@@ -526,6 +1081,9 @@ func (f *Floor) RoomFurnSpawnAtPos(x, y int) (room *Room, furn *Furniture, spawn
 }
 
 func (f *Floor) render(region gui.Region, focusx, focusy, angle, zoom float32, drawables []Drawable, los_tex *LosTexture, floor_drawers []FloorDrawer) {
+  for _, room := range f.Rooms {
+    room.theme = f.Theme
+  }
   var ros []RectObject
   algorithm.Map2(f.Rooms, &ros, func(r *Room) RectObject { return r })
   // Do not include temporary objects in the ordering, since they will likely
@@ -633,6 +1191,9 @@ type HouseDef struct {
   Icon texture.Object
 
   Floors []*Floor
+
+  // Index into Floors of the floor that the explorers start on
+  Starting_floor int
 }
 
 func MakeHouseDef() *HouseDef {
@@ -671,13 +1232,75 @@ func (h *HouseDef) Normalize() {
   }
 }
 
+// Checks that every room in the house can be reached from the starting floor,
+// and that every door fits on its wall, and returns a description of each
+// problem found.  Rooms are connected by any door that has been placed
+// between them, the search starts from the first room on the starting floor.
+func (h *HouseDef) Validate() []string {
+  var problems []string
+  for i, floor := range h.Floors {
+    for _, room := range floor.Rooms {
+      for _, door := range room.Doors {
+        if !door.temporary && !room.doorFitsWall(door) {
+          problems = append(problems, fmt.Sprintf("Door '%s' at position %d on the %v wall of room '%s' on floor %d is too wide for the wall", door.Defname, door.Pos, door.Facing, room.Name, i))
+        }
+      }
+    }
+  }
+  if h.Starting_floor < 0 || h.Starting_floor >= len(h.Floors) {
+    return append(problems, fmt.Sprintf("Starting floor %d does not exist", h.Starting_floor))
+  }
+  start := h.Floors[h.Starting_floor]
+  if len(start.Rooms) == 0 {
+    return append(problems, fmt.Sprintf("Starting floor %d has no rooms", h.Starting_floor))
+  }
+
+  reached := map[*Room]bool{start.Rooms[0]: true}
+  queue := []*Room{start.Rooms[0]}
+  for len(queue) > 0 {
+    room := queue[0]
+    queue = queue[1:]
+    for _, door := range room.Doors {
+      if door.temporary {
+        continue
+      }
+      other, _ := start.FindMatchingDoor(room, door)
+      if other != nil && !reached[other] {
+        reached[other] = true
+        queue = append(queue, other)
+      }
+    }
+  }
+
+  for i, floor := range h.Floors {
+    if len(floor.Rooms) == 0 {
+      continue
+    }
+    if i != h.Starting_floor {
+      // There is no way to move between floors yet
+      problems = append(problems, fmt.Sprintf("Floor %d is not connected to the starting floor", i))
+      continue
+    }
+    for _, room := range floor.Rooms {
+      if !reached[room] {
+        problems = append(problems, fmt.Sprintf("Room '%s' at (%d, %d) on floor %d is unreachable", room.Name, room.X, room.Y, i))
+      }
+    }
+  }
+  return problems
+}
+
 type HouseEditor struct {
   *gui.HorizontalTable
   tab     *gui.TabFrame
   widgets []tabWidget
 
-  house  HouseDef
-  viewer *HouseViewer
+  house   HouseDef
+  viewer  *HouseViewer
+  minimap *MiniMap
+
+  undo    editUndoStack
+  key_map base.KeyMap
 }
 
 func (he *HouseEditor) GetViewer() Viewer {
@@ -703,6 +1326,9 @@ type houseDataTab struct {
   num_floors *gui.ComboBox
   icon       *gui.FileWidget
 
+  // Theme of the floor being edited, the first option is no theme
+  theme *gui.ComboBox
+
   house  *HouseDef
   viewer *HouseViewer
 
@@ -715,13 +1341,33 @@ type houseDataTab struct {
   temp_room, prev_room *Room
 
   temp_spawns []*SpawnPoint
+
+  // State of the house before the current operation began
+  undo    *editUndoStack
+  pending *houseSnapshot
+
+  // The most recently copied room, and whether temp_room was pasted from it
+  clipboard *Room
+  pasting   bool
+
+  // The room whose edges are being dragged, if any, and the edges of the
+  // room under the cursor that could be dragged.
+  resizing *roomResize
+  handles  roomHandles
+
+  // Buttons for every room that can be placed
+  rooms *nameFilter
+
+  key_map base.KeyMap
 }
 
-func makeHouseDataTab(house *HouseDef, viewer *HouseViewer) *houseDataTab {
+func makeHouseDataTab(house *HouseDef, viewer *HouseViewer, undo *editUndoStack) *houseDataTab {
   var hdt houseDataTab
   hdt.VerticalTable = gui.MakeVerticalTable()
   hdt.house = house
   hdt.viewer = viewer
+  hdt.undo = undo
+  hdt.key_map = base.GetDefaultKeyMap()
 
   hdt.name = gui.MakeTextEditLine("standard", "name", 300, 1, 1, 1, 1)
   num_floors_options := []string{"1 Floor", "2 Floors", "3 Floors", "4 Floors"}
@@ -730,33 +1376,75 @@ func makeHouseDataTab(house *HouseDef, viewer *HouseViewer) *houseDataTab {
     hdt.house.Icon.Path = base.Path(filepath.Join(datadir, "houses", "icons"))
   }
   hdt.icon = gui.MakeFileWidget(string(hdt.house.Icon.Path), imagePathFilter)
+  hdt.theme = gui.MakeComboTextBox(append([]string{"No Theme"}, tags.Themes...), 300)
 
   hdt.VerticalTable.AddChild(hdt.name)
   hdt.VerticalTable.AddChild(hdt.num_floors)
   hdt.VerticalTable.AddChild(hdt.icon)
+  hdt.VerticalTable.AddChild(hdt.theme)
+  hdt.VerticalTable.AddChild(gui.MakeButton("standard", "Check House", 300, 1, 1, 1, 1, func(int64) {
+    problems := hdt.house.Validate()
+    for _, problem := range problems {
+      base.Warn().Printf("%s", problem)
+    }
+    if len(problems) == 0 {
+      base.Log().Printf("House '%s' is fully connected", hdt.house.Name)
+    }
+  }))
 
-  names := GetAllRoomNames()
-  room_buttons := gui.MakeVerticalTable()
-  for _, name := range names {
-    n := name
-    room_buttons.AddChild(gui.MakeButton("standard", name, 300, 1, 1, 1, 1, func(int64) {
-      if hdt.temp_room != nil {
-        return
-      }
-      hdt.temp_room = &Room{Defname: n}
-      base.GetObject("rooms", hdt.temp_room)
-      hdt.temp_room.temporary = true
-      hdt.temp_room.invalid = true
-      hdt.house.Floors[0].Rooms = append(hdt.house.Floors[0].Rooms, hdt.temp_room)
-      hdt.drag_anchor.x = float32(hdt.temp_room.Size.Dx / 2)
-      hdt.drag_anchor.y = float32(hdt.temp_room.Size.Dy / 2)
-    }))
+  roomCategory := func(name string) string {
+    r := Room{Defname: name}
+    base.GetObject("rooms", &r)
+    return r.Category
   }
-  scroller := gui.MakeScrollFrame(room_buttons, 300, 700)
-  hdt.VerticalTable.AddChild(scroller)
+  hdt.rooms = makeNameFilter(GetAllRoomNames(), roomCategory, func(name string) {
+    if hdt.temp_room != nil {
+      return
+    }
+    hdt.pending = snapshotHouse(hdt.house)
+    hdt.temp_room = &Room{Defname: name}
+    base.GetObject("rooms", hdt.temp_room)
+    hdt.temp_room.temporary = true
+    hdt.temp_room.invalid = true
+    hdt.house.Floors[0].Rooms = append(hdt.house.Floors[0].Rooms, hdt.temp_room)
+    hdt.drag_anchor.x = float32(hdt.temp_room.Size.Dx / 2)
+    hdt.drag_anchor.y = float32(hdt.temp_room.Size.Dy / 2)
+  })
+  hdt.VerticalTable.AddChild(hdt.rooms)
+  hdt.viewer.AddFloorDrawable(&hdt.handles)
   return &hdt
 }
+// Marks room as invalid if it can't be placed where it is, and marks every
+// room that is in its way so the user can see why.
+func (hdt *houseDataTab) checkPlacement(room *Room) {
+  conflicts := hdt.house.Floors[0].overlappingRooms(room)
+  room.invalid = len(conflicts) > 0
+  for _, other := range conflicts {
+    other.conflict = true
+  }
+}
+
 func (hdt *houseDataTab) Think(ui *gui.Gui, t int64) {
+  hdt.handles.room = nil
+  for _, room := range hdt.house.Floors[0].Rooms {
+    room.conflict = false
+  }
+  if hdt.resizing != nil {
+    bx, by := hdt.viewer.WindowToBoard(gin.In().GetCursor("Mouse").Point())
+    hdt.resizing.update(bx, by)
+    hdt.checkPlacement(hdt.resizing.room)
+    hdt.handles.room = hdt.resizing.room
+    hdt.handles.edges = hdt.resizing.edges
+  } else if hdt.temp_room == nil {
+    bx, by := hdt.viewer.WindowToBoard(gin.In().GetCursor("Mouse").Point())
+    for _, room := range hdt.house.Floors[0].Rooms {
+      if edges := roomEdgesAt(room, bx, by); edges != 0 {
+        hdt.handles.room = room
+        hdt.handles.edges = edges
+        break
+      }
+    }
+  }
   if hdt.temp_room != nil {
     mx, my := gin.In().GetCursor("Mouse").Point()
     bx, by := hdt.viewer.WindowToBoard(mx, my)
@@ -769,8 +1457,9 @@ func (hdt *houseDataTab) Think(ui *gui.Gui, t int64) {
       hdt.temp_spawns[i].X += dx
       hdt.temp_spawns[i].Y += dy
     }
-    hdt.temp_room.invalid = !hdt.house.Floors[0].canAddRoom(hdt.temp_room)
+    hdt.checkPlacement(hdt.temp_room)
   }
+  hdt.rooms.update()
   hdt.VerticalTable.Think(ui, t)
   num_floors := hdt.num_floors.GetComboedIndex() + 1
   if len(hdt.house.Floors) != num_floors {
@@ -783,9 +1472,57 @@ func (hdt *houseDataTab) Think(ui *gui.Gui, t int64) {
   }
   hdt.house.Name = hdt.name.GetText()
   hdt.house.Icon.Path = base.Path(hdt.icon.GetPath())
+  if theme := hdt.theme.GetComboedIndex(); theme > 0 {
+    hdt.house.Floors[hdt.current_floor].Theme = tags.Themes[theme-1]
+  } else {
+    hdt.house.Floors[hdt.current_floor].Theme = ""
+  }
+}
+
+// Pushes the operation that began when pending was taken onto the undo stack.
+func (hdt *houseDataTab) commit() {
+  if hdt.pending != nil {
+    hdt.undo.Push(&houseEdit{hdt.pending, snapshotHouse(hdt.house)})
+    hdt.pending = nil
+  }
+}
+
+// Places the doors on a pasted room, keeping only the ones that can be matched
+// up with a door in a neighboring room.
+func (hdt *houseDataTab) placePastedDoors(floor *Floor) {
+  doors := hdt.temp_room.Doors
+  hdt.temp_room.Doors = nil
+  hdt.temp_room.DoorsChanged()
+  for _, door := range doors {
+    floor.AddDoor(hdt.temp_room, door)
+  }
+}
+
+func (hdt *houseDataTab) paste() {
+  if hdt.clipboard == nil || hdt.temp_room != nil {
+    return
+  }
+  hdt.pending = snapshotHouse(hdt.house)
+  hdt.temp_room = hdt.clipboard.copy()
+  hdt.temp_room.temporary = true
+  hdt.temp_room.invalid = true
+  hdt.pasting = true
+  hdt.temp_spawns = hdt.temp_spawns[0:0]
+  hdt.house.Floors[0].Rooms = append(hdt.house.Floors[0].Rooms, hdt.temp_room)
+  hdt.drag_anchor.x = float32(hdt.temp_room.Size.Dx / 2)
+  hdt.drag_anchor.y = float32(hdt.temp_room.Size.Dy / 2)
 }
 
 func (hdt *houseDataTab) onEscape() {
+  hdt.pending = nil
+  hdt.pasting = false
+  if hdt.resizing != nil {
+    hdt.resizing.cancel()
+    hdt.resizing = nil
+  }
+  if hdt.temp_room == nil {
+    return
+  }
   if hdt.prev_room != nil {
     dx := hdt.prev_room.X - hdt.temp_room.X
     dy := hdt.prev_room.Y - hdt.temp_room.Y
@@ -808,11 +1545,28 @@ func (hdt *houseDataTab) Respond(ui *gui.Gui, group gui.EventGroup) bool {
     return true
   }
 
-  if found, event := group.FindEvent(gin.Escape); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(hdt.key_map["cancel"].Id()); found && event.Type == gin.Press {
     hdt.onEscape()
     return true
   }
 
+  if found, event := group.FindEvent(hdt.key_map["copy"].Id()); found && event.Type == gin.Press {
+    room := hdt.temp_room
+    if room == nil {
+      bx, by := hdt.viewer.WindowToBoard(gin.In().GetCursor("Mouse").Point())
+      room, _, _ = hdt.house.Floors[0].RoomFurnSpawnAtPos(roundDown(bx), roundDown(by))
+    }
+    if room != nil {
+      hdt.clipboard = room.copy()
+    }
+    return true
+  }
+
+  if found, event := group.FindEvent(hdt.key_map["paste"].Id()); found && event.Type == gin.Press {
+    hdt.paste()
+    return true
+  }
+
   if found, event := group.FindEvent(gin.DeleteOrBackspace); found && event.Type == gin.Press {
     if hdt.temp_room != nil {
       spawns := make(map[*SpawnPoint]bool)
@@ -825,6 +1579,11 @@ func (hdt *houseDataTab) Respond(ui *gui.Gui, group gui.EventGroup) bool {
       algorithm.Choose2(&hdt.house.Floors[0].Rooms, func(r *Room) bool {
         return r != hdt.temp_room
       })
+      if hdt.prev_room != nil {
+        hdt.commit()
+      }
+      hdt.pending = nil
+      hdt.pasting = false
       hdt.temp_room = nil
       hdt.prev_room = nil
       hdt.viewer.SetBounds()
@@ -833,11 +1592,37 @@ func (hdt *houseDataTab) Respond(ui *gui.Gui, group gui.EventGroup) bool {
   }
 
   floor := hdt.house.Floors[hdt.current_floor]
-  if found, event := group.FindEvent(gin.MouseLButton); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(hdt.key_map["place"].Id()); found && event.Type == gin.Release && hdt.resizing != nil {
+    room := hdt.resizing.room
+    if room.invalid {
+      hdt.onEscape()
+    } else {
+      room.temporary = false
+      floor.removeInvalidDoors()
+      hdt.commit()
+      hdt.resizing = nil
+      hdt.viewer.SetBounds()
+    }
+    return true
+  }
+  if found, event := group.FindEvent(hdt.key_map["place"].Id()); found && event.Type == gin.Press {
+    if hdt.resizing != nil {
+      return true
+    }
+    if hdt.temp_room == nil && hdt.handles.room != nil {
+      hdt.pending = snapshotHouse(hdt.house)
+      hdt.resizing = startRoomResize(hdt.handles.room, hdt.handles.edges)
+      return true
+    }
     if hdt.temp_room != nil {
       if !hdt.temp_room.invalid {
         hdt.temp_room.temporary = false
+        if hdt.pasting {
+          hdt.placePastedDoors(floor)
+          hdt.pasting = false
+        }
         floor.removeInvalidDoors()
+        hdt.commit()
         hdt.temp_room = nil
         hdt.prev_room = nil
         hdt.viewer.SetBounds()
@@ -849,6 +1634,7 @@ func (hdt *houseDataTab) Respond(ui *gui.Gui, group gui.EventGroup) bool {
         x, y := floor.Rooms[i].Pos()
         dx, dy := floor.Rooms[i].Dims()
         if int(bx) >= x && int(bx) < x+dx && int(by) >= y && int(by) < y+dy {
+          hdt.pending = snapshotHouse(hdt.house)
           hdt.temp_room = floor.Rooms[i]
           hdt.prev_room = new(Room)
           *hdt.prev_room = *hdt.temp_room
@@ -875,11 +1661,25 @@ func (hdt *houseDataTab) Respond(ui *gui.Gui, group gui.EventGroup) bool {
 
   return false
 }
-func (hdt *houseDataTab) Collapse() {}
-func (hdt *houseDataTab) Expand()   {}
+func (hdt *houseDataTab) Collapse() {
+  hdt.onEscape()
+  hdt.handles.room = nil
+  hdt.viewer.RemoveFloorDrawable(&hdt.handles)
+}
+func (hdt *houseDataTab) Expand() {
+  hdt.viewer.RemoveFloorDrawable(&hdt.handles)
+  hdt.viewer.AddFloorDrawable(&hdt.handles)
+}
 func (hdt *houseDataTab) Reload() {
+  hdt.onEscape()
   hdt.name.SetText(hdt.house.Name)
   hdt.icon.SetPath(string(hdt.house.Icon.Path))
+  hdt.theme.SetSelectedIndex(0)
+  for i, theme := range tags.Themes {
+    if theme == hdt.house.Floors[hdt.current_floor].Theme {
+      hdt.theme.SetSelectedIndex(i + 1)
+    }
+  }
 }
 
 type houseDoorTab struct {
@@ -887,9 +1687,23 @@ type houseDoorTab struct {
 
   num_floors *gui.ComboBox
 
+  // Applied to doors as they are placed, and set from a door when it is
+  // picked up so that it can be changed.
+  locked *gui.ComboBox
+  key    *gui.TextEditLine
+
+  // Type of door to use when auto connecting rooms
+  auto_door *gui.ComboBox
+
+  // Buttons for every door that can be placed
+  doors *nameFilter
+
   house  *HouseDef
   viewer *HouseViewer
 
+  // Shows whether each door is open while this tab is expanded
+  markers floorDoorMarkers
+
   // Distance from the mouse to the center of the object, in board coordinates
   drag_anchor struct{ x, y float32 }
 
@@ -898,66 +1712,110 @@ type houseDoorTab struct {
 
   temp_room, prev_room *Room
   temp_door, prev_door *Door
+
+  // State of the house before the current operation began, this includes
+  // the matching door so that both halves of a pair are restored together.
+  undo    *editUndoStack
+  pending *houseSnapshot
 }
 
-func makeHouseDoorTab(house *HouseDef, viewer *HouseViewer) *houseDoorTab {
+func makeHouseDoorTab(house *HouseDef, viewer *HouseViewer, undo *editUndoStack) *houseDoorTab {
   var hdt houseDoorTab
   hdt.VerticalTable = gui.MakeVerticalTable()
   hdt.house = house
   hdt.viewer = viewer
+  hdt.undo = undo
+  hdt.markers.floor = func() *Floor {
+    return hdt.house.Floors[hdt.current_floor]
+  }
+
+  hdt.locked = gui.MakeComboTextBox([]string{"Unlocked", "Locked"}, 300)
+  hdt.key = gui.MakeTextEditLine("standard", "", 300, 1, 1, 1, 1)
+  hdt.VerticalTable.AddChild(hdt.locked)
+  hdt.VerticalTable.AddChild(hdt.key)
 
   names := GetAllDoorNames()
-  door_buttons := gui.MakeVerticalTable()
-  for _, name := range names {
-    n := name
-    door_buttons.AddChild(gui.MakeButton("standard", name, 300, 1, 1, 1, 1, func(int64) {
-      if len(hdt.house.Floors[0].Rooms) < 2 || hdt.temp_door != nil {
+  doorCategory := func(name string) string {
+    return MakeDoor(name).Category
+  }
+  hdt.doors = makeNameFilter(names, doorCategory, func(name string) {
+    if len(hdt.house.Floors[0].Rooms) < 2 || hdt.temp_door != nil {
+      return
+    }
+    hdt.pending = snapshotHouse(hdt.house)
+    hdt.temp_door = MakeDoor(name)
+    hdt.temp_door.temporary = true
+    hdt.temp_door.invalid = true
+    hdt.temp_room = hdt.house.Floors[0].Rooms[0]
+  })
+  hdt.VerticalTable.AddChild(hdt.doors)
+
+  // Roughs in the connectivity of the current floor by putting a door
+  // between every pair of adjacent rooms that doesn't already have one.
+  if len(names) > 0 {
+    hdt.auto_door = gui.MakeComboTextBox(names, 300)
+    hdt.VerticalTable.AddChild(hdt.auto_door)
+    hdt.VerticalTable.AddChild(gui.MakeButton("standard", "Auto Connect", 300, 1, 1, 1, 1, func(int64) {
+      if hdt.temp_door != nil {
         return
       }
-      hdt.temp_door = MakeDoor(n)
-      hdt.temp_door.temporary = true
-      hdt.temp_door.invalid = true
-      hdt.temp_room = hdt.house.Floors[0].Rooms[0]
+      before := snapshotHouse(hdt.house)
+      floor := hdt.house.Floors[hdt.current_floor]
+      count := floor.AutoConnect(names[hdt.auto_door.GetComboedIndex()])
+      if count > 0 {
+        hdt.undo.Push(&houseEdit{before, snapshotHouse(hdt.house)})
+      }
+      base.Log().Printf("Auto connect placed %d pairs of doors", count)
     }))
   }
-  scroller := gui.MakeScrollFrame(door_buttons, 300, 700)
-  hdt.VerticalTable.AddChild(scroller)
   return &hdt
 }
 func (hdt *houseDoorTab) Think(ui *gui.Gui, t int64) {
+  hdt.doors.update()
   hdt.VerticalTable.Think(ui, t)
 }
+func (hdt *houseDoorTab) commit() {
+  if hdt.pending != nil {
+    hdt.undo.Push(&houseEdit{hdt.pending, snapshotHouse(hdt.house)})
+    hdt.pending = nil
+  }
+}
 func (hdt *houseDoorTab) onEscape() {
-  if hdt.temp_door != nil {
-    if hdt.temp_room != nil {
-      algorithm.Choose2(&hdt.temp_room.Doors, func(d *Door) bool {
-        return d != hdt.temp_door
-      })
-    }
-    if hdt.prev_door != nil {
-      hdt.prev_room.Doors = append(hdt.prev_room.Doors, hdt.prev_door)
-      hdt.prev_door.state.pos = -1 // forces it to redo its gl data
-      hdt.prev_door = nil
-      hdt.prev_room = nil
-    }
-    hdt.temp_door = nil
-    hdt.temp_room = nil
+  if hdt.temp_door != nil && hdt.pending != nil {
+    // Picking up a door also removes the matching door from the room on the
+    // other side of the wall, so restore the whole house to put both back.
+    hdt.pending.restore()
   }
+  hdt.pending = nil
+  hdt.temp_door = nil
+  hdt.temp_room = nil
+  hdt.prev_door = nil
+  hdt.prev_room = nil
 }
 func (hdt *houseDoorTab) Respond(ui *gui.Gui, group gui.EventGroup) bool {
   if hdt.VerticalTable.Respond(ui, group) {
     return true
   }
 
-  if found, event := group.FindEvent(gin.Escape); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["cancel"].Id()); found && event.Type == gin.Press {
     hdt.onEscape()
     return true
   }
 
   if found, event := group.FindEvent(gin.DeleteOrBackspace); found && event.Type == gin.Press {
-    algorithm.Choose2(&hdt.temp_room.Doors, func(d *Door) bool {
-      return d != hdt.temp_door
-    })
+    if hdt.temp_door == nil {
+      return true
+    }
+    if hdt.temp_room != nil {
+      algorithm.Choose2(&hdt.temp_room.Doors, func(d *Door) bool {
+        return d != hdt.temp_door
+      })
+      hdt.temp_room.DoorsChanged()
+    }
+    if hdt.prev_door != nil {
+      hdt.commit()
+    }
+    hdt.pending = nil
     hdt.temp_room = nil
     hdt.temp_door = nil
     hdt.prev_room = nil
@@ -976,10 +1834,15 @@ func (hdt *houseDoorTab) Respond(ui *gui.Gui, group gui.EventGroup) bool {
       algorithm.Choose2(&hdt.temp_room.Doors, func(d *Door) bool {
         return d != hdt.temp_door
       })
+      hdt.temp_room.DoorsChanged()
       hdt.temp_room = room
       hdt.temp_door.invalid = (hdt.temp_room == nil)
       hdt.temp_room.Doors = append(hdt.temp_room.Doors, hdt.temp_door)
     }
+    // FindClosestDoorPos moves the door even if it stays in the same room
+    if hdt.temp_room != nil {
+      hdt.temp_room.DoorsChanged()
+    }
     if hdt.temp_room == nil {
       hdt.temp_door.invalid = true
     } else {
@@ -989,27 +1852,42 @@ func (hdt *houseDoorTab) Respond(ui *gui.Gui, group gui.EventGroup) bool {
   }
 
   floor := hdt.house.Floors[hdt.current_floor]
-  if found, event := group.FindEvent(gin.MouseLButton); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["place"].Id()); found && event.Type == gin.Press {
     if hdt.temp_door != nil {
+      hdt.temp_door.Locked = hdt.locked.GetComboedIndex() == 1
+      hdt.temp_door.Key = hdt.key.GetText()
       other_room, other_door := floor.findRoomForDoor(hdt.temp_room, hdt.temp_door)
       if other_room != nil {
         other_room.Doors = append(other_room.Doors, other_door)
+        other_room.DoorsChanged()
         hdt.temp_door.temporary = false
+        hdt.commit()
         hdt.temp_door = nil
         hdt.prev_door = nil
       }
     } else {
-      hdt.temp_room, hdt.temp_door = hdt.viewer.FindClosestExistingDoor(bx, by)
+      room, door := hdt.viewer.FindClosestExistingDoor(bx, by)
+      if door != nil {
+        hdt.pending = snapshotHouse(hdt.house)
+      }
+      hdt.temp_room, hdt.temp_door = room, door
       if hdt.temp_door != nil {
         hdt.prev_door = new(Door)
         *hdt.prev_door = *hdt.temp_door
         hdt.prev_room = hdt.temp_room
         hdt.temp_door.temporary = true
+        if hdt.temp_door.Locked {
+          hdt.locked.SetSelectedIndex(1)
+        } else {
+          hdt.locked.SetSelectedIndex(0)
+        }
+        hdt.key.SetText(hdt.temp_door.Key)
         room, door := hdt.house.Floors[0].FindMatchingDoor(hdt.temp_room, hdt.temp_door)
         if room != nil {
           algorithm.Choose2(&room.Doors, func(d *Door) bool {
             return d != door
           })
+          room.DoorsChanged()
         }
       }
     }
@@ -1020,8 +1898,15 @@ func (hdt *houseDoorTab) Respond(ui *gui.Gui, group gui.EventGroup) bool {
 }
 func (hdt *houseDoorTab) Collapse() {
   hdt.onEscape()
+  hdt.viewer.RemoveFloorDrawable(&hdt.markers)
 }
 func (hdt *houseDoorTab) Expand() {
+  hdt.viewer.RemoveFloorDrawable(&hdt.markers)
+  hdt.viewer.AddFloorDrawable(&hdt.markers)
+  // The lock settings may have been copied from a door that was picked up
+  // the last time this tab was open, so start over with an unlocked door.
+  hdt.locked.SetSelectedIndex(0)
+  hdt.key.SetText("")
 }
 func (hdt *houseDoorTab) Reload() {
   hdt.onEscape()
@@ -1043,9 +1928,13 @@ type houseRelicsTab struct {
   temp_relic, prev_relic *SpawnPoint
 
   drag_anchor struct{ x, y float32 }
+
+  undo    *editUndoStack
+  pending *houseSnapshot
 }
 
 func (hdt *houseRelicsTab) newSpawn() {
+  hdt.pending = snapshotHouse(hdt.house)
   hdt.temp_relic = new(SpawnPoint)
   hdt.temp_relic.Name = hdt.spawn_name.GetText()
   hdt.temp_relic.X = 10000
@@ -1056,11 +1945,12 @@ func (hdt *houseRelicsTab) newSpawn() {
   hdt.house.Floors[0].Spawns = append(hdt.house.Floors[0].Spawns, hdt.temp_relic)
 }
 
-func makeHouseRelicsTab(house *HouseDef, viewer *HouseViewer) *houseRelicsTab {
+func makeHouseRelicsTab(house *HouseDef, viewer *HouseViewer, undo *editUndoStack) *houseRelicsTab {
   var hdt houseRelicsTab
   hdt.VerticalTable = gui.MakeVerticalTable()
   hdt.house = house
   hdt.viewer = viewer
+  hdt.undo = undo
 
   hdt.VerticalTable.AddChild(gui.MakeTextLine("standard", "Spawns", 300, 1, 1, 1, 1))
   hdt.spawn_name = gui.MakeTextEditLine("standard", "", 300, 1, 1, 1, 1)
@@ -1074,7 +1964,15 @@ func makeHouseRelicsTab(house *HouseDef, viewer *HouseViewer) *houseRelicsTab {
   return &hdt
 }
 
+func (hdt *houseRelicsTab) commit() {
+  if hdt.pending != nil {
+    hdt.undo.Push(&houseEdit{hdt.pending, snapshotHouse(hdt.house)})
+    hdt.pending = nil
+  }
+}
+
 func (hdt *houseRelicsTab) onEscape() {
+  hdt.pending = nil
   if hdt.temp_relic != nil {
     if hdt.prev_relic != nil {
       *hdt.temp_relic = *hdt.prev_relic
@@ -1161,7 +2059,7 @@ func (hdt *houseRelicsTab) Respond(ui *gui.Gui, group gui.EventGroup) bool {
     return true
   }
 
-  if found, event := group.FindEvent(gin.Escape); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["cancel"].Id()); found && event.Type == gin.Press {
     hdt.onEscape()
     return true
   }
@@ -1170,6 +2068,10 @@ func (hdt *houseRelicsTab) Respond(ui *gui.Gui, group gui.EventGroup) bool {
     algorithm.Choose2(&hdt.house.Floors[0].Spawns, func(s *SpawnPoint) bool {
       return s != hdt.temp_relic
     })
+    if hdt.prev_relic != nil {
+      hdt.commit()
+    }
+    hdt.pending = nil
     hdt.temp_relic = nil
     hdt.prev_relic = nil
     return true
@@ -1177,10 +2079,11 @@ func (hdt *houseRelicsTab) Respond(ui *gui.Gui, group gui.EventGroup) bool {
 
   cursor := group.Events[0].Key.Cursor()
   floor := hdt.house.Floors[hdt.current_floor]
-  if found, event := group.FindEvent(gin.MouseLButton); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["place"].Id()); found && event.Type == gin.Press {
     if hdt.temp_relic != nil {
       if !hdt.temp_relic.invalid {
         hdt.temp_relic.temporary = false
+        hdt.commit()
         hdt.temp_relic = nil
       }
     } else {
@@ -1190,6 +2093,7 @@ func (hdt *houseRelicsTab) Respond(ui *gui.Gui, group gui.EventGroup) bool {
         x, y := sp.Pos()
         dx, dy := sp.Dims()
         if bx >= x && bx < x+dx && by >= y && by < y+dy {
+          hdt.pending = snapshotHouse(hdt.house)
           hdt.temp_relic = sp
           hdt.prev_relic = new(SpawnPoint)
           *hdt.prev_relic = *hdt.temp_relic
@@ -1214,8 +2118,21 @@ func (hdt *houseRelicsTab) Reload() {
   hdt.onEscape()
 }
 
-func (h *HouseDef) Save(path string) {
-  base.SaveJson(path, h)
+func (h *HouseDef) Save(path string) error {
+  return base.SaveObject(path, base.FormatOfPath(path), h)
+}
+
+// The format, "json" or "gob", that the editors save houses and rooms in.
+// Json is easier to work with, gob is smaller and faster to load.
+var Save_format = "json"
+
+// Where the editor saves a house, based on its name.
+func (h *HouseDef) savePath() string {
+  path := filepath.Join(datadir, "houses", h.Name+".house")
+  if Save_format == "gob" {
+    path += base.GobSuffix
+  }
+  return path
 }
 
 func LoadAllHousesInDir(dir string) {
@@ -1224,6 +2141,25 @@ func LoadAllHousesInDir(dir string) {
   base.RegisterAllObjectsInDir("houses", dir, ".house", "json")
 }
 
+// Removes any doors that aren't on one of the four walls of their room, these
+// can only come from a corrupt or hand-edited house.
+func (h *HouseDef) removeInvalidFacings() {
+  for _, floor := range h.Floors {
+    for _, room := range floor.Rooms {
+      var valid []*Door
+      for _, door := range room.Doors {
+        if !door.Facing.Valid() {
+          base.Error().Printf("Removed door '%s' with invalid facing %v from room '%s' in house '%s'.", door.Defname, door.Facing, room.Defname, h.Name)
+          continue
+        }
+        valid = append(valid, door)
+      }
+      room.Doors = valid
+      room.DoorsChanged()
+    }
+  }
+}
+
 func (h *HouseDef) setDoorsOpened(opened bool) {
   for _, floor := range h.Floors {
     for _, room := range floor.Rooms {
@@ -1243,16 +2179,20 @@ func MakeHouseFromName(name string) *HouseDef {
   var idiot iamanidiotcontainer
   idiot.Defname = name
   base.GetObject("houses", &idiot)
+  idiot.HouseDef.removeInvalidFacings()
+  idiot.HouseDef.cropResizedRooms()
   idiot.HouseDef.setDoorsOpened(false)
   return idiot.HouseDef
 }
 
 func MakeHouseFromPath(path string) (*HouseDef, error) {
   var house HouseDef
-  err := base.LoadAndProcessObject(path, "json", &house)
+  err := base.LoadAndProcessObject(path, base.FormatOfPath(path), &house)
   if err != nil {
     return nil, err
   }
+  house.removeInvalidFacings()
+  house.cropResizedRooms()
   house.Normalize()
   house.setDoorsOpened(false)
   return &house, nil
@@ -1261,20 +2201,43 @@ func MakeHouseFromPath(path string) (*HouseDef, error) {
 func MakeHouseEditorPanel() Editor {
   var he HouseEditor
   he.house = *MakeHouseDef()
+  he.key_map = base.GetDefaultKeyMap()
   he.HorizontalTable = gui.MakeHorizontalTable()
   he.viewer = MakeHouseViewer(&he.house, 62)
   he.viewer.Edit_mode = true
   he.HorizontalTable.AddChild(he.viewer)
 
-  he.widgets = append(he.widgets, makeHouseDataTab(&he.house, he.viewer))
-  he.widgets = append(he.widgets, makeHouseDoorTab(&he.house, he.viewer))
-  he.widgets = append(he.widgets, makeHouseRelicsTab(&he.house, he.viewer))
+  he.widgets = append(he.widgets, makeHouseDataTab(&he.house, he.viewer, &he.undo))
+  he.widgets = append(he.widgets, makeHouseDoorTab(&he.house, he.viewer, &he.undo))
+  he.widgets = append(he.widgets, makeHouseRelicsTab(&he.house, he.viewer, &he.undo))
   var tabs []gui.Widget
   for _, w := range he.widgets {
     tabs = append(tabs, w.(gui.Widget))
   }
   he.tab = gui.MakeTabFrame(tabs)
-  he.HorizontalTable.AddChild(he.tab)
+  he.minimap = MakeMiniMap(he.viewer, 300, 200)
+  // The save and load keys do the same thing as these, but load lets you pick
+  // any house rather than just going back to the saved copy of this one.
+  files := gui.MakeHorizontalTable()
+  files.AddChild(gui.MakeButton("standard", "Save", 150, 1, 1, 1, 1, func(int64) {
+    path, err := he.Save()
+    if err != nil {
+      base.Warn().Printf("Failed to save house to '%s': %v", path, err)
+      return
+    }
+    base.Log().Printf("Saved house to '%s'", path)
+  }))
+  files.AddChild(gui.MakeButton("standard", "Revert", 150, 1, 1, 1, 1, func(int64) {
+    path := he.house.savePath()
+    if err := he.Load(path); err != nil {
+      base.Warn().Printf("Failed to load house from '%s': %v", path, err)
+    }
+  }))
+  side := gui.MakeVerticalTable()
+  side.AddChild(he.minimap)
+  side.AddChild(files)
+  side.AddChild(he.tab)
+  he.HorizontalTable.AddChild(side)
 
   return &he
 }
@@ -1282,7 +2245,26 @@ func MakeHouseEditorPanel() Editor {
 // Manually pass all events to the tabs, regardless of location, since the tabs
 // need to know where the user clicks.
 func (he *HouseEditor) Respond(ui *gui.Gui, group gui.EventGroup) bool {
-  he.viewer.Respond(ui, group)
+  if he.viewer.Respond(ui, group) {
+    return true
+  }
+  if he.minimap.Respond(ui, group) {
+    return true
+  }
+  if found, event := group.FindEvent(he.key_map["undo"].Id()); found && event.Type == gin.Press {
+    he.widgets[he.tab.SelectedTab()].Reload()
+    if he.undo.Undo() {
+      he.viewer.SetBounds()
+    }
+    return true
+  }
+  if found, event := group.FindEvent(he.key_map["redo"].Id()); found && event.Type == gin.Press {
+    he.widgets[he.tab.SelectedTab()].Reload()
+    if he.undo.Redo() {
+      he.viewer.SetBounds()
+    }
+    return true
+  }
   return he.widgets[he.tab.SelectedTab()].Respond(ui, group)
 }
 
@@ -1294,6 +2276,7 @@ func (he *HouseEditor) Load(path string) error {
   base.Log().Printf("Loaded %s\n", path)
   house.Normalize()
   he.house = *house
+  he.undo.Clear()
   he.viewer.SetBounds()
   for _, tab := range he.widgets {
     tab.Reload()
@@ -1302,8 +2285,8 @@ func (he *HouseEditor) Load(path string) error {
 }
 
 func (he *HouseEditor) Save() (string, error) {
-  path := filepath.Join(datadir, "houses", he.house.Name+".house")
-  err := base.SaveJson(path, he.house)
+  path := he.house.savePath()
+  err := he.house.Save(path)
   return path, err
 }
 
@@ -1313,6 +2296,7 @@ func (he *HouseEditor) Reload() {
       base.GetObject("rooms", floor.Rooms[i])
     }
   }
+  he.house.cropResizedRooms()
   for _, tab := range he.widgets {
     tab.Reload()
   }
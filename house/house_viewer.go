@@ -47,6 +47,11 @@ type HouseViewer struct {
   temp_floor_drawers []FloorDrawer
   Edit_mode          bool
 
+  // If set this is used by measure mode to show how much it costs to move
+  // from x, y to x2, y2, it should return false if there is no path.
+  Measure_cost func(x, y, x2, y2 int) (int, bool)
+  measure      measureState
+
   bounds struct {
     on  bool
     min struct{ x, y float32 }
@@ -88,7 +93,7 @@ func MakeHouseViewer(house *HouseDef, angle float32) *HouseViewer {
 }
 
 func (hv *HouseViewer) Respond(g *gui.Gui, group gui.EventGroup) bool {
-  return false
+  return hv.respondMeasure(group)
 }
 
 func (hv *HouseViewer) Think(g *gui.Gui, t int64) {
@@ -249,6 +254,55 @@ func (hv *HouseViewer) FocusZoom(z float64) {
   hv.target_zoom_on = true
 }
 
+// Moves the camera so that the cell at x, y is in the center of the viewer.
+func (hv *HouseViewer) CenterOn(x, y int) {
+  hv.Focus(float64(x)+0.5, float64(y)+0.5)
+}
+
+// Returns true if the cell at x, y is drawn somewhere inside the viewer.
+func (hv *HouseViewer) OnScreen(x, y int) bool {
+  wx, wy := hv.BoardToWindow(float32(x)+0.5, float32(y)+0.5)
+  r := hv.Render_region
+  return wx >= r.X && wy >= r.Y && wx < r.X+r.Dx && wy < r.Y+r.Dy
+}
+
+// Moves and zooms the camera so that every room on the specified floor fits
+// in the viewer, as closely as the zoom limits allow.
+func (hv *HouseViewer) FrameFloor(floor int) {
+  if hv.house == nil || floor < 0 || floor >= len(hv.house.Floors) {
+    return
+  }
+  rooms := hv.house.Floors[floor].Rooms
+  if len(rooms) == 0 {
+    return
+  }
+  minx, miny := float32(rooms[0].X), float32(rooms[0].Y)
+  maxx, maxy := minx, miny
+  for _, room := range rooms {
+    minx = min32(minx, float32(room.X))
+    miny = min32(miny, float32(room.Y))
+    maxx = max32(maxx, float32(room.X+room.Size.Dx))
+    maxy = max32(maxy, float32(room.Y+room.Size.Dy))
+  }
+  hv.Focus(float64(minx+maxx)/2, float64(miny+maxy)/2)
+
+  // The floor is rotated 45 degrees, so a box of dx by dy cells is
+  // (dx+dy)/sqrt(2) cells across on screen, and is foreshortened vertically
+  // by the viewing angle.
+  r := hv.Render_region
+  if r.Dx <= 0 || r.Dy <= 0 {
+    return
+  }
+  across := float64(maxx-minx+maxy-miny) / math.Sqrt2
+  tall := across * math.Cos(float64(hv.angle)*math.Pi/180)
+  zoom := float64(r.Dx) / across
+  if tall > 0 && float64(r.Dy)/tall < zoom {
+    zoom = float64(r.Dy) / tall
+  }
+  hv.targetzoom = clamp(float32(math.Log(zoom)), 2.87130468509059, 4.25759904621048)
+  hv.target_zoom_on = true
+}
+
 func (hv *HouseViewer) String() string {
   return "house viewer"
 }
@@ -261,8 +315,23 @@ func roomOverlapOnce(a, b *Room) bool {
   return (x1in || x2in) && (y1in || y2in)
 }
 
+// Rooms overlap if there is a cell that is part of both of them, cells
+// missing from either room don't count.
 func roomOverlap(a, b *Room) bool {
-  return roomOverlapOnce(a, b) || roomOverlapOnce(b, a)
+  if !roomOverlapOnce(a, b) && !roomOverlapOnce(b, a) {
+    return false
+  }
+  if len(a.Missing_cells) == 0 && len(b.Missing_cells) == 0 {
+    return true
+  }
+  for x := a.X; x < a.X+a.Size.Dx; x++ {
+    for y := a.Y; y < a.Y+a.Size.Dy; y++ {
+      if a.HasCell(x-a.X, y-a.Y) && b.HasCell(x-b.X, y-b.Y) {
+        return true
+      }
+    }
+  }
+  return false
 }
 
 func (hv *HouseViewer) FindClosestDoorPos(door *Door, bx, by float32) *Room {
@@ -279,36 +348,42 @@ func (hv *HouseViewer) FindClosestDoorPos(door *Door, bx, by float32) *Room {
     }
     return n
   }
-  for _, room := range hv.house.Floors[current_floor].Rooms {
-    fl := math.Abs(float64(by) - float64(room.Y+room.Size.Dy))
-    fr := math.Abs(float64(bx) - float64(room.X+room.Size.Dx))
-    if bx < float32(room.X) {
-      fl += float64(room.X) - float64(bx)
-    }
-    if bx > float32(room.X+room.Size.Dx) {
-      fl += float64(bx) - float64(room.X+room.Size.Dx)
+  // How far v is outside of the range [lo, hi].
+  outside := func(v float32, lo, hi int) float64 {
+    if v < float32(lo) {
+      return float64(float32(lo) - v)
     }
-    if by < float32(room.Y) {
-      fr += float64(room.Y) - float64(by)
+    if v > float32(hi) {
+      return float64(v - float32(hi))
     }
-    if by > float32(room.Y+room.Size.Dy) {
-      fr += float64(by) - float64(room.Y+room.Size.Dy)
-    }
-    if best <= fl && best <= fr {
-      continue
-    }
-    best_room = room
-    switch {
-    case fl < fr:
-      best = fl
-      door.Facing = FarLeft
-      door.Pos = clamp_int(int(bx-float32(room.X)-float32(door.Width)/2), 0, room.Size.Dx-door.Width)
-
-      //      case fr < fl:  this case must be true, so we just call it default here
-    default:
-      best = fr
-      door.Facing = FarRight
-      door.Pos = clamp_int(int(by-float32(room.Y)-float32(door.Width)/2), 0, room.Size.Dy-door.Width)
+    return 0
+  }
+  // The far walls are checked first so that they win ties with the near wall
+  // of the room on the other side, which is where the same door would go.
+  for _, facing := range []WallFacing{FarLeft, FarRight, NearLeft, NearRight} {
+    for _, room := range hv.house.Floors[current_floor].Rooms {
+      var dist float64
+      switch facing {
+      case FarLeft:
+        dist = math.Abs(float64(by)-float64(room.Y+room.Size.Dy)) + outside(bx, room.X, room.X+room.Size.Dx)
+      case NearRight:
+        dist = math.Abs(float64(by)-float64(room.Y)) + outside(bx, room.X, room.X+room.Size.Dx)
+      case FarRight:
+        dist = math.Abs(float64(bx)-float64(room.X+room.Size.Dx)) + outside(by, room.Y, room.Y+room.Size.Dy)
+      case NearLeft:
+        dist = math.Abs(float64(bx)-float64(room.X)) + outside(by, room.Y, room.Y+room.Size.Dy)
+      }
+      if best <= dist {
+        continue
+      }
+      best = dist
+      best_room = room
+      door.Facing = facing
+      if facing == FarLeft || facing == NearRight {
+        door.Pos = clamp_int(int(bx-float32(room.X)-float32(door.Width)/2), 0, room.Size.Dx-door.Width)
+      } else {
+        door.Pos = clamp_int(int(by-float32(room.Y)-float32(door.Width)/2), 0, room.Size.Dy-door.Width)
+      }
     }
   }
   return best_room
@@ -370,4 +445,5 @@ func (hv *HouseViewer) Draw(region gui.Region) {
   }
 
   hv.house.Floors[0].render(region, hv.fx, hv.fy, hv.angle, hv.zoom, hv.drawables, hv.Los_tex, hv.temp_floor_drawers)
+  hv.drawMeasure()
 }
@@ -24,6 +24,10 @@ type LosTexture struct {
   // The texture needs to be created on the render thread, so we use this to
   // get the texture after it's been made.
   rec chan gl.Texture
+
+  // Headless textures only keep their pixels in memory, they never make any
+  // OpenGl calls.
+  headless bool
 }
 
 func losTextureFinalize(lt *LosTexture) {
@@ -60,6 +64,19 @@ func MakeLosTexture() *LosTexture {
   return &lt
 }
 
+// Creates a LosTexture that is never given to OpenGl, so it can be used
+// without a rendering context.  Remap and Bind do nothing on these.
+func MakeHeadlessLosTexture() *LosTexture {
+  var lt LosTexture
+  lt.headless = true
+  lt.pix = make([]byte, LosTextureSizeSquared)
+  lt.p2d = make([][]byte, LosTextureSize)
+  for i := 0; i < LosTextureSize; i++ {
+    lt.p2d[i] = lt.pix[i*LosTextureSize : (i+1)*LosTextureSize]
+  }
+  return &lt
+}
+
 // If the texture has been created this returns true, otherwise it checks for
 // the finished texture and returns true if it is available, false otherwise.
 func (lt *LosTexture) ready() bool {
@@ -77,7 +94,7 @@ func (lt *LosTexture) ready() bool {
 // Updates OpenGl with any changes that have been made to the texture.
 // OpenGl calls in this method are run on the render thread
 func (lt *LosTexture) Remap() {
-  if !lt.ready() {
+  if lt.headless || !lt.ready() {
     return
   }
   render.Queue(func() {
@@ -89,6 +106,9 @@ func (lt *LosTexture) Remap() {
 
 // Binds the texture, not run on the render thread
 func (lt *LosTexture) Bind() {
+  if lt.headless {
+    return
+  }
   lt.ready()
   lt.tex.Bind(gl.TEXTURE_2D)
 }
@@ -105,6 +125,27 @@ func (lt *LosTexture) Size() int {
   return len(lt.p2d)
 }
 
+func (lt *LosTexture) Headless() bool {
+  return lt.headless
+}
+
+// Returns the value of the pixel at x, y, or LosMinVisibility if it is
+// outside of the texture, since nothing out there can be seen.
+func (lt *LosTexture) Get(x, y int) byte {
+  if x < 0 || y < 0 || x >= len(lt.p2d) || y >= len(lt.p2d) {
+    return LosMinVisibility
+  }
+  return lt.p2d[x][y]
+}
+
+// Sets the pixel at x, y to v, does nothing if it is outside of the texture.
+func (lt *LosTexture) Set(x, y int, v byte) {
+  if x < 0 || y < 0 || x >= len(lt.p2d) || y >= len(lt.p2d) {
+    return
+  }
+  lt.p2d[x][y] = v
+}
+
 // Returns a convenient 2d slice over the texture
 func (lt *LosTexture) Pix() [][]byte {
   return lt.p2d
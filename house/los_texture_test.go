@@ -0,0 +1,31 @@
+package house_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/runningwild/haunts/house"
+)
+
+func LosTextureSpec(c gospec.Context) {
+  lt := house.MakeHeadlessLosTexture()
+
+  c.Specify("Headless textures keep their pixels without OpenGl.", func() {
+    c.Expect(lt.Headless(), Equals, true)
+    c.Expect(lt.Size(), Equals, house.LosTextureSize)
+    lt.Set(3, 4, 200)
+    lt.Remap()
+    c.Expect(lt.Get(3, 4), Equals, byte(200))
+    c.Expect(lt.Pix()[3][4], Equals, byte(200))
+    c.Expect(lt.Get(4, 3), Equals, byte(0))
+    lt.Clear(7)
+    c.Expect(lt.Get(3, 4), Equals, byte(7))
+  })
+
+  c.Specify("Pixels outside of the texture are ignored.", func() {
+    lt.Set(-1, 0, 100)
+    lt.Set(0, house.LosTextureSize, 100)
+    c.Expect(lt.Get(-1, 0), Equals, byte(house.LosMinVisibility))
+    c.Expect(lt.Get(0, house.LosTextureSize), Equals, byte(house.LosMinVisibility))
+    c.Expect(lt.Get(house.LosTextureSize, -5), Equals, byte(house.LosMinVisibility))
+  })
+}
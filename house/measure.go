@@ -0,0 +1,84 @@
+package house
+
+import (
+  "fmt"
+  gl "github.com/chsc/gogl/gl21"
+  "github.com/runningwild/glop/gin"
+  "github.com/runningwild/glop/gui"
+  "github.com/runningwild/haunts/base"
+  "math"
+)
+
+// While measuring, clicking on a cell makes it the start point and the
+// distance from there to whatever cell the mouse is over is drawn on the
+// viewer.
+type measureState struct {
+  on      bool
+  started bool
+  sx, sy  int
+
+  // The label is only recomputed when the hovered cell changes since the
+  // cost might require pathing.
+  hx, hy int
+  label  string
+}
+
+// Returns the cell under the mouse.
+func (hv *HouseViewer) cursorCell() (int, int) {
+  bx, by := hv.WindowToBoard(gin.In().GetCursor("Mouse").Point())
+  return int(math.Floor(float64(bx))), int(math.Floor(float64(by)))
+}
+
+// Handles toggling measure mode and picking the start point.
+func (hv *HouseViewer) respondMeasure(group gui.EventGroup) bool {
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["measure"].Id()); found && event.Type == gin.Press {
+    hv.measure = measureState{on: !hv.measure.on}
+    return true
+  }
+  if !hv.measure.on {
+    return false
+  }
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["place"].Id()); found && event.Type == gin.Press {
+    hv.measure.sx, hv.measure.sy = hv.cursorCell()
+    hv.measure.started = true
+    hv.measure.label = ""
+    return true
+  }
+  return false
+}
+
+func (hv *HouseViewer) measureLabel(x, y int) string {
+  dx := math.Abs(float64(x - hv.measure.sx))
+  dy := math.Abs(float64(y - hv.measure.sy))
+  label := fmt.Sprintf("%d cells (%.1f)", int(math.Max(dx, dy)), math.Sqrt(dx*dx+dy*dy))
+  if hv.Measure_cost != nil {
+    if cost, ok := hv.Measure_cost(hv.measure.sx, hv.measure.sy, x, y); ok {
+      label += fmt.Sprintf(", %d to move", cost)
+    } else {
+      label += ", no path"
+    }
+  }
+  return label
+}
+
+func (hv *HouseViewer) drawMeasure() {
+  if !hv.measure.on || !hv.measure.started {
+    return
+  }
+  x, y := hv.cursorCell()
+  if hv.measure.label == "" || x != hv.measure.hx || y != hv.measure.hy {
+    hv.measure.hx, hv.measure.hy = x, y
+    hv.measure.label = hv.measureLabel(x, y)
+  }
+  sx, sy := hv.BoardToWindow(float32(hv.measure.sx)+0.5, float32(hv.measure.sy)+0.5)
+  ex, ey := hv.BoardToWindow(float32(x)+0.5, float32(y)+0.5)
+  gl.Disable(gl.TEXTURE_2D)
+  palette.Measure.Set()
+  gl.Begin(gl.LINES)
+  gl.Vertex2i(int32(sx), int32(sy))
+  gl.Vertex2i(int32(ex), int32(ey))
+  gl.End()
+  gl.Enable(gl.TEXTURE_2D)
+  d := base.GetDictionary(15)
+  d.RenderString(hv.measure.label, float64(ex), float64(ey), 0, d.MaxHeight(), gui.Left)
+}
@@ -0,0 +1,135 @@
+package house
+
+import (
+  gl "github.com/chsc/gogl/gl21"
+  "github.com/runningwild/glop/gin"
+  "github.com/runningwild/glop/gui"
+  "github.com/runningwild/haunts/base"
+  "math"
+)
+
+// Number of pixels per cell on the minimap.
+const miniMapScale = 3
+
+// A top-down overview of the floor shown by a HouseViewer.  Each room is a
+// filled rectangle, the part of the floor that the viewer is showing is
+// outlined, and clicking on the minimap moves the viewer there.
+type MiniMap struct {
+  gui.Childless
+  gui.BasicZone
+  gui.NonFocuser
+
+  viewer *HouseViewer
+
+  // Center of the floor, in board coordinates, as of the last Draw.
+  cx, cy float32
+}
+
+func MakeMiniMap(viewer *HouseViewer, dx, dy int) *MiniMap {
+  var mm MiniMap
+  mm.Request_dims = gui.Dims{dx, dy}
+  mm.viewer = viewer
+  return &mm
+}
+
+func (mm *MiniMap) String() string {
+  return "mini map"
+}
+
+func (mm *MiniMap) Think(g *gui.Gui, t int64) {}
+
+func (mm *MiniMap) boardToWindow(bx, by float32) (float32, float32) {
+  r := mm.Render_region
+  x := float32(r.X) + float32(r.Dx)/2 + (bx-mm.cx)*miniMapScale
+  y := float32(r.Y) + float32(r.Dy)/2 + (by-mm.cy)*miniMapScale
+  return x, y
+}
+
+func (mm *MiniMap) windowToBoard(wx, wy int) (float32, float32) {
+  r := mm.Render_region
+  bx := (float32(wx)-float32(r.X)-float32(r.Dx)/2)/miniMapScale + mm.cx
+  by := (float32(wy)-float32(r.Y)-float32(r.Dy)/2)/miniMapScale + mm.cy
+  return bx, by
+}
+
+func (mm *MiniMap) Respond(g *gui.Gui, group gui.EventGroup) bool {
+  found, event := group.FindEvent(base.GetDefaultKeyMap()["place"].Id())
+  if !found || event.Type != gin.Press {
+    return false
+  }
+  x, y := gin.In().GetCursor("Mouse").Point()
+  r := mm.Render_region
+  if x < r.X || y < r.Y || x >= r.X+r.Dx || y >= r.Y+r.Dy {
+    return false
+  }
+  bx, by := mm.windowToBoard(x, y)
+  mm.viewer.CenterOn(int(math.Floor(float64(bx))), int(math.Floor(float64(by))))
+  return true
+}
+
+func (mm *MiniMap) Draw(region gui.Region) {
+  mm.Render_region = region
+  region.PushClipPlanes()
+  defer region.PopClipPlanes()
+
+  gl.Disable(gl.TEXTURE_2D)
+  palette.Minimap_background.Set()
+  gl.Begin(gl.QUADS)
+  gl.Vertex2i(int32(region.X), int32(region.Y))
+  gl.Vertex2i(int32(region.X), int32(region.Y+region.Dy))
+  gl.Vertex2i(int32(region.X+region.Dx), int32(region.Y+region.Dy))
+  gl.Vertex2i(int32(region.X+region.Dx), int32(region.Y))
+  gl.End()
+
+  if mm.viewer.house == nil || len(mm.viewer.house.Floors) == 0 {
+    gl.Enable(gl.TEXTURE_2D)
+    return
+  }
+  rooms := mm.viewer.house.Floors[0].Rooms
+  if len(rooms) > 0 {
+    minx, miny := float32(rooms[0].X), float32(rooms[0].Y)
+    maxx, maxy := minx, miny
+    for _, room := range rooms {
+      minx = min32(minx, float32(room.X))
+      miny = min32(miny, float32(room.Y))
+      maxx = max32(maxx, float32(room.X+room.Size.Dx))
+      maxy = max32(maxy, float32(room.Y+room.Size.Dy))
+    }
+    mm.cx, mm.cy = (minx+maxx)/2, (miny+maxy)/2
+  }
+
+  gl.Begin(gl.QUADS)
+  for _, room := range rooms {
+    if room.temporary && room.invalid {
+      palette.Placing_invalid.Set()
+    } else if room.temporary {
+      palette.Placing.Set()
+    } else if room.conflict {
+      palette.Conflict.Set()
+    } else {
+      palette.Minimap_room.Set()
+    }
+    x, y := mm.boardToWindow(float32(room.X), float32(room.Y))
+    x2, y2 := mm.boardToWindow(float32(room.X+room.Size.Dx), float32(room.Y+room.Size.Dy))
+    // Leave a gap between rooms so that they can be told apart
+    gl.Vertex2f(x+1, y+1)
+    gl.Vertex2f(x+1, y2)
+    gl.Vertex2f(x2, y2)
+    gl.Vertex2f(x2, y+1)
+  }
+  gl.End()
+
+  // The viewer's region might not be a rectangle in board coordinates, so
+  // outline whatever shape its corners make.
+  vr := mm.viewer.Render_region
+  if vr.Dx > 0 && vr.Dy > 0 {
+    palette.Minimap_view.Set()
+    gl.Begin(gl.LINE_LOOP)
+    for _, c := range [][2]int{{vr.X, vr.Y}, {vr.X, vr.Y + vr.Dy}, {vr.X + vr.Dx, vr.Y + vr.Dy}, {vr.X + vr.Dx, vr.Y}} {
+      bx, by := mm.viewer.WindowToBoard(c[0], c[1])
+      gl.Vertex2f(mm.boardToWindow(bx, by))
+    }
+    gl.End()
+  }
+  gl.Enable(gl.TEXTURE_2D)
+}
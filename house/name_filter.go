@@ -0,0 +1,103 @@
+package house
+
+import (
+  "github.com/runningwild/glop/gui"
+  "sort"
+  "strings"
+)
+
+// A scrolling list of buttons, one for each name, with a text box above it
+// that hides every button whose name doesn't contain the text typed into it.
+// Names are grouped under a heading for their category, if they have one.
+type nameFilter struct {
+  *gui.VerticalTable
+
+  filter  *gui.TextEditLine
+  buttons *gui.VerticalTable
+
+  // Names sorted by category and then by name, and the widgets that go with
+  // them.
+  names      []string
+  categories map[string]string
+  widgets    map[string]gui.Widget
+
+  // Filter text that the buttons are currently showing, and what is shown.
+  shown   string
+  showing []gui.Widget
+}
+
+type byCategory struct {
+  names      []string
+  categories map[string]string
+}
+
+func (b byCategory) Len() int {
+  return len(b.names)
+}
+func (b byCategory) Less(i, j int) bool {
+  ci, cj := b.categories[b.names[i]], b.categories[b.names[j]]
+  if ci != cj {
+    return ci < cj
+  }
+  return b.names[i] < b.names[j]
+}
+func (b byCategory) Swap(i, j int) {
+  b.names[i], b.names[j] = b.names[j], b.names[i]
+}
+
+// category returns the category of each name, click is called with the name
+// of whichever button was clicked.
+func makeNameFilter(names []string, category func(name string) string, click func(name string)) *nameFilter {
+  var nf nameFilter
+  nf.VerticalTable = gui.MakeVerticalTable()
+  nf.filter = gui.MakeTextEditLine("standard", "", 300, 1, 1, 1, 1)
+  nf.buttons = gui.MakeVerticalTable()
+  nf.categories = make(map[string]string)
+  nf.widgets = make(map[string]gui.Widget)
+  for _, name := range names {
+    n := name
+    nf.names = append(nf.names, n)
+    nf.categories[n] = category(n)
+    nf.widgets[n] = gui.MakeButton("standard", n, 300, 1, 1, 1, 1, func(int64) {
+      click(n)
+    })
+  }
+  sort.Sort(byCategory{nf.names, nf.categories})
+
+  nf.VerticalTable.AddChild(gui.MakeTextLine("standard", "Filter", 300, 1, 1, 1, 1))
+  nf.VerticalTable.AddChild(nf.filter)
+  nf.VerticalTable.AddChild(gui.MakeScrollFrame(nf.buttons, 300, 600))
+  nf.show("")
+  return &nf
+}
+
+// Rebuilds the list of buttons if the filter text has changed.  This should
+// be called from the Think of whatever contains the filter.
+func (nf *nameFilter) update() {
+  if text := nf.filter.GetText(); text != nf.shown {
+    nf.show(text)
+  }
+}
+
+func (nf *nameFilter) show(text string) {
+  for _, w := range nf.showing {
+    nf.buttons.RemoveChild(w)
+  }
+  nf.showing = nf.showing[0:0]
+  nf.shown = text
+  text = strings.ToLower(text)
+  category := ""
+  for _, name := range nf.names {
+    if !strings.Contains(strings.ToLower(name), text) {
+      continue
+    }
+    if c := nf.categories[name]; c != category {
+      category = c
+      nf.showing = append(nf.showing, gui.MakeTextLine("standard", c, 300, 0.7, 0.7, 1, 1))
+    }
+    nf.showing = append(nf.showing, nf.widgets[name])
+  }
+  for _, w := range nf.showing {
+    nf.buttons.AddChild(w)
+  }
+}
@@ -0,0 +1,303 @@
+package house
+
+import (
+  gl "github.com/chsc/gogl/gl21"
+  "github.com/runningwild/haunts/base"
+)
+
+// The part of a room's def that a resized room covers, in the def's own
+// cell coordinates.  X and Y are negative if the room was grown past its
+// near walls.
+type RoomBounds struct {
+  X, Y   int
+  Dx, Dy int
+}
+
+// Returns a copy of room with its origin moved to b.X, b.Y and its size
+// changed to b.Dx, b.Dy.  Anything that no longer fits in the room is left
+// out.
+func (room *roomDef) cropped(b RoomBounds) *roomDef {
+  def := room.copyDef()
+  room.cropInto(def, b)
+  return def
+}
+
+// Sets up dst as room cropped to b.  dst should have been made with
+// room.copyDef() so that its wall textures can be reused, this way the room
+// doesn't make new gl buffers for them every time it is cropped.
+func (room *roomDef) cropInto(dst *roomDef, b RoomBounds) {
+  dst.Move_costs = nil
+  for _, mc := range room.Move_costs {
+    mc.X -= b.X
+    mc.Y -= b.Y
+    dst.Move_costs = append(dst.Move_costs, mc)
+  }
+  dst.Floor_tiles = nil
+  for _, ft := range room.Floor_tiles {
+    ft.X -= b.X
+    ft.Y -= b.Y
+    dst.Floor_tiles = append(dst.Floor_tiles, ft)
+  }
+  dst.No_door_cells = nil
+  for _, cell := range room.No_door_cells {
+    dst.No_door_cells = append(dst.No_door_cells, RoomCell{cell.X - b.X, cell.Y - b.Y})
+  }
+  dst.Missing_cells = nil
+  for _, cell := range room.Missing_cells {
+    dst.Missing_cells = append(dst.Missing_cells, RoomCell{cell.X - b.X, cell.Y - b.Y})
+  }
+  size := room.Size
+  size.Dx = b.Dx
+  size.Dy = b.Dy
+  dst.Resize(size)
+
+  dst.Furniture = nil
+  for _, f := range room.Furniture {
+    fc := *f
+    fc.X -= b.X
+    fc.Y -= b.Y
+    dx, dy := fc.Dims()
+    if fc.X < 0 || fc.Y < 0 || fc.X+dx > b.Dx || fc.Y+dy > b.Dy {
+      continue
+    }
+    dst.Furniture = append(dst.Furniture, &fc)
+  }
+
+  if len(dst.WallTextures) != len(room.WallTextures) {
+    dst.WallTextures = nil
+    for _, wt := range room.WallTextures {
+      wtc := *wt
+      dst.WallTextures = append(dst.WallTextures, &wtc)
+    }
+  }
+  for i, wt := range room.WallTextures {
+    *dst.WallTextures[i] = *wt
+    // Textures on the far walls stay on those walls as they move
+    if wt.X >= float32(room.Size.Dx) {
+      dst.WallTextures[i].X += float32(b.Dx - room.Size.Dx)
+    } else {
+      dst.WallTextures[i].X -= float32(b.X)
+    }
+    if wt.Y >= float32(room.Size.Dy) {
+      dst.WallTextures[i].Y += float32(b.Dy - room.Size.Dy)
+    } else {
+      dst.WallTextures[i].Y -= float32(b.Y)
+    }
+  }
+}
+
+// Returns true if door is on a wall of a room of size dx by dy.
+func doorFits(door *Door, dx, dy int) bool {
+  if door.Pos < 0 {
+    return false
+  }
+  if door.Facing == FarLeft || door.Facing == NearRight {
+    return door.Pos+door.Width <= dx
+  }
+  return door.Pos+door.Width <= dy
+}
+
+// Gives every room that was resized in the editor its own copy of its def,
+// cropped to the room's bounds.  The def is always reloaded from the registry
+// first, so this is safe to call more than once.
+func (h *HouseDef) cropResizedRooms() {
+  for _, floor := range h.Floors {
+    for _, room := range floor.Rooms {
+      if room.Bounds != nil {
+        base.GetObject("rooms", room)
+        room.roomDef = room.roomDef.cropped(*room.Bounds)
+      }
+    }
+  }
+}
+
+// Which edges of a room are being dragged when resizing it in the editor.
+type roomEdges int
+
+const (
+  edgeNearLeft roomEdges = 1 << iota
+  edgeNearRight
+  edgeFarLeft
+  edgeFarRight
+)
+
+// How close, in board coordinates, the cursor must be to the edge of a room
+// to grab it.
+const resizeGrabDist = 0.4
+
+// Rooms can't be resized to less than this many cells along either axis.
+const minRoomSize = 2
+
+// Returns the edges of room that are close enough to bx, by to grab.
+func roomEdgesAt(room *Room, bx, by float32) roomEdges {
+  x, y := float32(room.X), float32(room.Y)
+  x2, y2 := x+float32(room.Size.Dx), y+float32(room.Size.Dy)
+  if bx < x-resizeGrabDist || bx > x2+resizeGrabDist || by < y-resizeGrabDist || by > y2+resizeGrabDist {
+    return 0
+  }
+  var edges roomEdges
+  if bx-x < resizeGrabDist && x-bx < resizeGrabDist {
+    edges |= edgeNearLeft
+  } else if bx-x2 < resizeGrabDist && x2-bx < resizeGrabDist {
+    edges |= edgeFarRight
+  }
+  if by-y < resizeGrabDist && y-by < resizeGrabDist {
+    edges |= edgeNearRight
+  } else if by-y2 < resizeGrabDist && y2-by < resizeGrabDist {
+    edges |= edgeFarLeft
+  }
+  return edges
+}
+
+// A room that is being resized in the editor, along with everything needed
+// to put it back the way it was.
+type roomResize struct {
+  room  *Room
+  edges roomEdges
+
+  def         *roomDef
+  work        *roomDef
+  prev_bounds *RoomBounds
+  bounds      RoomBounds
+  x, y        int
+  doors       []*Door
+  pos         []int
+}
+
+func startRoomResize(room *Room, edges roomEdges) *roomResize {
+  rr := &roomResize{room: room, edges: edges, def: room.roomDef, prev_bounds: room.Bounds, x: room.X, y: room.Y}
+  rr.work = room.roomDef.copyDef()
+  if room.Bounds != nil {
+    rr.bounds = *room.Bounds
+  } else {
+    rr.bounds = RoomBounds{0, 0, room.Size.Dx, room.Size.Dy}
+  }
+  rr.doors = append(rr.doors, room.Doors...)
+  for _, door := range room.Doors {
+    rr.pos = append(rr.pos, door.Pos)
+  }
+  room.roomDef = rr.work
+  room.temporary = true
+  return rr
+}
+
+// Moves the edges being dragged as close to bx, by as possible.
+func (rr *roomResize) update(bx, by float32) {
+  x, y := rr.x, rr.y
+  x2, y2 := rr.x+rr.def.Size.Dx, rr.y+rr.def.Size.Dy
+  if rr.edges&edgeNearLeft != 0 {
+    x = roundDown(bx + 0.5)
+    if x > x2-minRoomSize {
+      x = x2 - minRoomSize
+    }
+  }
+  if rr.edges&edgeFarRight != 0 {
+    x2 = roundDown(bx + 0.5)
+    if x2 < x+minRoomSize {
+      x2 = x + minRoomSize
+    }
+  }
+  if rr.edges&edgeNearRight != 0 {
+    y = roundDown(by + 0.5)
+    if y > y2-minRoomSize {
+      y = y2 - minRoomSize
+    }
+  }
+  if rr.edges&edgeFarLeft != 0 {
+    y2 = roundDown(by + 0.5)
+    if y2 < y+minRoomSize {
+      y2 = y + minRoomSize
+    }
+  }
+  room := rr.room
+  if x == room.X && y == room.Y && x2-x == room.Size.Dx && y2-y == room.Size.Dy {
+    return
+  }
+
+  ox, oy := x-rr.x, y-rr.y
+  rr.def.cropInto(rr.work, RoomBounds{ox, oy, x2 - x, y2 - y})
+  room.X, room.Y = x, y
+  room.Bounds = &RoomBounds{rr.bounds.X + ox, rr.bounds.Y + oy, x2 - x, y2 - y}
+  room.Doors = nil
+  for i, door := range rr.doors {
+    door.Pos = rr.pos[i]
+    if door.Facing == FarLeft || door.Facing == NearRight {
+      door.Pos -= ox
+    } else {
+      door.Pos -= oy
+    }
+    if doorFits(door, room.Size.Dx, room.Size.Dy) {
+      room.Doors = append(room.Doors, door)
+    }
+  }
+  room.DoorsChanged()
+}
+
+// Puts the room back the way it was before it was resized.
+func (rr *roomResize) cancel() {
+  room := rr.room
+  room.roomDef = rr.def
+  room.X, room.Y = rr.x, rr.y
+  room.Bounds = rr.prev_bounds
+  room.Doors = nil
+  for i, door := range rr.doors {
+    door.Pos = rr.pos[i]
+    room.Doors = append(room.Doors, door)
+  }
+  room.DoorsChanged()
+  room.temporary = false
+  room.invalid = false
+}
+
+// Draws the edges of a room that can be grabbed to resize it.
+type roomHandles struct {
+  room  *Room
+  edges roomEdges
+}
+
+func (rh *roomHandles) Pos() (int, int) {
+  if rh.room == nil {
+    return 0, 0
+  }
+  return rh.room.X, rh.room.Y
+}
+
+func (rh *roomHandles) Dims() (int, int) {
+  if rh.room == nil {
+    return 0, 0
+  }
+  return rh.room.Size.Dx, rh.room.Size.Dy
+}
+
+func (rh *roomHandles) RenderOnFloor() {
+  if rh.room == nil {
+    return
+  }
+  x, y := float32(rh.room.X), float32(rh.room.Y)
+  x2, y2 := x+float32(rh.room.Size.Dx), y+float32(rh.room.Size.Dy)
+  const w = 0.25
+  edges := []struct {
+    edge         roomEdges
+    x, y, x2, y2 float32
+  }{
+    {edgeNearLeft, x, y, x + w, y2},
+    {edgeFarRight, x2 - w, y, x2, y2},
+    {edgeNearRight, x, y, x2, y + w},
+    {edgeFarLeft, x, y2 - w, x2, y2},
+  }
+  gl.Disable(gl.TEXTURE_2D)
+  gl.Begin(gl.QUADS)
+  for _, e := range edges {
+    if rh.edges&e.edge != 0 {
+      palette.Handle_grabbed.Set()
+    } else {
+      palette.Handle.Set()
+    }
+    gl.Vertex2f(e.x, e.y)
+    gl.Vertex2f(e.x, e.y2)
+    gl.Vertex2f(e.x2, e.y2)
+    gl.Vertex2f(e.x2, e.y)
+  }
+  gl.End()
+  gl.Enable(gl.TEXTURE_2D)
+}
@@ -3,6 +3,7 @@ package house
 import (
   "fmt"
   gl "github.com/chsc/gogl/gl21"
+  "github.com/runningwild/glop/gin"
   "github.com/runningwild/glop/gui"
   "github.com/runningwild/haunts/base"
   "github.com/runningwild/haunts/texture"
@@ -66,6 +67,9 @@ type roomDef struct {
   Name string
   Size RoomSize
 
+  // Groups this room with others in the editor's list of rooms
+  Category string
+
   Furniture []*Furniture `registry:"loadfrom-furniture"`
 
   WallTextures []*WallTexture `registry:"loadfrom-wall_textures"`
@@ -81,6 +85,132 @@ type roomDef struct {
 
   // What kinds of decorations are appropriate in this room
   Decor map[string]bool
+
+  // Cells that cost more (or less) than normal to move into.  Any cell not
+  // listed here has a cost of 1.
+  Move_costs []MoveCost
+
+  // Cells that are drawn with their own texture rather than the floor's
+  Floor_tiles []FloorTile
+
+  // Cells along the walls that doors cannot be placed on.  Doors can be
+  // placed on any wall cell not listed here.
+  No_door_cells []RoomCell
+
+  // Height of the walls, in cells.  If this is 0 the walls are as tall as
+  // they need to be to show the wall texture once without stretching it.
+  Wall_height int
+
+  // Cells in this room are never less visible than this to either side, even
+  // if nothing can see them.  At LosVisibilityThreshold or above the room is
+  // always fully visible, 0 leaves the room's visibility entirely up to los.
+  Ambient_light byte
+
+  // Cells within the room's bounds that aren't actually part of the room.
+  // This lets rooms have shapes other than rectangles, other rooms may be
+  // placed in these cells.
+  Missing_cells []RoomCell
+
+  // Textures to use in place of Floor and Wall when this room is on a floor
+  // with the given theme.  Either texture can be left empty to use the
+  // default one.
+  Theme_textures map[string]*ThemeTextures
+}
+
+type ThemeTextures struct {
+  Floor texture.Object
+  Wall  texture.Object
+}
+
+type RoomCell struct {
+  X, Y int
+}
+
+type FloorTile struct {
+  X, Y    int
+  Texture texture.Object `registry:"autoload"`
+}
+
+func (room *roomDef) isWallCell(x, y int) bool {
+  if x < 0 || y < 0 || x >= room.Size.Dx || y >= room.Size.Dy {
+    return false
+  }
+  return x == 0 || y == 0 || x == room.Size.Dx-1 || y == room.Size.Dy-1
+}
+
+// Returns true if a door may be placed against the cell at x, y, given in
+// room coordinates.
+func (room *roomDef) CanHaveDoor(x, y int) bool {
+  for _, cell := range room.No_door_cells {
+    if cell.X == x && cell.Y == y {
+      return false
+    }
+  }
+  return true
+}
+
+func (room *roomDef) SetCanHaveDoor(x, y int, can bool) {
+  for i, cell := range room.No_door_cells {
+    if cell.X == x && cell.Y == y {
+      if can {
+        room.No_door_cells = append(room.No_door_cells[:i], room.No_door_cells[i+1:]...)
+      }
+      return
+    }
+  }
+  if !can {
+    room.No_door_cells = append(room.No_door_cells, RoomCell{x, y})
+  }
+}
+
+// Returns true if the room has no cells because one of its dimensions isn't
+// positive.  Only a malformed def can be like this.
+func (room *roomDef) Degenerate() bool {
+  return room.Size.Dx <= 0 || room.Size.Dy <= 0
+}
+
+// Called by the registry when a room def is loaded, a room that can't have
+// any cells would otherwise break rendering and pathing.
+func (room *roomDef) Validate() error {
+  if room.Degenerate() {
+    return fmt.Errorf("Room '%s' has invalid dimensions %dx%d", room.Name, room.Size.Dx, room.Size.Dy)
+  }
+  return nil
+}
+
+// Returns true if the cell at x, y, given in room coordinates, is part of
+// the room.
+func (room *roomDef) HasCell(x, y int) bool {
+  if !room.inBounds(x, y) {
+    return false
+  }
+  for _, cell := range room.Missing_cells {
+    if cell.X == x && cell.Y == y {
+      return false
+    }
+  }
+  return true
+}
+
+func (room *roomDef) SetHasCell(x, y int, has bool) {
+  for i, cell := range room.Missing_cells {
+    if cell.X == x && cell.Y == y {
+      if has {
+        room.Missing_cells = append(room.Missing_cells[:i], room.Missing_cells[i+1:]...)
+      }
+      return
+    }
+  }
+  if !has && room.inBounds(x, y) {
+    room.Missing_cells = append(room.Missing_cells, RoomCell{x, y})
+  }
+}
+
+// Multiplier on the cost of moving into the cell at X, Y, given in room
+// coordinates.
+type MoveCost struct {
+  X, Y int
+  Cost float64
 }
 
 type roomVertex struct {
@@ -93,6 +223,7 @@ type roomVertex struct {
 
 type plane struct {
   index_buffer uint32
+  count        int
   texture      texture.Object
   mat          *mathgl.Mat4
 }
@@ -136,15 +267,38 @@ func visibilityOfObject(xoff, yoff int, ro RectObject, los_tex *LosTexture) byte
   return byte(v)
 }
 
-func (room *Room) renderFurniture(floor mathgl.Mat4, base_alpha byte, drawables []Drawable, los_tex *LosTexture) {
-  board_to_window := func(mx, my float32) (x, y float32) {
-    v := mathgl.Vec4{X: mx, Y: my, W: 1}
-    v.Transform(&floor)
-    x, y = v.X, v.Y
-    return
+type orderKey struct {
+  obj          RectObject
+  x, y, dx, dy int
+}
+
+// Orders the objects in the room, reusing the order from the last call if
+// none of the objects have been added, removed, or moved since then.
+func (room *Room) orderObjects(all []RectObject) []RectObject {
+  cache := &room.order_cache
+  clean := len(all) == len(cache.keys)
+  for i := 0; clean && i < len(all); i++ {
+    x, y := all[i].Pos()
+    dx, dy := all[i].Dims()
+    clean = cache.keys[i] == orderKey{all[i], x, y, dx, dy}
+  }
+  if clean {
+    return cache.ordered
+  }
+  cache.keys = cache.keys[0:0]
+  for _, obj := range all {
+    x, y := obj.Pos()
+    dx, dy := obj.Dims()
+    cache.keys = append(cache.keys, orderKey{obj, x, y, dx, dy})
   }
+  cache.ordered = OrderRectObjects(all)
+  return cache.ordered
+}
 
-  var all []RectObject
+// Returns the drawables that are in this room, offset so that they are in
+// room coordinates.
+func (room *Room) drawablesInRoom(drawables []Drawable) []Drawable {
+  var in []Drawable
   for _, d := range drawables {
     x, y := d.Pos()
     if x < room.X {
@@ -159,7 +313,59 @@ func (room *Room) renderFurniture(floor mathgl.Mat4, base_alpha byte, drawables
     if y >= room.Y+room.Size.Dy {
       continue
     }
-    all = append(all, offsetDrawable{d, -room.X, -room.Y})
+    in = append(in, offsetDrawable{d, -room.X, -room.Y})
+  }
+  return in
+}
+
+// How dark shadows are, and how far they are pushed towards the far walls.
+const (
+  shadowAlpha  = 96
+  shadowOffset = 0.15
+)
+
+// Darkens the floor under every upright piece of furniture and every
+// drawable in the room so that they look like they are standing on it.  This
+// is drawn before any of them, so a shadow never covers an object.
+func (room *Room) renderShadows(drawables []Drawable, los_tex *LosTexture) {
+  var objs []Drawable
+  for _, f := range room.Furniture {
+    if !f.temporary && f.BlocksMove() {
+      objs = append(objs, f)
+    }
+  }
+  objs = append(objs, room.drawablesInRoom(drawables)...)
+  if len(objs) == 0 {
+    return
+  }
+  gl.Disable(gl.TEXTURE_2D)
+  gl.Begin(gl.QUADS)
+  for _, d := range objs {
+    gl.Color4ub(0, 0, 0, alphaMult(shadowAlpha, visibilityOfObject(room.X, room.Y, d, los_tex)))
+    fx, fy := d.FPos()
+    idx, idy := d.Dims()
+    x, y := float32(fx)+shadowOffset, float32(fy)+shadowOffset
+    dx, dy := float32(idx), float32(idy)
+    gl.Vertex2f(x, y)
+    gl.Vertex2f(x, y+dy)
+    gl.Vertex2f(x+dx, y+dy)
+    gl.Vertex2f(x+dx, y)
+  }
+  gl.End()
+  gl.Enable(gl.TEXTURE_2D)
+}
+
+func (room *Room) renderFurniture(floor mathgl.Mat4, base_alpha byte, drawables []Drawable, los_tex *LosTexture) {
+  board_to_window := func(mx, my float32) (x, y float32) {
+    v := mathgl.Vec4{X: mx, Y: my, W: 1}
+    v.Transform(&floor)
+    x, y = v.X, v.Y
+    return
+  }
+
+  var all []RectObject
+  for _, d := range room.drawablesInRoom(drawables) {
+    all = append(all, d)
   }
 
   // Do not include temporary objects in the ordering, since they will likely
@@ -173,7 +379,7 @@ func (room *Room) renderFurniture(floor mathgl.Mat4, base_alpha byte, drawables
       all = append(all, f)
     }
   }
-  all = OrderRectObjects(all)
+  all = room.orderObjects(all)
   for i := range all {
     temps = append(temps, all[i])
   }
@@ -246,6 +452,10 @@ func (room *Room) getMaxLosAlpha(los_tex *LosTexture) byte {
       }
     }
   }
+  if max_room_alpha < LosMinVisibility {
+    // The game can be configured to fade things out farther than usual
+    return 0
+  }
   max_room_alpha = byte(255 * (float64(max_room_alpha-LosMinVisibility) / float64(255-LosMinVisibility)))
   return max_room_alpha
 }
@@ -261,6 +471,9 @@ var Foo int = 0
 
 // Need floor, right wall, and left wall matrices to draw the details
 func (room *Room) render(floor, left, right mathgl.Mat4, zoom float32, base_alpha byte, drawables []Drawable, los_tex *LosTexture, floor_drawers []FloorDrawer) {
+  if room.Degenerate() {
+    return
+  }
   do_color := func(r, g, b, a byte) {
     R, G, B, A := room.Color()
     A = alphaMult(A, base_alpha)
@@ -281,14 +494,17 @@ func (room *Room) render(floor, left, right mathgl.Mat4, zoom float32, base_alph
   var vert roomVertex
 
   planes := []plane{
-    {room.left_buffer, room.Wall, &left},
-    {room.right_buffer, room.Wall, &right},
-    {room.floor_buffer, room.Floor, &floor},
+    {room.left_buffer, room.left_count, *room.wallTexture(), &left},
+    {room.right_buffer, room.right_count, *room.wallTexture(), &right},
+    {room.floor_buffer, room.floor_count, *room.floorTexture(), &floor},
   }
 
   gl.PushMatrix()
   defer gl.PopMatrix()
 
+  gl.LoadMatrixf(&floor[0])
+  room.markMissingCells()
+
   if los_tex != nil {
     gl.LoadMatrixf(&floor[0])
     gl.ClientActiveTexture(gl.TEXTURE1)
@@ -365,7 +581,7 @@ func (room *Room) render(floor, left, right mathgl.Mat4, zoom float32, base_alph
       do_color(255, 255, 255, room.far_right.wall_alpha)
 
     case &floor:
-      gl.StencilFunc(gl.ALWAYS, 2, 2)
+      gl.StencilFunc(gl.EQUAL, 2, 4)
       gl.StencilOp(gl.REPLACE, gl.REPLACE, gl.REPLACE)
       do_color(255, 255, 255, 255)
     }
@@ -384,7 +600,7 @@ func (room *Room) render(floor, left, right mathgl.Mat4, zoom float32, base_alph
     gl.LoadMatrixf(&floor[0])
     plane.texture.Data().Bind()
     gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, plane.index_buffer)
-    if (plane.mat == &left || plane.mat == &right) && strings.Contains(string(room.Wall.Path), "gradient.png") {
+    if (plane.mat == &left || plane.mat == &right) && strings.Contains(string(room.wallTexture().Path), "gradient.png") {
       base.EnableShader("gorey")
       base.SetUniformI("gorey", "tex", 0)
       base.SetUniformI("gorey", "foo", Foo)
@@ -392,7 +608,7 @@ func (room *Room) render(floor, left, right mathgl.Mat4, zoom float32, base_alph
       base.SetUniformF("gorey", "noise_rate", Noise_rate)
       base.SetUniformF("gorey", "num_steps", Num_steps)
     }
-    if plane.mat == &floor && strings.Contains(string(room.Floor.Path), "gradient.png") {
+    if plane.mat == &floor && strings.Contains(string(room.floorTexture().Path), "gradient.png") {
       base.EnableShader("gorey")
       base.SetUniformI("gorey", "tex", 0)
       base.SetUniformI("gorey", "foo", Foo)
@@ -415,7 +631,7 @@ func (room *Room) render(floor, left, right mathgl.Mat4, zoom float32, base_alph
       R, G, B, _ := room.Color()
       gl.Color4ub(R, G, B, 255)
     }
-    gl.DrawElements(gl.TRIANGLES, gl.Sizei(room.floor_count), gl.UNSIGNED_SHORT, nil)
+    gl.DrawElements(gl.TRIANGLES, gl.Sizei(plane.count), gl.UNSIGNED_SHORT, nil)
     if los_tex != nil {
       base.EnableShader("los")
     } else {
@@ -423,6 +639,9 @@ func (room *Room) render(floor, left, right mathgl.Mat4, zoom float32, base_alph
     }
   }
 
+  gl.LoadMatrixf(&floor[0])
+  room.renderFloorTiles()
+
   for _, wt := range room.WallTextures {
     if room.wall_texture_gl_map == nil {
       room.wall_texture_gl_map = make(map[*WallTexture]wallTextureGlIds)
@@ -457,7 +676,7 @@ func (room *Room) render(floor, left, right mathgl.Mat4, zoom float32, base_alph
       gl.TexCoordPointer(2, gl.FLOAT, gl.Sizei(unsafe.Sizeof(vert)), gl.Pointer(unsafe.Offsetof(vert.los_u)))
       gl.ClientActiveTexture(gl.TEXTURE0)
       if ids.floor_buffer != 0 {
-        gl.StencilFunc(gl.ALWAYS, 2, 2)
+        gl.StencilFunc(gl.EQUAL, 2, 4)
         gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, ids.floor_buffer)
         gl.Color4ub(R, G, B, A)
         gl.DrawElements(gl.TRIANGLES, ids.floor_count, gl.UNSIGNED_SHORT, nil)
@@ -527,6 +746,8 @@ func (room *Room) render(floor, left, right mathgl.Mat4, zoom float32, base_alph
       fd.RenderOnFloor()
     }
   }
+  gl.LoadMatrixf(&floor[0])
+  room.renderShadows(drawables, los_tex)
 
   do_color(255, 255, 255, 255)
   gl.LoadIdentity()
@@ -539,21 +760,110 @@ func (room *Room) render(floor, left, right mathgl.Mat4, zoom float32, base_alph
   base.EnableShader("")
 }
 
+// Draws the floor tiles, binding each distinct texture only once.  This is
+// done right after the floor is drawn so everything else is drawn on top.
+func (room *Room) renderFloorTiles() {
+  tiles := room.Floor_tiles
+  for i := range tiles {
+    first := true
+    for j := 0; j < i && first; j++ {
+      first = tiles[j].Texture.Path != tiles[i].Texture.Path
+    }
+    if !first {
+      continue
+    }
+    tiles[i].Texture.Data().Bind()
+    gl.Begin(gl.QUADS)
+    for j := i; j < len(tiles); j++ {
+      if tiles[j].Texture.Path != tiles[i].Texture.Path {
+        continue
+      }
+      x := float32(tiles[j].X)
+      y := float32(tiles[j].Y)
+      for _, c := range [][4]float32{{0, 0, 0, 1}, {0, 1, 0, 0}, {1, 1, 1, 0}, {1, 0, 1, 1}} {
+        gl.TexCoord2f(c[2], c[3])
+        gl.MultiTexCoord2f(gl.TEXTURE1, (float32(room.Y)+y+c[1])/LosTextureSize, (float32(room.X)+x+c[0])/LosTextureSize)
+        gl.Vertex2f(x+c[0], y+c[1])
+      }
+    }
+    gl.End()
+  }
+}
+
+// Sets the third bit of the stencil buffer in cells that aren't part of the
+// room, without drawing anything, so that the floor isn't drawn there and
+// anything in another room under those cells still shows.
+func (room *Room) markMissingCells() {
+  if len(room.Missing_cells) == 0 {
+    return
+  }
+  gl.ColorMask(gl.FALSE, gl.FALSE, gl.FALSE, gl.FALSE)
+  gl.StencilFunc(gl.ALWAYS, 4, 4)
+  gl.StencilOp(gl.REPLACE, gl.REPLACE, gl.REPLACE)
+  gl.Disable(gl.TEXTURE_2D)
+  gl.Begin(gl.QUADS)
+  for _, cell := range room.Missing_cells {
+    x := float32(cell.X)
+    y := float32(cell.Y)
+    gl.Vertex2f(x, y)
+    gl.Vertex2f(x, y+1)
+    gl.Vertex2f(x+1, y+1)
+    gl.Vertex2f(x+1, y)
+  }
+  gl.End()
+  gl.Enable(gl.TEXTURE_2D)
+  gl.ColorMask(gl.TRUE, gl.TRUE, gl.TRUE, gl.TRUE)
+}
+
+// Returns the half-open ranges [start, end) of i in [0, n) for which has(i)
+// is true.
+func cellRuns(n int, has func(int) bool) [][2]int {
+  var runs [][2]int
+  for i := 0; i < n; i++ {
+    if !has(i) {
+      continue
+    }
+    if len(runs) > 0 && runs[len(runs)-1][1] == i {
+      runs[len(runs)-1][1] = i + 1
+    } else {
+      runs = append(runs, [2]int{i, i + 1})
+    }
+  }
+  return runs
+}
+
+func sameCells(a, b []RoomCell) bool {
+  if len(a) != len(b) {
+    return false
+  }
+  for i := range a {
+    if a[i] != b[i] {
+      return false
+    }
+  }
+  return true
+}
+
 func (room *Room) setupGlStuff() {
+  wall := room.wallTexture().Data()
   if room.X == room.gl.x &&
     room.Y == room.gl.y &&
     room.Size.Dx == room.gl.dx &&
     room.Size.Dy == room.gl.dy &&
-    room.Wall.Data().Dx() == room.gl.wall_tex_dx &&
-    room.Wall.Data().Dy() == room.gl.wall_tex_dy {
+    wall.Dx() == room.gl.wall_tex_dx &&
+    wall.Dy() == room.gl.wall_tex_dy &&
+    room.Wall_height == room.gl.wall_height &&
+    sameCells(room.Missing_cells, room.gl.missing_cells) {
     return
   }
   room.gl.x = room.X
   room.gl.y = room.Y
   room.gl.dx = room.Size.Dx
   room.gl.dy = room.Size.Dy
-  room.gl.wall_tex_dx = room.Wall.Data().Dx()
-  room.gl.wall_tex_dy = room.Wall.Data().Dy()
+  room.gl.wall_tex_dx = wall.Dx()
+  room.gl.wall_tex_dy = wall.Dy()
+  room.gl.wall_height = room.Wall_height
+  room.gl.missing_cells = append([]RoomCell{}, room.Missing_cells...)
   if room.vbuffer != 0 {
     gl.DeleteBuffers(1, &room.vbuffer)
     gl.DeleteBuffers(1, &room.left_buffer)
@@ -562,10 +872,10 @@ func (room *Room) setupGlStuff() {
   }
   dx := float32(room.Size.Dx)
   dy := float32(room.Size.Dy)
-  var dz float32
-  if room.Wall.Data().Dx() > 0 {
-    dz = -float32(room.Wall.Data().Dy()*(room.Size.Dx+room.Size.Dy)) / float32(room.Wall.Data().Dx())
-  }
+  height, tiles := room.wallHeight()
+  dz := -height
+  // v-texcoord of the top of the walls
+  top := 1 - tiles
 
   // Conveniently casted values
   frx := float32(room.X)
@@ -587,14 +897,6 @@ func (room *Room) setupGlStuff() {
   lt_ury_ep := (fry + frdy - 0.5) / LosTextureSize
 
   vs := []roomVertex{
-    // Walls
-    {0, dy, 0, 0, 1, lt_ury_ep, lt_llx_ep},
-    {dx, dy, 0, c, 1, lt_ury_ep, lt_urx_ep},
-    {dx, 0, 0, 1, 1, lt_lly_ep, lt_urx_ep},
-    {0, dy, dz, 0, 0, lt_ury_ep, lt_llx_ep},
-    {dx, dy, dz, c, 0, lt_ury_ep, lt_urx_ep},
-    {dx, 0, dz, 1, 0, lt_lly_ep, lt_urx_ep},
-
     // Floor
     // This is the bulk of the floor, containing all but the outer edges of 
     // the room.  los_tex can map directly onto this so we don't need to do
@@ -644,34 +946,66 @@ func (room *Room) setupGlStuff() {
     {dx, 0.5, 0, 1, 1 - 0.5/dy, lt_lly_ep, lt_urx_ep},
     {dx, 0, 0, 1, 1, lt_lly_ep, lt_urx_ep},
   }
+
+  // The walls are only drawn along cells that are part of the room.  u and
+  // the los coordinates are interpolated along each wall so that a partial
+  // wall lines up with what the whole wall would have been.
+  add_edge := func(x, y float32, u, los_u, los_v float32) {
+    vs = append(vs, roomVertex{x, y, 0, u, 1, los_u, los_v})
+    vs = append(vs, roomVertex{x, y, dz, u, top, los_u, los_v})
+  }
+  var left_is, right_is []uint16
+  for _, run := range cellRuns(room.Size.Dx, func(x int) bool { return room.HasCell(x, room.Size.Dy-1) }) {
+    for _, x := range []int{run[0], run[1]} {
+      f := float32(x) / frdx
+      add_edge(float32(x), dy, c*f, lt_ury_ep, lt_llx_ep+(lt_urx_ep-lt_llx_ep)*f)
+    }
+    n := uint16(len(vs) - 4)
+    left_is = append(left_is, n, n+1, n+3, n, n+3, n+2)
+  }
+  for _, run := range cellRuns(room.Size.Dy, func(y int) bool { return room.HasCell(room.Size.Dx-1, y) }) {
+    for _, y := range []int{run[1], run[0]} {
+      f := float32(y) / frdy
+      add_edge(dx, float32(y), 1-(1-c)*f, lt_lly_ep+(lt_ury_ep-lt_lly_ep)*f, lt_urx_ep)
+    }
+    n := uint16(len(vs) - 4)
+    right_is = append(right_is, n, n+1, n+3, n, n+3, n+2)
+  }
+
   gl.GenBuffers(1, &room.vbuffer)
   gl.BindBuffer(gl.ARRAY_BUFFER, room.vbuffer)
   size := int(unsafe.Sizeof(roomVertex{}))
   gl.BufferData(gl.ARRAY_BUFFER, gl.Sizeiptr(size*len(vs)), gl.Pointer(&vs[0].x), gl.STATIC_DRAW)
 
   // left wall indices
-  is := []uint16{0, 3, 4, 0, 4, 1}
+  is := left_is
   gl.GenBuffers(1, &room.left_buffer)
   gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, room.left_buffer)
-  gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, gl.Sizeiptr(int(unsafe.Sizeof(is[0]))*len(is)), gl.Pointer(&is[0]), gl.STATIC_DRAW)
+  if len(is) > 0 {
+    gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, gl.Sizeiptr(int(unsafe.Sizeof(is[0]))*len(is)), gl.Pointer(&is[0]), gl.STATIC_DRAW)
+  }
+  room.left_count = len(is)
 
   // right wall indices
-  is = []uint16{1, 4, 5, 1, 5, 2}
+  is = right_is
   gl.GenBuffers(1, &room.right_buffer)
   gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, room.right_buffer)
-  gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, gl.Sizeiptr(int(unsafe.Sizeof(is[0]))*len(is)), gl.Pointer(&is[0]), gl.STATIC_DRAW)
+  if len(is) > 0 {
+    gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, gl.Sizeiptr(int(unsafe.Sizeof(is[0]))*len(is)), gl.Pointer(&is[0]), gl.STATIC_DRAW)
+  }
+  room.right_count = len(is)
 
   // floor indices
   is = []uint16{
-    6, 7, 8, 6, 8, 9, // middle
-    10, 11, 12, 10, 12, 13, // left side
-    14, 15, 16, 14, 16, 17, // bottom side
-    18, 19, 20, 18, 20, 21, // right side
-    22, 23, 24, 22, 24, 25, // top side
-    26, 27, 28, 26, 28, 29, // bottom left corner
-    30, 31, 32, 30, 32, 33, // upper left corner
-    34, 35, 36, 34, 36, 37, // upper right corner
-    38, 39, 40, 38, 40, 41, // lower right corner
+    0, 1, 2, 0, 2, 3, // middle
+    4, 5, 6, 4, 6, 7, // left side
+    8, 9, 10, 8, 10, 11, // bottom side
+    12, 13, 14, 12, 14, 15, // right side
+    16, 17, 18, 16, 18, 19, // top side
+    20, 21, 22, 20, 22, 23, // bottom left corner
+    24, 25, 26, 24, 26, 27, // upper left corner
+    28, 29, 30, 28, 30, 31, // upper right corner
+    32, 33, 34, 32, 34, 35, // lower right corner
   }
   gl.GenBuffers(1, &room.floor_buffer)
   gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, room.floor_buffer)
@@ -683,8 +1017,42 @@ func (room *roomDef) Dims() (dx, dy int) {
   return room.Size.Dx, room.Size.Dy
 }
 
+// Changes the size of the room.  Cells that are no longer in the room are
+// dropped from Move_costs, Floor_tiles, No_door_cells, and Missing_cells.
 func (r *roomDef) Resize(size RoomSize) {
   r.Size = size
+  var move_costs []MoveCost
+  for _, mc := range r.Move_costs {
+    if r.inBounds(mc.X, mc.Y) {
+      move_costs = append(move_costs, mc)
+    }
+  }
+  r.Move_costs = move_costs
+  var floor_tiles []FloorTile
+  for _, ft := range r.Floor_tiles {
+    if r.inBounds(ft.X, ft.Y) {
+      floor_tiles = append(floor_tiles, ft)
+    }
+  }
+  r.Floor_tiles = floor_tiles
+  var no_door_cells []RoomCell
+  for _, cell := range r.No_door_cells {
+    if r.isWallCell(cell.X, cell.Y) {
+      no_door_cells = append(no_door_cells, cell)
+    }
+  }
+  r.No_door_cells = no_door_cells
+  var missing_cells []RoomCell
+  for _, cell := range r.Missing_cells {
+    if r.inBounds(cell.X, cell.Y) {
+      missing_cells = append(missing_cells, cell)
+    }
+  }
+  r.Missing_cells = missing_cells
+}
+
+func (r *roomDef) inBounds(x, y int) bool {
+  return x >= 0 && y >= 0 && x < r.Size.Dx && y < r.Size.Dy
 }
 
 func imagePathFilter(path string, isdir bool) bool {
@@ -718,15 +1086,53 @@ type RoomEditorPanel struct {
   panels struct {
     furniture *FurniturePanel
     wall      *WallPanel
+    cell      *CellPanel
   }
 
   room   roomDef
   viewer *RoomViewer
+
+  undo    editUndoStack
+  key_map base.KeyMap
+
+  grid_visible bool
 }
 
 // Manually pass all events to the tabs, regardless of location, since the tabs
 // need to know where the user clicks.
 func (w *RoomEditorPanel) Respond(ui *gui.Gui, group gui.EventGroup) bool {
+  if found, event := group.FindEvent(w.key_map["undo"].Id()); found && event.Type == gin.Press {
+    w.panels.furniture.onEscape()
+    w.panels.furniture.clearSelection()
+    w.undo.Undo()
+    return true
+  }
+  if found, event := group.FindEvent(w.key_map["redo"].Id()); found && event.Type == gin.Press {
+    w.panels.furniture.onEscape()
+    w.panels.furniture.clearSelection()
+    w.undo.Redo()
+    return true
+  }
+  if found, event := group.FindEvent(w.key_map["toggle grid"].Id()); found && event.Type == gin.Press && ui.FocusWidget() == nil {
+    w.grid_visible = !w.grid_visible
+    w.viewer.SetGridVisible(w.grid_visible)
+    return true
+  }
+  pans := []struct {
+    key    string
+    dx, dy float64
+  }{
+    {"pan up", 0, 1},
+    {"pan down", 0, -1},
+    {"pan left", -1, 0},
+    {"pan right", 1, 0},
+  }
+  for _, pan := range pans {
+    if found, event := group.FindEvent(w.key_map[pan.key].Id()); found && event.Type == gin.Press {
+      w.viewer.Pan(pan.dx, pan.dy)
+      return true
+    }
+  }
   return w.widgets[w.tab.SelectedTab()].Respond(ui, group)
 }
 
@@ -774,13 +1180,15 @@ type Editor interface {
 func MakeRoomEditorPanel() Editor {
   var rep RoomEditorPanel
 
+  rep.key_map = base.GetDefaultKeyMap()
+  rep.grid_visible = true
   rep.HorizontalTable = gui.MakeHorizontalTable()
   rep.viewer = MakeRoomViewer(&rep.room, 65)
   rep.AddChild(rep.viewer)
 
   var tabs []gui.Widget
 
-  rep.panels.furniture = makeFurniturePanel(&rep.room, rep.viewer)
+  rep.panels.furniture = makeFurniturePanel(&rep.room, rep.viewer, &rep.undo)
   tabs = append(tabs, rep.panels.furniture)
   rep.widgets = append(rep.widgets, rep.panels.furniture)
 
@@ -788,6 +1196,10 @@ func MakeRoomEditorPanel() Editor {
   tabs = append(tabs, rep.panels.wall)
   rep.widgets = append(rep.widgets, rep.panels.wall)
 
+  rep.panels.cell = MakeCellPanel(&rep.room, rep.viewer)
+  tabs = append(tabs, rep.panels.cell)
+  rep.widgets = append(rep.widgets, rep.panels.cell)
+
   rep.tab = gui.MakeTabFrame(tabs)
   rep.AddChild(rep.tab)
   rep.viewer.SetEditMode(editFurniture)
@@ -797,9 +1209,13 @@ func MakeRoomEditorPanel() Editor {
 
 func (rep *RoomEditorPanel) Load(path string) error {
   var room roomDef
-  err := base.LoadAndProcessObject(path, "json", &room)
+  err := base.LoadAndProcessObject(path, base.FormatOfPath(path), &room)
+  if err == nil {
+    err = room.Validate()
+  }
   if err == nil {
     rep.room = room
+    rep.undo.Clear()
     for _, tab := range rep.widgets {
       tab.Reload()
     }
@@ -809,7 +1225,10 @@ func (rep *RoomEditorPanel) Load(path string) error {
 
 func (rep *RoomEditorPanel) Save() (string, error) {
   path := filepath.Join(datadir, "rooms", rep.room.Name+".room")
-  err := base.SaveJson(path, rep.room)
+  if Save_format == "gob" {
+    path += base.GobSuffix
+  }
+  err := base.SaveObject(path, Save_format, rep.room)
   return path, err
 }
 
@@ -0,0 +1,45 @@
+package house_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/runningwild/haunts/base"
+  "github.com/runningwild/haunts/house"
+  "path/filepath"
+)
+
+func RoomSpec(c gospec.Context) {
+  datadir, _ := filepath.Abs("../data_test")
+  house.LoadAllRoomsInDir(filepath.Join(datadir, "rooms"))
+  house.LoadAllDoorsInDir(filepath.Join(datadir, "doors"))
+  makeRoom := func(name string, x, y int) *house.Room {
+    r := &house.Room{Defname: name, X: x, Y: y}
+    base.GetObject("rooms", r)
+    return r
+  }
+  notched := makeRoom("Notched Test", 0, 0)
+
+  c.Specify("Missing cells aren't part of the room.", func() {
+    c.Expect(notched.Contains(2, 3), Equals, true)
+    c.Expect(notched.Contains(3, 2), Equals, true)
+    c.Expect(notched.Contains(3, 3), Equals, false)
+  })
+
+  c.Specify("Rooms can be placed in another room's missing cells.", func() {
+    c.Expect(house.RoomOverlap(notched, makeRoom("Room Test", 3, 3)), Equals, false)
+    c.Expect(house.RoomOverlap(makeRoom("Room Test", 3, 3), notched), Equals, false)
+    c.Expect(house.RoomOverlap(notched, makeRoom("Room Test", 2, 3)), Equals, true)
+  })
+
+  c.Specify("Doors can't be placed against missing cells.", func() {
+    door := house.MakeDoor("Door Test")
+    door.Facing = house.FarLeft
+    door.Pos = 3
+    c.Expect(house.CanAddDoor(notched, door), Equals, false)
+    door.Pos = 2
+    c.Expect(house.CanAddDoor(notched, door), Equals, true)
+    door.Facing = house.FarRight
+    door.Pos = 3
+    c.Expect(house.CanAddDoor(notched, door), Equals, false)
+  })
+}
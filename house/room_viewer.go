@@ -70,6 +70,9 @@ type RoomViewer struct {
   // Zoom factor, 1.0 is standard
   zoom float32
 
+  // Limits on zoom, as exponents of e
+  zoom_min, zoom_max float64
+
   // The modelview matrix that is sent to opengl.  Updated any time focus, zoom, or viewing
   // angle changes
   mat            mathgl.Mat4
@@ -89,6 +92,16 @@ type RoomViewer struct {
   // This tells us what to highlight based on the mouse position
   edit_mode editMode
 
+  grid struct {
+    visible bool
+
+    // If set, this is used instead of the palette's grid color
+    color *Color
+  }
+
+  // Reused every frame to pass things to draw on the floor to the room
+  floor_drawers []FloorDrawer
+
   // Keeping some things here to avoid unnecessary allocations elsewhere
   cstack base.ColorStack
 }
@@ -108,6 +121,9 @@ func MakeRoomViewer(room *roomDef, angle float32) *RoomViewer {
   rv.angle = angle
   rv.fx = float32(rv.room.Size.Dx / 2)
   rv.fy = float32(rv.room.Size.Dy / 2)
+  rv.zoom_min = 2.5
+  rv.zoom_max = 5.0
+  rv.grid.visible = true
   rv.Zoom(1)
   rv.size = rv.room.Size
   rv.makeMat()
@@ -134,10 +150,16 @@ func (rv *RoomViewer) Drag(dx, dy float64) {
   vy.Scale(float32(dy) / rv.zoom * 2)
   v.Add(&vx)
   v.Add(&vy)
-  rv.fx, rv.fy = v.X, v.Y
+  rv.fx = clamp(v.X, 0, float32(rv.room.Size.Dx))
+  rv.fy = clamp(v.Y, 0, float32(rv.room.Size.Dy))
   rv.makeMat()
 }
 
+// Moves the focus by the specified number of cells along the screen's axes.
+func (rv *RoomViewer) Pan(dx, dy float64) {
+  rv.Drag(dx*float64(rv.zoom)/2, dy*float64(rv.zoom)/2)
+}
+
 func (rv *RoomViewer) makeMat() {
   rv.mat, rv.imat, rv.left_wall_mat, rv.left_wall_imat, rv.right_wall_mat, rv.right_wall_imat = makeRoomMats(rv.room.roomDef, rv.Render_region, rv.fx, rv.fy, rv.angle, rv.zoom)
 }
@@ -319,11 +341,23 @@ func (rv *RoomViewer) Zoom(dz float64) {
     return
   }
   exp := math.Log(float64(rv.zoom)) + dz
-  exp = float64(clamp(float32(exp), 2.5, 5.0))
+  exp = float64(clamp(float32(exp), float32(rv.zoom_min), float32(rv.zoom_max)))
   rv.zoom = float32(math.Exp(exp))
   rv.makeMat()
 }
 
+// Sets the range that Zoom is allowed to move within, as exponents of e.
+func (rv *RoomViewer) SetZoomLimits(min, max float64) {
+  if min > max {
+    min, max = max, min
+  }
+  rv.zoom_min = min
+  rv.zoom_max = max
+  exp := math.Log(float64(rv.zoom))
+  rv.zoom = float32(math.Exp(float64(clamp(float32(exp), float32(min), float32(max)))))
+  rv.makeMat()
+}
+
 func drawPrep() {
   gl.Disable(gl.DEPTH_TEST)
   gl.Disable(gl.TEXTURE_2D)
@@ -358,10 +392,11 @@ func drawWall(room *Room, floor, left, right mathgl.Mat4, temp_tex *WallTexture,
   gl.PushMatrix()
   defer gl.PopMatrix()
 
-  var dz int
-  if room.Wall.Data().Dx() > 0 {
-    dz = room.Wall.Data().Dy() * (room.Size.Dx + room.Size.Dy) / room.Wall.Data().Dx()
+  if room.Degenerate() {
+    return
   }
+  height, tiles := room.wallHeight()
+  dz := int(height)
   corner := float32(room.Size.Dx) / float32(room.Size.Dx+room.Size.Dy)
   gl.LoadIdentity()
   gl.MultMatrixf(&floor[0])
@@ -378,9 +413,9 @@ func drawWall(room *Room, floor, left, right mathgl.Mat4, temp_tex *WallTexture,
     gl.Begin(gl.QUADS)
     gl.TexCoord2f(1, 0)
     gl.Vertex3i(room.Size.Dx, 0, 0)
-    gl.TexCoord2f(1, -1)
+    gl.TexCoord2f(1, -tiles)
     gl.Vertex3i(room.Size.Dx, 0, -dz)
-    gl.TexCoord2f(corner, -1)
+    gl.TexCoord2f(corner, -tiles)
     gl.Vertex3i(room.Size.Dx, room.Size.Dy, -dz)
     gl.TexCoord2f(corner, 0)
     gl.Vertex3i(room.Size.Dx, room.Size.Dy, 0)
@@ -402,7 +437,7 @@ func drawWall(room *Room, floor, left, right mathgl.Mat4, temp_tex *WallTexture,
       if door.Facing != FarRight {
         continue
       }
-      if door.IsOpened() != opened {
+      if door.IsLosOpened() != opened {
         continue
       }
       door.TextureData().Bind()
@@ -520,9 +555,9 @@ func drawWall(room *Room, floor, left, right mathgl.Mat4, temp_tex *WallTexture,
     gl.Begin(gl.QUADS)
     gl.TexCoord2f(corner, 0)
     gl.Vertex3i(room.Size.Dx, room.Size.Dy, 0)
-    gl.TexCoord2f(corner, -1)
+    gl.TexCoord2f(corner, -tiles)
     gl.Vertex3i(room.Size.Dx, room.Size.Dy, -dz)
-    gl.TexCoord2f(0, -1)
+    gl.TexCoord2f(0, -tiles)
     gl.Vertex3i(0, room.Size.Dy, -dz)
     gl.TexCoord2f(0, 0)
     gl.Vertex3i(0, room.Size.Dy, 0)
@@ -534,7 +569,7 @@ func drawWall(room *Room, floor, left, right mathgl.Mat4, temp_tex *WallTexture,
       if door.Facing != FarLeft {
         continue
       }
-      if door.IsOpened() != opened {
+      if door.IsLosOpened() != opened {
         continue
       }
       door.TextureData().Bind()
@@ -741,27 +776,13 @@ func (rv *RoomViewer) drawFloor() {
   gl.MultMatrixf(&rv.mat[0])
   defer gl.PopMatrix()
 
-  gl.Disable(gl.TEXTURE_2D)
-  gl.Color4f(1, 0, 1, 0.9)
-  if rv.edit_mode == editCells {
-    gl.LineWidth(0.02 * rv.zoom)
-  } else {
-    gl.LineWidth(0.05 * rv.zoom)
+  if rv.grid.visible {
+    rv.drawGrid()
   }
-  gl.Begin(gl.LINES)
-  for i := float32(0); i < float32(rv.room.Size.Dx); i += 1.0 {
-    gl.Vertex2f(i, 0)
-    gl.Vertex2f(i, float32(rv.room.Size.Dy))
-  }
-  for j := float32(0); j < float32(rv.room.Size.Dy); j += 1.0 {
-    gl.Vertex2f(0, j)
-    gl.Vertex2f(float32(rv.room.Size.Dx), j)
-  }
-  gl.End()
 
   if rv.edit_mode == editCells {
     gl.Disable(gl.TEXTURE_2D)
-    gl.Color4d(1, 0, 0, 1)
+    palette.Furniture_outline.Set()
     gl.LineWidth(0.05 * rv.zoom)
     gl.Begin(gl.LINES)
     for _, f := range rv.room.Furniture {
@@ -785,6 +806,173 @@ func (rv *RoomViewer) drawFloor() {
   gl.Disable(gl.STENCIL_TEST)
 }
 
+// Shows or hides the lines between cells on the floor.
+func (rv *RoomViewer) SetGridVisible(visible bool) {
+  rv.grid.visible = visible
+}
+
+func (rv *RoomViewer) SetGridColor(r, g, b, a float32) {
+  rv.grid.color = &Color{byte(255 * r), byte(255 * g), byte(255 * b), byte(255 * a)}
+}
+
+func (rv *RoomViewer) drawGrid() {
+  gl.Disable(gl.TEXTURE_2D)
+  if rv.grid.color != nil {
+    rv.grid.color.Set()
+  } else {
+    palette.Grid.Set()
+  }
+  if rv.edit_mode == editCells {
+    gl.LineWidth(0.02 * rv.zoom)
+  } else {
+    gl.LineWidth(0.05 * rv.zoom)
+  }
+  gl.Begin(gl.LINES)
+  for i := float32(0); i < float32(rv.room.Size.Dx); i += 1.0 {
+    gl.Vertex2f(i, 0)
+    gl.Vertex2f(i, float32(rv.room.Size.Dy))
+  }
+  for j := float32(0); j < float32(rv.room.Size.Dy); j += 1.0 {
+    gl.Vertex2f(0, j)
+    gl.Vertex2f(float32(rv.room.Size.Dx), j)
+  }
+  gl.End()
+}
+
+// Draws the grid as part of the floor, so that furniture is drawn over it.
+type gridDrawer struct {
+  rv *RoomViewer
+}
+
+func (gd gridDrawer) Pos() (int, int) {
+  return 0, 0
+}
+func (gd gridDrawer) Dims() (int, int) {
+  return gd.rv.room.Size.Dx, gd.rv.room.Size.Dy
+}
+func (gd gridDrawer) RenderOnFloor() {
+  gd.rv.drawGrid()
+  gl.Enable(gl.TEXTURE_2D)
+}
+
+// Shows which cells along the walls can have doors, green if they can and red
+// if they can't.
+type doorCellDrawer struct {
+  room *Room
+}
+
+func (dc doorCellDrawer) Pos() (int, int) {
+  return 0, 0
+}
+func (dc doorCellDrawer) Dims() (int, int) {
+  return dc.room.Size.Dx, dc.room.Size.Dy
+}
+func (dc doorCellDrawer) RenderOnFloor() {
+  gl.Disable(gl.TEXTURE_2D)
+  gl.Begin(gl.QUADS)
+  for x := 0; x < dc.room.Size.Dx; x++ {
+    for y := 0; y < dc.room.Size.Dy; y++ {
+      if !dc.room.isWallCell(x, y) {
+        continue
+      }
+      if dc.room.CanHaveDoor(x, y) {
+        palette.Door_cell.Set()
+      } else {
+        palette.Door_cell_invalid.Set()
+      }
+      gl.Vertex2i(x, y)
+      gl.Vertex2i(x, y+1)
+      gl.Vertex2i(x+1, y+1)
+      gl.Vertex2i(x+1, y)
+    }
+  }
+  gl.End()
+  gl.Enable(gl.TEXTURE_2D)
+}
+
+// Draws a line across the room along every edge of the furniture being
+// dragged that lines up with an edge of some other piece of furniture.
+func (rv *RoomViewer) drawGuides() {
+  var moving, still []*Furniture
+  for _, f := range rv.room.Furniture {
+    if f.temporary {
+      moving = append(moving, f)
+    } else {
+      still = append(still, f)
+    }
+  }
+  if len(moving) == 0 {
+    return
+  }
+  xs := make(map[int]bool)
+  ys := make(map[int]bool)
+  for _, m := range moving {
+    mx, my := m.Pos()
+    mdx, mdy := m.Dims()
+    for _, f := range still {
+      fx, fy := f.Pos()
+      fdx, fdy := f.Dims()
+      for _, x := range []int{mx, mx + mdx} {
+        if x == fx || x == fx+fdx {
+          xs[x] = true
+        }
+      }
+      for _, y := range []int{my, my + mdy} {
+        if y == fy || y == fy+fdy {
+          ys[y] = true
+        }
+      }
+    }
+  }
+  gl.Disable(gl.TEXTURE_2D)
+  palette.Guide.Set()
+  gl.LineWidth(0.02 * rv.zoom)
+  gl.Begin(gl.LINES)
+  for x := range xs {
+    gl.Vertex2i(x, 0)
+    gl.Vertex2i(x, rv.room.Size.Dy)
+  }
+  for y := range ys {
+    gl.Vertex2i(0, y)
+    gl.Vertex2i(rv.room.Size.Dx, y)
+  }
+  gl.End()
+}
+
+// Fills in the cells occupied by the furniture that is selected, being
+// dragged, or under the mouse, so it's clear exactly which cells it blocks.
+// This is drawn over everything since the art can hide the footprint.
+func (rv *RoomViewer) drawFootprints() {
+  gl.PushMatrix()
+  defer gl.PopMatrix()
+  gl.LoadIdentity()
+  gl.Disable(gl.TEXTURE_2D)
+  defer gl.Enable(gl.TEXTURE_2D)
+  gl.Begin(gl.QUADS)
+  for _, f := range rv.room.Furniture {
+    x, y := f.Pos()
+    dx, dy := f.Dims()
+    hovered := rv.edit_mode == editFurniture && rv.mx >= x && rv.mx < x+dx && rv.my >= y && rv.my < y+dy
+    if !hovered && !f.selected && !f.temporary {
+      continue
+    }
+    if f.invalid {
+      palette.Footprint_invalid.Set()
+    } else {
+      palette.Footprint.Set()
+    }
+    for cx := x; cx < x+dx; cx++ {
+      for cy := y; cy < y+dy; cy++ {
+        for _, c := range [][2]int{{cx, cy}, {cx, cy + 1}, {cx + 1, cy + 1}, {cx + 1, cy}} {
+          wx, wy, _ := rv.boardToModelview(float32(c[0]), float32(c[1]))
+          gl.Vertex2f(wx, wy)
+        }
+      }
+    }
+  }
+  gl.End()
+}
+
 func drawFurniture(roomx, roomy int, mat mathgl.Mat4, zoom float32, furniture []*Furniture, temp_furniture *Furniture, extras []Drawable, cstack base.ColorStack, los_tex *LosTexture, los_alpha float64) {
   gl.Enable(gl.TEXTURE_2D)
   gl.Color4d(1, 1, 1, los_alpha)
@@ -913,7 +1101,19 @@ func (rv *RoomViewer) Draw(region gui.Region) {
   rv.room.setupGlStuff()
   rv.room.far_left.wall_alpha = 255
   rv.room.far_right.wall_alpha = 255
-  rv.room.render(rv.mat, rv.left_wall_mat, rv.right_wall_mat, rv.zoom, 255, nil, nil, nil)
+  rv.floor_drawers = rv.floor_drawers[0:0]
+  for _, door := range rv.room.Doors {
+    rv.floor_drawers = append(rv.floor_drawers, doorMarker{door, rv.room})
+  }
+  if rv.grid.visible {
+    rv.floor_drawers = append(rv.floor_drawers, gridDrawer{rv})
+  }
+  if rv.edit_mode == editCells {
+    rv.floor_drawers = append(rv.floor_drawers, doorCellDrawer{rv.room})
+  }
+  rv.room.render(rv.mat, rv.left_wall_mat, rv.right_wall_mat, rv.zoom, 255, nil, nil, rv.floor_drawers)
+  rv.drawGuides()
+  rv.drawFootprints()
   return
 
   rv.cstack.Push(1, 1, 1, 1)
@@ -932,6 +1132,93 @@ func (rv *RoomViewer) Draw(region gui.Region) {
   drawFurniture(0, 0, rv.mat, rv.zoom, rv.room.Furniture, rv.Temp.Furniture, nil, rv.cstack, nil, 1.0)
 }
 
+// Marks the cells on the floor in front of a door, green if the door is open
+// and red if it is closed.  Positions are in floor coordinates.
+type doorMarker struct {
+  door *Door
+  room *Room
+}
+
+func (dm doorMarker) Pos() (int, int) {
+  x, y := dm.room.X, dm.room.Y
+  switch dm.door.Facing {
+  case FarLeft:
+    return x + dm.door.Pos, y + dm.room.Size.Dy - 1
+  case FarRight:
+    return x + dm.room.Size.Dx - 1, y + dm.door.Pos
+  case NearLeft:
+    return x, y + dm.door.Pos
+  }
+  return x + dm.door.Pos, y
+}
+
+func (dm doorMarker) Dims() (int, int) {
+  if dm.door.Facing == FarLeft || dm.door.Facing == NearRight {
+    return dm.door.Width, 1
+  }
+  return 1, dm.door.Width
+}
+
+func (dm doorMarker) RenderOnFloor() {
+  x, y := dm.Pos()
+  dx, dy := dm.Dims()
+  gl.Disable(gl.TEXTURE_2D)
+  if dm.door.IsOpened() {
+    palette.Door_opened.Set()
+  } else {
+    palette.Door_closed.Set()
+  }
+  gl.Begin(gl.QUADS)
+  gl.Vertex2i(x, y)
+  gl.Vertex2i(x, y+dy)
+  gl.Vertex2i(x+dx, y+dy)
+  gl.Vertex2i(x+dx, y)
+  gl.End()
+  gl.Enable(gl.TEXTURE_2D)
+}
+
+// Draws a doorMarker for every door on a floor, so the house editor can show
+// which doors are open.
+type floorDoorMarkers struct {
+  floor func() *Floor
+}
+
+func (fm floorDoorMarkers) Pos() (int, int) {
+  x, y, _, _ := fm.bounds()
+  return x, y
+}
+
+func (fm floorDoorMarkers) Dims() (int, int) {
+  x, y, x2, y2 := fm.bounds()
+  return x2 - x, y2 - y
+}
+
+func (fm floorDoorMarkers) bounds() (x, y, x2, y2 int) {
+  for i, room := range fm.floor().Rooms {
+    if i == 0 || room.X < x {
+      x = room.X
+    }
+    if i == 0 || room.Y < y {
+      y = room.Y
+    }
+    if i == 0 || room.X+room.Size.Dx > x2 {
+      x2 = room.X + room.Size.Dx
+    }
+    if i == 0 || room.Y+room.Size.Dy > y2 {
+      y2 = room.Y + room.Size.Dy
+    }
+  }
+  return
+}
+
+func (fm floorDoorMarkers) RenderOnFloor() {
+  for _, room := range fm.floor().Rooms {
+    for _, door := range room.Doors {
+      doorMarker{door, room}.RenderOnFloor()
+    }
+  }
+}
+
 func (rv *RoomViewer) SetEventHandler(handler gin.EventHandler) {
   rv.handler = handler
 }
@@ -75,9 +75,12 @@ func (a adag) Successors(n int) []int {
 
 func OrderRectObjects(ra []RectObject) []RectObject {
   p := order(ra)
-  if p == nil {
-    return ra
+  if p == nil || !consistentOrder(ra, p) {
+    // The sweep can't always find an order when several footprints
+    // interlock, so fall back on comparing every pair of objects.
+    p = pairwiseOrder(ra)
   }
+  stableTies(ra, p)
   r := make([]RectObject, len(ra))
   for i := range p {
     r[i] = ra[p[i]]
@@ -106,7 +109,7 @@ func order(input []RectObject) []int {
   for i, r := range input {
     x, y := r.Pos()
     dx, dy := r.Dims()
-    ra[i] = arog{x - minx + 1, y - miny + 1, dx, dy}
+    ra[i] = arog{x - minx + 1, y - miny + 1, dx, dy, i}
   }
 
   mapping := make(map[RectObject]int, len(ra))
@@ -133,6 +136,9 @@ func order(input []RectObject) []int {
     w_b := width(b.Dims())
     va := w_b * (w_a*da + (da2-da)*(sweep_pos-pos(ax, ay)))
     vb := w_a * (w_b*db + (db2-db)*(sweep_pos-pos(bx, by)))
+    if va == vb {
+      return a.(arog).index < b.(arog).index
+    }
     return va < vb
   }
   l := llrb.New(less_func)
@@ -162,7 +168,147 @@ func order(input []RectObject) []int {
 
 type arog struct {
   x, y, dx, dy int
+
+  // Position in the input, keeps objects with identical footprints distinct.
+  index int
 }
 
 func (a arog) Pos() (int, int)  { return a.x, a.y }
 func (a arog) Dims() (int, int) { return a.dx, a.dy }
+
+// Returns true if a and b overlap on screen and a needs to be drawn in front
+// of b.
+func inFrontOf(a, b RectObject) bool {
+  ax, ay, ax2, ay2 := firstAndLastPoints(a)
+  bx, by, bx2, by2 := firstAndLastPoints(b)
+  if pos(ax, ay) >= pos(bx2, by2) || pos(bx, by) >= pos(ax2, ay2) {
+    return false
+  }
+  return ax2 <= bx || ay <= by2
+}
+
+type byScreenStart struct {
+  ra      []RectObject
+  indices []int
+}
+
+func (b byScreenStart) Len() int {
+  return len(b.indices)
+}
+func (b byScreenStart) Less(i, j int) bool {
+  return pos(firstPoint(b.ra[b.indices[i]])) < pos(firstPoint(b.ra[b.indices[j]]))
+}
+func (b byScreenStart) Swap(i, j int) {
+  b.indices[i], b.indices[j] = b.indices[j], b.indices[i]
+}
+
+// Returns true if nothing in p is in front of something that comes before it.
+// Only objects that overlap on screen can be in front of one another, so
+// objects are swept in the order that they start on screen and each is only
+// compared against the ones that start before it ends.
+func consistentOrder(ra []RectObject, p []int) bool {
+  if len(p) != len(ra) {
+    return false
+  }
+  rank := make([]int, len(ra))
+  for i := range p {
+    rank[p[i]] = i
+  }
+  sweep := byScreenStart{ra, make([]int, len(ra))}
+  for i := range sweep.indices {
+    sweep.indices[i] = i
+  }
+  sort.Sort(sweep)
+  for i, a := range sweep.indices {
+    end := pos(lastPoint(ra[a]))
+    for _, b := range sweep.indices[i+1:] {
+      if pos(firstPoint(ra[b])) >= end {
+        break
+      }
+      earlier, later := a, b
+      if rank[b] < rank[a] {
+        earlier, later = b, a
+      }
+      if inFrontOf(ra[later], ra[earlier]) {
+        return false
+      }
+    }
+  }
+  return true
+}
+
+// Topologically sorts ra by the inFrontOf relation.  Whenever there is a
+// choice the object that came first in ra is taken, and if the relation has
+// a cycle it is broken at the earliest object left in ra, so the result is
+// always the same for the same input.
+func pairwiseOrder(ra []RectObject) []int {
+  behind := make(adag, len(ra))
+  in := make([]int, len(ra))
+  for i := range ra {
+    for j := range ra {
+      if i != j && inFrontOf(ra[i], ra[j]) {
+        behind[i] = append(behind[i], j)
+        in[j]++
+      }
+    }
+  }
+  done := make([]bool, len(ra))
+  var p []int
+  for len(p) < len(ra) {
+    next := -1
+    for i := range ra {
+      if !done[i] && in[i] == 0 {
+        next = i
+        break
+      }
+    }
+    if next == -1 {
+      for i := range ra {
+        if !done[i] {
+          next = i
+          break
+        }
+      }
+    }
+    done[next] = true
+    p = append(p, next)
+    for _, j := range behind[next] {
+      in[j]--
+    }
+  }
+  return p
+}
+
+// Objects with identical footprints can be drawn in either order, but
+// whichever order is chosen needs to be the same every time or they will
+// flicker.  This puts every such group into the order it had in ra.
+func stableTies(ra []RectObject, p []int) {
+  type footprint struct {
+    x, y, dx, dy int
+  }
+  slots := make(map[footprint][]int)
+  var keys []footprint
+  for i := range p {
+    x, y := ra[p[i]].Pos()
+    dx, dy := ra[p[i]].Dims()
+    key := footprint{x, y, dx, dy}
+    if _, ok := slots[key]; !ok {
+      keys = append(keys, key)
+    }
+    slots[key] = append(slots[key], i)
+  }
+  for _, key := range keys {
+    group := slots[key]
+    if len(group) < 2 {
+      continue
+    }
+    var indices []int
+    for _, slot := range group {
+      indices = append(indices, p[slot])
+    }
+    sort.Ints(indices)
+    for i, slot := range group {
+      p[slot] = indices[i]
+    }
+  }
+}
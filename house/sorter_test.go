@@ -0,0 +1,105 @@
+package house_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/runningwild/haunts/house"
+  "testing"
+)
+
+type rect struct {
+  x, y, dx, dy int
+}
+
+func (r rect) Pos() (int, int)  { return r.x, r.y }
+func (r rect) Dims() (int, int) { return r.dx, r.dy }
+
+func SorterSpec(c gospec.Context) {
+  c.Specify("Interlocking footprints are ordered front to back.", func() {
+    // A long piece along the near edge, a tall piece along the left edge,
+    // one piece tucked into the corner of the L they make, and one more
+    // behind that.
+    a := rect{0, 0, 4, 1}
+    b := rect{0, 1, 1, 3}
+    corner := rect{1, 1, 1, 1}
+    d := rect{2, 1, 2, 2}
+    ordered := house.OrderRectObjects([]house.RectObject{d, corner, b, a})
+    c.Expect(len(ordered), Equals, 4)
+    c.Expect(ordered[0], Equals, house.RectObject(a))
+    c.Expect(ordered[1], Equals, house.RectObject(b))
+    c.Expect(ordered[2], Equals, house.RectObject(corner))
+    c.Expect(ordered[3], Equals, house.RectObject(d))
+  })
+
+  c.Specify("Objects on the same cell always come out in the same order.", func() {
+    // Two entities stacked on one cell, along with a few things around them.
+    first := &rect{3, 3, 1, 1}
+    second := &rect{3, 3, 1, 1}
+    objs := []house.RectObject{
+      rect{0, 0, 4, 1},
+      first,
+      rect{4, 2, 1, 2},
+      second,
+      rect{1, 5, 2, 2},
+    }
+    ordered := house.OrderRectObjects(objs)
+    var firsts, seconds []int
+    for i := 0; i < 10; i++ {
+      again := house.OrderRectObjects(objs)
+      for j := range again {
+        if again[j] == house.RectObject(first) {
+          firsts = append(firsts, j)
+        }
+        if again[j] == house.RectObject(second) {
+          seconds = append(seconds, j)
+        }
+        c.Expect(again[j], Equals, ordered[j])
+      }
+    }
+    c.Expect(len(firsts), Equals, 10)
+    c.Expect(len(seconds), Equals, 10)
+    for i := range firsts {
+      c.Expect(firsts[i] < seconds[i], IsTrue)
+    }
+  })
+}
+
+// Ordering is what a room has to do every frame to draw its furniture when
+// anything in it has changed.
+func BenchmarkOrderFiftyPieces(b *testing.B) {
+  var objs []house.RectObject
+  for i := 0; i < 50; i++ {
+    objs = append(objs, rect{(i % 10) * 3, (i / 10) * 3, 2, 1 + i%3})
+  }
+  b.ResetTimer()
+  for i := 0; i < b.N; i++ {
+    house.OrderRectObjects(objs)
+  }
+}
+
+// The same pieces, ordered the way a room orders them every frame, which
+// only sorts them the first time since nothing moves.
+func BenchmarkOrderFiftyPiecesCached(b *testing.B) {
+  var objs []house.RectObject
+  for i := 0; i < 50; i++ {
+    objs = append(objs, rect{(i % 10) * 3, (i / 10) * 3, 2, 1 + i%3})
+  }
+  room := &house.Room{}
+  b.ResetTimer()
+  for i := 0; i < b.N; i++ {
+    house.OrderRoomObjects(room, objs)
+  }
+}
+
+// A large floor with only a few small things spread out across it, most
+// pairs of objects are nowhere near each other.
+func BenchmarkOrderSparseFloor(b *testing.B) {
+  var objs []house.RectObject
+  for i := 0; i < 200; i++ {
+    objs = append(objs, rect{(i * 37) % 500, (i * 91) % 500, 1 + i%2, 1 + i%3})
+  }
+  b.ResetTimer()
+  for i := 0; i < b.N; i++ {
+    house.OrderRectObjects(objs)
+  }
+}
@@ -0,0 +1,68 @@
+package house
+
+import (
+  "fmt"
+  "github.com/runningwild/haunts/base"
+  "image"
+)
+
+// Thumbnails are always rendered from the same angle the editors start at.
+const thumbnailAngle = 62
+
+// Thumbnails that have already been rendered, keyed by the registry and name
+// of the def they were rendered from and their size.
+var thumbnail_cache = make(map[string]image.Image)
+
+// Renders a preview of a single room, door, or piece of furniture to an image
+// that is size pixels on a side.  def should be a *Room, *Door, or *Furniture;
+// only its Defname is used.  Furniture is drawn on a plain floor, and doors
+// are drawn on a plain wall.
+func RenderThumbnail(def interface{}, size int) (image.Image, error) {
+  var key string
+  room := &Room{X: 1, Y: 1}
+  switch d := def.(type) {
+  case *Room:
+    key = "rooms:" + d.Defname
+    room.Defname = d.Defname
+    base.GetObject("rooms", room)
+
+  case *Door:
+    key = "doors:" + d.Defname
+    door := MakeDoor(d.Defname)
+    if door.doorDef == nil {
+      return nil, fmt.Errorf("No door named '%s'", d.Defname)
+    }
+    door.Facing = FarLeft
+    door.Pos = 1
+    room.roomDef = &roomDef{Size: RoomSize{Dx: door.Width + 2, Dy: 2}}
+    room.Doors = []*Door{door}
+
+  case *Furniture:
+    key = "furniture:" + d.Defname
+    furn := MakeFurniture(d.Defname)
+    if furn.furnitureDef == nil {
+      return nil, fmt.Errorf("No furniture named '%s'", d.Defname)
+    }
+    furn.X, furn.Y = 1, 1
+    dx, dy := furn.Dims()
+    room.roomDef = &roomDef{Size: RoomSize{Dx: dx + 2, Dy: dy + 2}}
+    room.Furniture = []*Furniture{furn}
+
+  default:
+    return nil, fmt.Errorf("Can't render a thumbnail of a %T", def)
+  }
+  key = fmt.Sprintf("%s:%d", key, size)
+  if img, ok := thumbnail_cache[key]; ok {
+    return img, nil
+  }
+  if room.roomDef == nil {
+    return nil, fmt.Errorf("No room named '%s'", room.Defname)
+  }
+
+  img, err := renderFloorImage(&Floor{Rooms: []*Room{room}}, thumbnailAngle, size)
+  if err != nil {
+    return nil, err
+  }
+  thumbnail_cache[key] = img
+  return img, nil
+}
@@ -0,0 +1,166 @@
+package house
+
+// An edit that can be undone and then redone.
+type editCommand interface {
+  Undo()
+  Redo()
+}
+
+// Undo/redo history for an editor.  Mutating operations push a command once
+// they are complete, anything that was undone is discarded at that point.
+type editUndoStack struct {
+  undo, redo []editCommand
+}
+
+func (s *editUndoStack) Push(cmd editCommand) {
+  s.undo = append(s.undo, cmd)
+  s.redo = s.redo[0:0]
+}
+
+func (s *editUndoStack) Undo() bool {
+  if len(s.undo) == 0 {
+    return false
+  }
+  cmd := s.undo[len(s.undo)-1]
+  s.undo = s.undo[0 : len(s.undo)-1]
+  cmd.Undo()
+  s.redo = append(s.redo, cmd)
+  return true
+}
+
+func (s *editUndoStack) Redo() bool {
+  if len(s.redo) == 0 {
+    return false
+  }
+  cmd := s.redo[len(s.redo)-1]
+  s.redo = s.redo[0 : len(s.redo)-1]
+  cmd.Redo()
+  s.undo = append(s.undo, cmd)
+  return true
+}
+
+func (s *editUndoStack) Clear() {
+  s.undo = nil
+  s.redo = nil
+}
+
+// Captures everything on a house that the house editor can change.  Doors
+// are always captured in their entirety since removing or moving one door
+// can cascade to others through removeInvalidDoors.
+type houseSnapshot struct {
+  house  *HouseDef
+  floors []*Floor
+  data   []floorSnapshot
+}
+
+type floorSnapshot struct {
+  rooms      []roomSnapshot
+  spawns     []*SpawnPoint
+  spawn_vals []SpawnPoint
+}
+
+type roomSnapshot struct {
+  room      *Room
+  x, y      int
+  def       *roomDef
+  bounds    *RoomBounds
+  doors     []*Door
+  door_vals []Door
+}
+
+func snapshotHouse(h *HouseDef) *houseSnapshot {
+  hs := &houseSnapshot{house: h}
+  hs.floors = append(hs.floors, h.Floors...)
+  for _, floor := range h.Floors {
+    var fs floorSnapshot
+    for _, room := range floor.Rooms {
+      rs := roomSnapshot{room: room, x: room.X, y: room.Y, def: room.roomDef, bounds: room.Bounds}
+      rs.doors = append(rs.doors, room.Doors...)
+      for _, door := range room.Doors {
+        rs.door_vals = append(rs.door_vals, *door)
+      }
+      fs.rooms = append(fs.rooms, rs)
+    }
+    fs.spawns = append(fs.spawns, floor.Spawns...)
+    for _, sp := range floor.Spawns {
+      fs.spawn_vals = append(fs.spawn_vals, *sp)
+    }
+    hs.data = append(hs.data, fs)
+  }
+  return hs
+}
+
+func (hs *houseSnapshot) restore() {
+  hs.house.Floors = append(hs.house.Floors[0:0], hs.floors...)
+  for i, floor := range hs.floors {
+    fs := hs.data[i]
+    floor.Rooms = floor.Rooms[0:0]
+    for _, rs := range fs.rooms {
+      rs.room.X = rs.x
+      rs.room.Y = rs.y
+      rs.room.roomDef = rs.def
+      rs.room.Bounds = rs.bounds
+      rs.room.temporary = false
+      rs.room.invalid = false
+      rs.room.Doors = append([]*Door{}, rs.doors...)
+      for j, door := range rs.doors {
+        *door = rs.door_vals[j]
+        door.state.pos = -1 // forces it to redo its gl data
+      }
+      rs.room.DoorsChanged()
+      floor.Rooms = append(floor.Rooms, rs.room)
+    }
+    floor.Spawns = append([]*SpawnPoint{}, fs.spawns...)
+    for j, sp := range fs.spawns {
+      *sp = fs.spawn_vals[j]
+    }
+  }
+}
+
+type houseEdit struct {
+  before, after *houseSnapshot
+}
+
+func (he *houseEdit) Undo() {
+  he.before.restore()
+}
+func (he *houseEdit) Redo() {
+  he.after.restore()
+}
+
+// Captures the furniture in a room.
+type furnitureSnapshot struct {
+  room *roomDef
+  furn []*Furniture
+  vals []Furniture
+}
+
+func snapshotFurniture(room *roomDef) *furnitureSnapshot {
+  fs := &furnitureSnapshot{room: room}
+  fs.furn = append(fs.furn, room.Furniture...)
+  for _, f := range room.Furniture {
+    fs.vals = append(fs.vals, *f)
+  }
+  return fs
+}
+
+func (fs *furnitureSnapshot) restore() {
+  fs.room.Furniture = append([]*Furniture{}, fs.furn...)
+  for i, f := range fs.furn {
+    *f = fs.vals[i]
+    f.temporary = false
+    f.invalid = false
+    f.selected = false
+  }
+}
+
+type furnitureEdit struct {
+  before, after *furnitureSnapshot
+}
+
+func (fe *furnitureEdit) Undo() {
+  fe.before.restore()
+}
+func (fe *furnitureEdit) Redo() {
+  fe.after.restore()
+}
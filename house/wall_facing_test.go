@@ -0,0 +1,26 @@
+package house_test
+
+import (
+  "bytes"
+  "encoding/gob"
+  "github.com/orfjackal/gospec/src/gospec"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/runningwild/haunts/house"
+)
+
+func WallFacingSpec(c gospec.Context) {
+  c.Specify("All four facings survive a gob round-trip and are valid.", func() {
+    for _, facing := range []house.WallFacing{house.NearLeft, house.NearRight, house.FarLeft, house.FarRight} {
+      buf := bytes.NewBuffer(nil)
+      c.Expect(gob.NewEncoder(buf).Encode(facing), IsNil)
+      var decoded house.WallFacing
+      c.Expect(gob.NewDecoder(buf).Decode(&decoded), IsNil)
+      c.Expect(decoded, Equals, facing)
+      c.Expect(decoded.Valid(), IsTrue)
+    }
+  })
+  c.Specify("Facings outside of NearLeft..FarRight are invalid.", func() {
+    c.Expect(house.WallFacing(-1).Valid(), IsFalse)
+    c.Expect((house.FarRight + 1).Valid(), IsFalse)
+  })
+}
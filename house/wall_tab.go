@@ -93,7 +93,7 @@ func (w *WallPanel) Respond(ui *gui.Gui, group gui.EventGroup) bool {
     return true
   }
 
-  if found, event := group.FindEvent(gin.Escape); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["cancel"].Id()); found && event.Type == gin.Press {
     w.onEscape()
     return true
   }
@@ -109,7 +109,7 @@ func (w *WallPanel) Respond(ui *gui.Gui, group gui.EventGroup) bool {
       w.wall_texture.Rot += float32(event.Key.CurPressAmt() / 100)
     }
   }
-  if found, event := group.FindEvent(gin.MouseLButton); found && event.Type == gin.Press {
+  if found, event := group.FindEvent(base.GetDefaultKeyMap()["place"].Id()); found && event.Type == gin.Press {
     if w.wall_texture != nil {
       w.wall_texture.temporary = false
       w.wall_texture = nil
@@ -19,6 +19,7 @@ import (
   "github.com/runningwild/haunts/game"
   "github.com/runningwild/haunts/sound"
   "github.com/runningwild/haunts/house"
+  "github.com/runningwild/haunts/texture"
 
   // Need to pull in all of the actions we define here and not in
   // haunts/game because haunts/game/actions depends on it
@@ -50,7 +51,11 @@ func loadAllRegistries() {
   house.LoadAllRoomsInDir(filepath.Join(datadir, "rooms"))
   house.LoadAllDoorsInDir(filepath.Join(datadir, "doors"))
   house.LoadAllHousesInDir(filepath.Join(datadir, "houses"))
+  house.LoadAllPalettesInDir(filepath.Join(datadir, "palettes"))
+  house.SetPalette("Default")
   game.LoadAllGearInDir(filepath.Join(datadir, "gear"))
+  game.LoadAllItemsInDir(filepath.Join(datadir, "items"))
+  game.LoadAllTriggersInDir(filepath.Join(datadir, "triggers"))
   game.RegisterActions()
   status.RegisterAllConditions()
 }
@@ -231,12 +236,18 @@ func main() {
   if err != nil {
     panic(err.Error())
   }
+  texture.StartBatch()
   loadAllRegistries()
 
   // TODO: Might want to be able to reload stuff, but this is sensitive because it
   // is loading textures.  We should probably redo the sprite system so that this
   // is easier to safely handle.
   game.LoadAllEntities()
+  texture.FinishBatch(func(done, total int) {
+    if done == total {
+      base.Log().Printf("Loaded %d textures", total)
+    }
+  })
 
   // Set up editors
   editors = map[string]house.Editor{
@@ -0,0 +1,62 @@
+package texture
+
+import (
+  "sync"
+)
+
+// Objects tagged with `registry:"autoload"` are normally loaded the first time
+// they are drawn.  Between StartBatch and FinishBatch their paths are
+// collected instead so that they can all be loaded up front.
+var batch struct {
+  sync.Mutex
+  on    bool
+  paths map[string]bool
+}
+
+func StartBatch() {
+  batch.Lock()
+  defer batch.Unlock()
+  batch.on = true
+  batch.paths = make(map[string]bool)
+}
+
+// Called by the registry on autoloaded Objects.  Does nothing unless a batch
+// has been started, in which case the texture will be loaded by FinishBatch.
+func (o *Object) Load() {
+  batch.Lock()
+  defer batch.Unlock()
+  if batch.on && o.Path != "" {
+    batch.paths[string(o.Path)] = true
+  }
+}
+
+// Loads every texture collected since StartBatch, see LoadBatch.
+func FinishBatch(progress func(done, total int)) {
+  batch.Lock()
+  var paths []string
+  for path := range batch.paths {
+    paths = append(paths, path)
+  }
+  batch.on = false
+  batch.paths = nil
+  batch.Unlock()
+  LoadBatch(paths, progress)
+}
+
+// Loads all of the textures in paths and blocks until they are all done.  The
+// images are decoded by the same routines that load textures on demand, so
+// several are decoded at once.  progress, if not nil, is called on the
+// calling go-routine each time a texture finishes.  This must not be called
+// from the render thread since it waits on work queued there.
+func LoadBatch(paths []string, progress func(done, total int)) {
+  finished := make(chan bool, len(paths))
+  for _, path := range paths {
+    manager.loadFromPath(path, func() { finished <- true })
+  }
+  for done := 1; done <= len(paths); done++ {
+    <-finished
+    if progress != nil {
+      progress(done, len(paths))
+    }
+  }
+}
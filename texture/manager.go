@@ -218,6 +218,10 @@ func LoadFromPath(path string) *Data {
 type loadRequest struct {
   path string
   data *Data
+
+  // If not nil this is called once the texture has been sent to opengl, or
+  // once it has failed to load.
+  done func()
 }
 
 var load_requests chan loadRequest
@@ -275,6 +279,9 @@ func handleLoadRequest(req loadRequest) {
   im, _, err := image.Decode(f)
   f.Close()
   if err != nil {
+    if req.done != nil {
+      req.done()
+    }
     return
   }
   gray := true
@@ -336,10 +343,19 @@ func handleLoadRequest(req loadRequest) {
       load_count = 0
       load_mutex.Unlock()
     }
+    if req.done != nil {
+      req.done()
+    }
   })
 }
 
 func (m *Manager) LoadFromPath(path string) *Data {
+  return m.loadFromPath(path, nil)
+}
+
+// Like LoadFromPath, but done is called once the texture has finished
+// loading, or right away if it was already loaded or can't be loaded.
+func (m *Manager) loadFromPath(path string, done func()) *Data {
   setupTextureList()
   m.mutex.RLock()
   var data *Data
@@ -349,6 +365,9 @@ func (m *Manager) LoadFromPath(path string) *Data {
     m.mutex.Lock()
     data.accessed = generation
     m.mutex.Unlock()
+    if done != nil {
+      done()
+    }
     return data
   }
   m.mutex.RUnlock()
@@ -364,6 +383,9 @@ func (m *Manager) LoadFromPath(path string) *Data {
 
   f, err := os.Open(path)
   if err != nil {
+    if done != nil {
+      done()
+    }
     return data
   }
   config, _, err := image.DecodeConfig(f)
@@ -371,6 +393,6 @@ func (m *Manager) LoadFromPath(path string) *Data {
   data.dx = config.Width
   data.dy = config.Height
 
-  load_requests <- loadRequest{path, data}
+  load_requests <- loadRequest{path, data, done}
   return data
 }